@@ -2,15 +2,87 @@ package api
 
 import (
 	"context"
+	"time"
 
 	"github.com/filecoin-project/go-jsonrpc/auth"
 	"github.com/google/uuid"
+	"github.com/libp2p/go-libp2p-core/peer"
+
+	"github.com/lyswifter/dbridge/lib/alerting"
+	"github.com/lyswifter/dbridge/lib/journal"
 )
 
 type Common interface {
 	AuthVerify(ctx context.Context, token string) ([]auth.Permission, error) //perm:read
 	AuthNew(ctx context.Context, perms []auth.Permission) ([]byte, error)    //perm:admin
 
+	// AuthNewToken creates a token with the given permissions. A non-zero ttl
+	// makes the token expire, the label is kept for bookkeeping only.
+	AuthNewToken(ctx context.Context, perms []auth.Permission, label string, ttl time.Duration) ([]byte, error) //perm:admin
+	// AuthNewRoleToken creates a token for one of the roles configured in
+	// API.Roles, which only allows calling the methods listed for the role.
+	AuthNewRoleToken(ctx context.Context, role string, label string, ttl time.Duration) ([]byte, error) //perm:admin
+	// AuthList lists the tokens issued through the API, including revoked and
+	// expired ones.
+	AuthList(ctx context.Context) ([]TokenInfo, error) //perm:admin
+	// AuthRevoke revokes the token with the given ID, it will fail
+	// verification from then on.
+	AuthRevoke(ctx context.Context, id string) error //perm:admin
+	// AuthRotateSecret creates a new secret to sign tokens with and returns
+	// its key ID. Tokens signed with previous secrets keep verifying for the
+	// grace period, the local CLI token is re-issued right away.
+	AuthRotateSecret(ctx context.Context, grace time.Duration) (string, error) //perm:admin
+
+	// LogList lists the logging subsystems.
+	LogList(context.Context) ([]string, error) //perm:write
+	// LogSetLevel sets the level of a logging subsystem, or of all of them
+	// when subsystem is '*'. Levels are one of: debug, info, warn, error,
+	// dpanic, panic, fatal.
+	LogSetLevel(ctx context.Context, subsystem, level string) error //perm:write
+	// LogAlerts returns the alerts registered with the node, both active and
+	// resolved.
+	LogAlerts(ctx context.Context) ([]alerting.Alert, error) //perm:admin
+	// LogStream streams log messages at or above minLevel, from the given
+	// subsystems or from all of them if none are given. Messages are dropped
+	// when the client doesn't keep up.
+	LogStream(ctx context.Context, minLevel string, subsystems []string) (<-chan LogEntry, error) //perm:admin
+
+	// JournalRecent returns up to limit of the most recent journal events,
+	// oldest first. Event types are given as "system:event", or as "system"
+	// for all events of a system; when none are given all events match.
+	JournalRecent(ctx context.Context, limit int, eventTypes []string) ([]journal.Event, error) //perm:admin
+
+	// ConfigReload re-reads the config file and applies the changes which
+	// don't need a restart: connection manager watermarks, protected peers,
+	// pubsub direct peers and API rate limits. It returns all fields which
+	// differ from the running config, and whether they were applied.
+	ConfigReload(ctx context.Context) ([]ConfigChange, error) //perm:admin
+
+	// Backup writes a consistent backup of the metadata datastore to path,
+	// which must be in the configured backup directory; relative paths are
+	// resolved against it, and an empty path picks a name.
+	Backup(ctx context.Context, path string) (BackupInfo, error) //perm:admin
+	// BackupList returns the backups in the backup directory, oldest first.
+	BackupList(ctx context.Context) ([]BackupInfo, error) //perm:admin
+
+	// KeyList lists the keys in the keystore, without their private parts.
+	KeyList(ctx context.Context) ([]KeyEntry, error) //perm:admin
+	// KeyExport returns the key with the given name encrypted with the
+	// passphrase, in the format read by KeyImport.
+	KeyExport(ctx context.Context, name string, passphrase []byte) ([]byte, error) //perm:admin
+	// KeyImport decrypts a key exported by KeyExport with the passphrase, and
+	// stores it under the given name, or the name it was exported under when
+	// it's empty. The name must not be taken. It returns the name the key was
+	// stored under.
+	KeyImport(ctx context.Context, name string, exported []byte, passphrase []byte) (string, error) //perm:admin
+	// KeyDelete removes a key from the keystore. Keys the node uses, like the
+	// libp2p host key and API secrets, are only removed with force.
+	KeyDelete(ctx context.Context, name string, force bool) error //perm:admin
+	// KeyRotateLibp2p replaces the libp2p host key with a new one, and returns
+	// the new peer ID. The old key is kept under a trash- prefixed name. The
+	// running node keeps its identity until it's restarted.
+	KeyRotateLibp2p(ctx context.Context) (peer.ID, error) //perm:admin
+
 	// trigger graceful shutdown
 	Shutdown(context.Context) error //perm:admin
 
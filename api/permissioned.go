@@ -1,7 +1,13 @@
 package api
 
 import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+
 	"github.com/filecoin-project/go-jsonrpc/auth"
+	"golang.org/x/xerrors"
 )
 
 const (
@@ -16,10 +22,116 @@ const (
 var AllPermissions = []auth.Permission{PermRead, PermWrite, PermSign, PermAdmin}
 var DefaultPerms = []auth.Permission{PermRead}
 
+// PermRestricted is granted to tokens issued for a role. Callers holding it
+// can only invoke the methods they were granted a MethodPermission for, on
+// top of holding the permission required by the method.
+const PermRestricted auth.Permission = "restricted"
+
+const methodPermPrefix = "method:"
+
+// MethodPermission returns the permission granting access to a single method.
+func MethodPermission(method string) auth.Permission {
+	return auth.Permission(methodPermPrefix + method)
+}
+
+// RoleMethods resolves the method allowlist of a role. Entries are method
+// names, or prefixes ending with '*', e.g. 'Net*'.
+func RoleMethods(allow []string) ([]string, error) {
+	var out []string
+	seen := map[string]struct{}{}
+
+	for _, entry := range allow {
+		var matched bool
+		for method := range MethodPerms {
+			if method == entry || strings.HasSuffix(entry, "*") && strings.HasPrefix(method, strings.TrimSuffix(entry, "*")) {
+				matched = true
+				if _, ok := seen[method]; !ok {
+					seen[method] = struct{}{}
+					out = append(out, method)
+				}
+			}
+		}
+
+		if !matched {
+			return nil, xerrors.Errorf("no API method matches '%s'", entry)
+		}
+	}
+
+	sort.Strings(out)
+	return out, nil
+}
+
+// RolePermissions returns the permissions granted by a token for a role with
+// the given methods: the permission level needed to call all of the methods,
+// restricted to just those methods.
+func RolePermissions(methods []string) ([]auth.Permission, error) {
+	level := 0
+	for _, method := range methods {
+		perm, ok := MethodPerms[method]
+		if !ok {
+			return nil, xerrors.Errorf("unknown API method '%s'", method)
+		}
+		for i, p := range AllPermissions {
+			if p == perm && i > level {
+				level = i
+			}
+		}
+	}
+
+	out := append([]auth.Permission{}, AllPermissions[:level+1]...)
+	out = append(out, PermRestricted)
+	for _, method := range methods {
+		out = append(out, MethodPermission(method))
+	}
+	return out, nil
+}
+
+// PermissionsUpTo returns the permission set granted by a permission level,
+// for example 'sign' gives [read, write, sign].
+func PermissionsUpTo(perm auth.Permission) ([]auth.Permission, error) {
+	for i, p := range AllPermissions {
+		if p == perm {
+			return AllPermissions[:i+1], nil
+		}
+	}
+
+	return nil, xerrors.Errorf("permission has to be one of: %s", AllPermissions)
+}
+
 func permissionedProxies(in, out interface{}) {
 	outs := GetInternalStructs(out)
 	for _, o := range outs {
 		auth.PermissionedProxy(AllPermissions, DefaultPerms, in, o)
+		restrictMethods(o)
+	}
+}
+
+// restrictMethods wraps the methods of a permissioned proxy, rejecting calls
+// from restricted callers which weren't granted access to the method.
+func restrictMethods(out interface{}) {
+	rint := reflect.ValueOf(out).Elem()
+
+	for f := 0; f < rint.NumField(); f++ {
+		field := rint.Type().Field(f)
+		fn := rint.Field(f).Interface()
+
+		rint.Field(f).Set(reflect.MakeFunc(field.Type, func(args []reflect.Value) (results []reflect.Value) {
+			ctx := args[0].Interface().(context.Context)
+			if !auth.HasPerm(ctx, DefaultPerms, PermRestricted) || auth.HasPerm(ctx, DefaultPerms, MethodPermission(field.Name)) {
+				return reflect.ValueOf(fn).Call(args)
+			}
+
+			err := xerrors.Errorf("missing permission to invoke '%s' (not allowed for role)", field.Name)
+			rerr := reflect.ValueOf(&err).Elem()
+
+			if field.Type.NumOut() == 2 {
+				return []reflect.Value{
+					reflect.Zero(field.Type.Out(0)),
+					rerr,
+				}
+			}
+			return []reflect.Value{rerr}
+		}))
 	}
 }
 
@@ -4,6 +4,7 @@ package api
 
 import (
 	"context"
+	"time"
 
 	"github.com/filecoin-project/go-jsonrpc/auth"
 	"github.com/google/uuid"
@@ -11,6 +12,8 @@ import (
 	"github.com/libp2p/go-libp2p-core/network"
 	"github.com/libp2p/go-libp2p-core/peer"
 	protocol "github.com/libp2p/go-libp2p-protocol"
+	"github.com/lyswifter/dbridge/lib/alerting"
+	"github.com/lyswifter/dbridge/lib/journal"
 	"golang.org/x/xerrors"
 )
 
@@ -18,12 +21,48 @@ var ErrNotSupported = xerrors.New("method not supported")
 
 type CommonStruct struct {
 	Internal struct {
+		AuthList func(p0 context.Context) ([]TokenInfo, error) `perm:"admin"`
+
 		AuthNew func(p0 context.Context, p1 []auth.Permission) ([]byte, error) `perm:"admin"`
 
+		AuthNewRoleToken func(p0 context.Context, p1 string, p2 string, p3 time.Duration) ([]byte, error) `perm:"admin"`
+
+		AuthNewToken func(p0 context.Context, p1 []auth.Permission, p2 string, p3 time.Duration) ([]byte, error) `perm:"admin"`
+
+		AuthRevoke func(p0 context.Context, p1 string) error `perm:"admin"`
+
+		AuthRotateSecret func(p0 context.Context, p1 time.Duration) (string, error) `perm:"admin"`
+
 		AuthVerify func(p0 context.Context, p1 string) ([]auth.Permission, error) `perm:"read"`
 
+		Backup func(p0 context.Context, p1 string) (BackupInfo, error) `perm:"admin"`
+
+		BackupList func(p0 context.Context) ([]BackupInfo, error) `perm:"admin"`
+
 		Closing func(p0 context.Context) (<-chan struct{}, error) `perm:"read"`
 
+		ConfigReload func(p0 context.Context) ([]ConfigChange, error) `perm:"admin"`
+
+		JournalRecent func(p0 context.Context, p1 int, p2 []string) ([]journal.Event, error) `perm:"admin"`
+
+		KeyDelete func(p0 context.Context, p1 string, p2 bool) error `perm:"admin"`
+
+		KeyExport func(p0 context.Context, p1 string, p2 []byte) ([]byte, error) `perm:"admin"`
+
+		KeyImport func(p0 context.Context, p1 string, p2 []byte, p3 []byte) (string, error) `perm:"admin"`
+
+		KeyList func(p0 context.Context) ([]KeyEntry, error) `perm:"admin"`
+
+		KeyRotateLibp2p func(p0 context.Context) (peer.ID, error) `perm:"admin"`
+
+		LogAlerts func(p0 context.Context) ([]alerting.Alert, error) `perm:"admin"`
+
+		LogList func(p0 context.Context) ([]string, error) `perm:"write"`
+
+		LogSetLevel func(p0 context.Context, p1 string, p2 string) error `perm:"write"`
+
+		LogStream func(p0 context.Context, p1 string, p2 []string) (<-chan LogEntry, error) `perm:"admin"`
+
 		Session func(p0 context.Context) (uuid.UUID, error) `perm:"read"`
 
 		Shutdown func(p0 context.Context) error `perm:"admin"`
@@ -104,6 +143,17 @@ type NetStruct struct {
 type NetStub struct {
 }
 
+func (s *CommonStruct) AuthList(p0 context.Context) ([]TokenInfo, error) {
+	if s.Internal.AuthList == nil {
+		return *new([]TokenInfo), ErrNotSupported
+	}
+	return s.Internal.AuthList(p0)
+}
+
+func (s *CommonStub) AuthList(p0 context.Context) ([]TokenInfo, error) {
+	return *new([]TokenInfo), ErrNotSupported
+}
+
 func (s *CommonStruct) AuthNew(p0 context.Context, p1 []auth.Permission) ([]byte, error) {
 	if s.Internal.AuthNew == nil {
 		return *new([]byte), ErrNotSupported
@@ -115,6 +165,50 @@ func (s *CommonStub) AuthNew(p0 context.Context, p1 []auth.Permission) ([]byte,
 	return *new([]byte), ErrNotSupported
 }
 
+func (s *CommonStruct) AuthNewRoleToken(p0 context.Context, p1 string, p2 string, p3 time.Duration) ([]byte, error) {
+	if s.Internal.AuthNewRoleToken == nil {
+		return *new([]byte), ErrNotSupported
+	}
+	return s.Internal.AuthNewRoleToken(p0, p1, p2, p3)
+}
+
+func (s *CommonStub) AuthNewRoleToken(p0 context.Context, p1 string, p2 string, p3 time.Duration) ([]byte, error) {
+	return *new([]byte), ErrNotSupported
+}
+
+func (s *CommonStruct) AuthNewToken(p0 context.Context, p1 []auth.Permission, p2 string, p3 time.Duration) ([]byte, error) {
+	if s.Internal.AuthNewToken == nil {
+		return *new([]byte), ErrNotSupported
+	}
+	return s.Internal.AuthNewToken(p0, p1, p2, p3)
+}
+
+func (s *CommonStub) AuthNewToken(p0 context.Context, p1 []auth.Permission, p2 string, p3 time.Duration) ([]byte, error) {
+	return *new([]byte), ErrNotSupported
+}
+
+func (s *CommonStruct) AuthRevoke(p0 context.Context, p1 string) error {
+	if s.Internal.AuthRevoke == nil {
+		return ErrNotSupported
+	}
+	return s.Internal.AuthRevoke(p0, p1)
+}
+
+func (s *CommonStub) AuthRevoke(p0 context.Context, p1 string) error {
+	return ErrNotSupported
+}
+
+func (s *CommonStruct) AuthRotateSecret(p0 context.Context, p1 time.Duration) (string, error) {
+	if s.Internal.AuthRotateSecret == nil {
+		return "", ErrNotSupported
+	}
+	return s.Internal.AuthRotateSecret(p0, p1)
+}
+
+func (s *CommonStub) AuthRotateSecret(p0 context.Context, p1 time.Duration) (string, error) {
+	return "", ErrNotSupported
+}
+
 func (s *CommonStruct) AuthVerify(p0 context.Context, p1 string) ([]auth.Permission, error) {
 	if s.Internal.AuthVerify == nil {
 		return *new([]auth.Permission), ErrNotSupported
@@ -126,6 +220,28 @@ func (s *CommonStub) AuthVerify(p0 context.Context, p1 string) ([]auth.Permissio
 	return *new([]auth.Permission), ErrNotSupported
 }
 
+func (s *CommonStruct) Backup(p0 context.Context, p1 string) (BackupInfo, error) {
+	if s.Internal.Backup == nil {
+		return *new(BackupInfo), ErrNotSupported
+	}
+	return s.Internal.Backup(p0, p1)
+}
+
+func (s *CommonStub) Backup(p0 context.Context, p1 string) (BackupInfo, error) {
+	return *new(BackupInfo), ErrNotSupported
+}
+
+func (s *CommonStruct) BackupList(p0 context.Context) ([]BackupInfo, error) {
+	if s.Internal.BackupList == nil {
+		return *new([]BackupInfo), ErrNotSupported
+	}
+	return s.Internal.BackupList(p0)
+}
+
+func (s *CommonStub) BackupList(p0 context.Context) ([]BackupInfo, error) {
+	return *new([]BackupInfo), ErrNotSupported
+}
+
 func (s *CommonStruct) Closing(p0 context.Context) (<-chan struct{}, error) {
 	if s.Internal.Closing == nil {
 		return nil, ErrNotSupported
@@ -137,6 +253,127 @@ func (s *CommonStub) Closing(p0 context.Context) (<-chan struct{}, error) {
 	return nil, ErrNotSupported
 }
 
+func (s *CommonStruct) ConfigReload(p0 context.Context) ([]ConfigChange, error) {
+	if s.Internal.ConfigReload == nil {
+		return *new([]ConfigChange), ErrNotSupported
+	}
+	return s.Internal.ConfigReload(p0)
+}
+
+func (s *CommonStub) ConfigReload(p0 context.Context) ([]ConfigChange, error) {
+	return *new([]ConfigChange), ErrNotSupported
+}
+
+func (s *CommonStruct) JournalRecent(p0 context.Context, p1 int, p2 []string) ([]journal.Event, error) {
+	if s.Internal.JournalRecent == nil {
+		return *new([]journal.Event), ErrNotSupported
+	}
+	return s.Internal.JournalRecent(p0, p1, p2)
+}
+
+func (s *CommonStub) JournalRecent(p0 context.Context, p1 int, p2 []string) ([]journal.Event, error) {
+	return *new([]journal.Event), ErrNotSupported
+}
+
+func (s *CommonStruct) KeyDelete(p0 context.Context, p1 string, p2 bool) error {
+	if s.Internal.KeyDelete == nil {
+		return ErrNotSupported
+	}
+	return s.Internal.KeyDelete(p0, p1, p2)
+}
+
+func (s *CommonStub) KeyDelete(p0 context.Context, p1 string, p2 bool) error {
+	return ErrNotSupported
+}
+
+func (s *CommonStruct) KeyExport(p0 context.Context, p1 string, p2 []byte) ([]byte, error) {
+	if s.Internal.KeyExport == nil {
+		return *new([]byte), ErrNotSupported
+	}
+	return s.Internal.KeyExport(p0, p1, p2)
+}
+
+func (s *CommonStub) KeyExport(p0 context.Context, p1 string, p2 []byte) ([]byte, error) {
+	return *new([]byte), ErrNotSupported
+}
+
+func (s *CommonStruct) KeyImport(p0 context.Context, p1 string, p2 []byte, p3 []byte) (string, error) {
+	if s.Internal.KeyImport == nil {
+		return "", ErrNotSupported
+	}
+	return s.Internal.KeyImport(p0, p1, p2, p3)
+}
+
+func (s *CommonStub) KeyImport(p0 context.Context, p1 string, p2 []byte, p3 []byte) (string, error) {
+	return "", ErrNotSupported
+}
+
+func (s *CommonStruct) KeyList(p0 context.Context) ([]KeyEntry, error) {
+	if s.Internal.KeyList == nil {
+		return *new([]KeyEntry), ErrNotSupported
+	}
+	return s.Internal.KeyList(p0)
+}
+
+func (s *CommonStub) KeyList(p0 context.Context) ([]KeyEntry, error) {
+	return *new([]KeyEntry), ErrNotSupported
+}
+
+func (s *CommonStruct) KeyRotateLibp2p(p0 context.Context) (peer.ID, error) {
+	if s.Internal.KeyRotateLibp2p == nil {
+		return *new(peer.ID), ErrNotSupported
+	}
+	return s.Internal.KeyRotateLibp2p(p0)
+}
+
+func (s *CommonStub) KeyRotateLibp2p(p0 context.Context) (peer.ID, error) {
+	return *new(peer.ID), ErrNotSupported
+}
+
+func (s *CommonStruct) LogAlerts(p0 context.Context) ([]alerting.Alert, error) {
+	if s.Internal.LogAlerts == nil {
+		return *new([]alerting.Alert), ErrNotSupported
+	}
+	return s.Internal.LogAlerts(p0)
+}
+
+func (s *CommonStub) LogAlerts(p0 context.Context) ([]alerting.Alert, error) {
+	return *new([]alerting.Alert), ErrNotSupported
+}
+
+func (s *CommonStruct) LogList(p0 context.Context) ([]string, error) {
+	if s.Internal.LogList == nil {
+		return *new([]string), ErrNotSupported
+	}
+	return s.Internal.LogList(p0)
+}
+
+func (s *CommonStub) LogList(p0 context.Context) ([]string, error) {
+	return *new([]string), ErrNotSupported
+}
+
+func (s *CommonStruct) LogSetLevel(p0 context.Context, p1 string, p2 string) error {
+	if s.Internal.LogSetLevel == nil {
+		return ErrNotSupported
+	}
+	return s.Internal.LogSetLevel(p0, p1, p2)
+}
+
+func (s *CommonStub) LogSetLevel(p0 context.Context, p1 string, p2 string) error {
+	return ErrNotSupported
+}
+
+func (s *CommonStruct) LogStream(p0 context.Context, p1 string, p2 []string) (<-chan LogEntry, error) {
+	if s.Internal.LogStream == nil {
+		return nil, ErrNotSupported
+	}
+	return s.Internal.LogStream(p0, p1, p2)
+}
+
+func (s *CommonStub) LogStream(p0 context.Context, p1 string, p2 []string) (<-chan LogEntry, error) {
+	return nil, ErrNotSupported
+}
+
 func (s *CommonStruct) Session(p0 context.Context) (uuid.UUID, error) {
 	if s.Internal.Session == nil {
 		return *new(uuid.UUID), ErrNotSupported
@@ -350,3 +587,47 @@ var _ Common = new(CommonStruct)
 var _ CommonNet = new(CommonNetStruct)
 var _ FullNode = new(FullNodeStruct)
 var _ Net = new(NetStruct)
+
+// MethodPerms maps each API method to the permission required to call it.
+var MethodPerms = map[string]auth.Permission{
+	"AuthList":                    "admin",
+	"AuthNew":                     "admin",
+	"AuthNewRoleToken":            "admin",
+	"AuthNewToken":                "admin",
+	"AuthRevoke":                  "admin",
+	"AuthRotateSecret":            "admin",
+	"AuthVerify":                  "read",
+	"Backup":                      "admin",
+	"BackupList":                  "admin",
+	"Closing":                     "read",
+	"ConfigReload":                "admin",
+	"JournalRecent":               "admin",
+	"KeyDelete":                   "admin",
+	"KeyExport":                   "admin",
+	"KeyImport":                   "admin",
+	"KeyList":                     "admin",
+	"KeyRotateLibp2p":             "admin",
+	"LogAlerts":                   "admin",
+	"LogList":                     "write",
+	"LogSetLevel":                 "write",
+	"LogStream":                   "admin",
+	"Session":                     "read",
+	"Shutdown":                    "admin",
+	"ID":                          "read",
+	"NetAddrsListen":              "read",
+	"NetAgentVersion":             "read",
+	"NetAutoNatStatus":            "read",
+	"NetBandwidthStats":           "read",
+	"NetBandwidthStatsByPeer":     "read",
+	"NetBandwidthStatsByProtocol": "read",
+	"NetBlockAdd":                 "admin",
+	"NetBlockList":                "read",
+	"NetBlockRemove":              "admin",
+	"NetConnect":                  "write",
+	"NetConnectedness":            "read",
+	"NetDisconnect":               "write",
+	"NetFindPeer":                 "read",
+	"NetPeerInfo":                 "read",
+	"NetPeers":                    "read",
+	"NetPubsubScores":             "read",
+}
@@ -3,10 +3,40 @@ package api
 import (
 	"time"
 
+	"github.com/filecoin-project/go-jsonrpc/auth"
 	"github.com/libp2p/go-libp2p-core/peer"
 	pubsub "github.com/libp2p/go-libp2p-pubsub"
+
+	"github.com/lyswifter/dbridge/types"
 )
 
+// TokenInfo describes an API token, it never contains the token itself.
+type TokenInfo struct {
+	ID      string
+	Label   string
+	Issuer  string
+	Role    string // empty for tokens not issued for a role
+	Allow   []auth.Permission
+	Issued  time.Time
+	Expires time.Time // zero if the token doesn't expire
+	Revoked bool
+}
+
+func (ti TokenInfo) Expired(now time.Time) bool {
+	return !ti.Expires.IsZero() && now.After(ti.Expires)
+}
+
+// LogEntry is a log message streamed by LogStream.
+type LogEntry struct {
+	Time    time.Time
+	Level   string
+	System  string
+	Caller  string `json:",omitempty"`
+	Message string
+	// Fields holds the structured context of the message
+	Fields map[string]interface{} `json:",omitempty"`
+}
+
 type PubsubScore struct {
 	ID    peer.ID
 	Score *pubsub.PeerScoreSnapshot
@@ -47,3 +77,33 @@ type NodePeerStatus struct {
 	PeersToPublishMsgs   int
 	PeersToPublishBlocks int
 }
+
+// ConfigChange describes a config field which changed on disk, as found by
+// ConfigReload.
+type ConfigChange struct {
+	// Field is the path of the changed field, e.g. Libp2p.ConnMgrLow
+	Field string
+	// Applied is set when the new value took effect on the running node,
+	// otherwise it takes effect after a restart.
+	Applied bool
+	Note    string `json:",omitempty"`
+}
+
+// KeyEntry describes a key in the keystore of the node, without its private
+// part.
+type KeyEntry struct {
+	Name string
+	Type types.KeyType
+	// PeerID is set for libp2p keys
+	PeerID peer.ID `json:",omitempty"`
+}
+
+// BackupInfo describes a metadata backup in the backup directory of the node.
+type BackupInfo struct {
+	Name string
+	Path string
+	Size int64
+	Time time.Time
+	// Scheduled backups are removed once older than the retained number
+	Scheduled bool
+}
@@ -2,6 +2,8 @@ package cli
 
 import (
 	"fmt"
+	"sort"
+	"time"
 
 	"github.com/filecoin-project/go-jsonrpc/auth"
 	"github.com/lyswifter/dbridge/api"
@@ -17,6 +19,9 @@ var AuthCmd = &cli.Command{
 	Subcommands: []*cli.Command{
 		AuthCreateAdminToken,
 		AuthApiInfoToken,
+		AuthListCmd,
+		AuthRevokeCmd,
+		AuthRotateSecretCmd,
 	},
 }
 
@@ -28,6 +33,18 @@ var AuthCreateAdminToken = &cli.Command{
 			Name:  "perm",
 			Usage: "permission to assign to the token, one of: read, write, sign, admin",
 		},
+		&cli.StringFlag{
+			Name:  "role",
+			Usage: "create a token for a role configured in API.Roles, instead of a permission level",
+		},
+		&cli.DurationFlag{
+			Name:  "ttl",
+			Usage: "time after which the token expires (0 means never)",
+		},
+		&cli.StringFlag{
+			Name:  "label",
+			Usage: "label to identify the token by in 'auth list'",
+		},
 	},
 
 	Action: func(cctx *cli.Context) error {
@@ -39,8 +56,21 @@ var AuthCreateAdminToken = &cli.Command{
 
 		ctx := ReqContext(cctx)
 
+		if cctx.IsSet("role") {
+			if cctx.IsSet("perm") {
+				return xerrors.New("--perm and --role can't be used together")
+			}
+
+			token, err := napi.AuthNewRoleToken(ctx, cctx.String("role"), cctx.String("label"), cctx.Duration("ttl"))
+			if err != nil {
+				return err
+			}
+
+			return printToken(cctx, token)
+		}
+
 		if !cctx.IsSet("perm") {
-			return xerrors.New("--perm flag not set")
+			return xerrors.New("--perm or --role flag not set")
 		}
 
 		perm := cctx.String("perm")
@@ -56,18 +86,25 @@ var AuthCreateAdminToken = &cli.Command{
 		}
 
 		// slice on [:idx] so for example: 'sign' gives you [read, write, sign]
-		token, err := napi.AuthNew(ctx, api.AllPermissions[:idx])
+		token, err := napi.AuthNewToken(ctx, api.AllPermissions[:idx], cctx.String("label"), cctx.Duration("ttl"))
 		if err != nil {
 			return err
 		}
 
 		// TODO: Log in audit log when it is implemented
 
-		fmt.Println(string(token))
-		return nil
+		return printToken(cctx, token)
 	},
 }
 
+func printToken(cctx *cli.Context, token []byte) error {
+	t := NewTable("Token")
+	t.Headless = true
+	t.Add(string(token))
+
+	return PrintResult(cctx, struct{ Token string }{Token: string(token)}, t)
+}
+
 var AuthApiInfoToken = &cli.Command{
 	Name:  "api-info",
 	Usage: "Get token with API info required to connect to this node",
@@ -127,7 +164,159 @@ var AuthApiInfoToken = &cli.Command{
 		// TODO: Log in audit log when it is implemented
 
 		currentEnv, _, _ := cliutil.EnvsForAPIInfos(t)
-		fmt.Printf("%s=%s:%s\n", currentEnv, string(token), ainfo.Addr)
-		return nil
+
+		out := struct {
+			Env   string
+			Token string
+			Addr  string
+		}{
+			Env:   currentEnv,
+			Token: string(token),
+			Addr:  ainfo.Addr,
+		}
+
+		tbl := NewTable("APIInfo")
+		tbl.Headless = true
+		tbl.Add(fmt.Sprintf("%s=%s:%s", out.Env, out.Token, out.Addr))
+
+		return PrintResult(cctx, out, tbl)
+	},
+}
+
+var AuthListCmd = &cli.Command{
+	Name:  "list",
+	Usage: "List tokens issued by the node",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "all",
+			Usage: "include revoked and expired tokens",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		napi, closer, err := GetFullNodeAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := ReqContext(cctx)
+
+		tokens, err := napi.AuthList(ctx)
+		if err != nil {
+			return err
+		}
+
+		sort.Slice(tokens, func(i, j int) bool {
+			return tokens[i].Issued.Before(tokens[j].Issued)
+		})
+
+		type tokenState struct {
+			api.TokenInfo
+			State string
+		}
+
+		now := time.Now()
+		out := []tokenState{}
+		t := NewTable("ID", "Label", "Perm", "Issued", "Expires", "State")
+
+		for _, ti := range tokens {
+			state := "active"
+			switch {
+			case ti.Revoked:
+				state = "revoked"
+			case ti.Expired(now):
+				state = "expired"
+			}
+			if state != "active" && !cctx.Bool("all") {
+				continue
+			}
+			out = append(out, tokenState{TokenInfo: ti, State: state})
+
+			expires := "never"
+			if !ti.Expires.IsZero() {
+				expires = ti.Expires.Format(time.RFC3339)
+			}
+
+			perm := "-"
+			if ti.Role != "" {
+				perm = "role:" + ti.Role
+			} else if len(ti.Allow) > 0 {
+				perm = string(ti.Allow[len(ti.Allow)-1])
+			}
+
+			t.Add(ti.ID, ti.Label, perm, ti.Issued.Format(time.RFC3339), expires, state)
+		}
+
+		return PrintResult(cctx, out, t)
+	},
+}
+
+var AuthRevokeCmd = &cli.Command{
+	Name:      "revoke",
+	Usage:     "Revoke a token",
+	ArgsUsage: "[token id]",
+	Action: func(cctx *cli.Context) error {
+		if cctx.Args().Len() != 1 {
+			return ShowHelp(cctx, xerrors.New("expected exactly one token id"))
+		}
+
+		napi, closer, err := GetFullNodeAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := ReqContext(cctx)
+
+		if err := napi.AuthRevoke(ctx, cctx.Args().First()); err != nil {
+			return err
+		}
+
+		t := NewTable("Result")
+		t.Headless = true
+		t.Add("revoked token " + cctx.Args().First())
+
+		return PrintResult(cctx, struct {
+			ID      string
+			Revoked bool
+		}{ID: cctx.Args().First(), Revoked: true}, t)
+	},
+}
+
+var AuthRotateSecretCmd = &cli.Command{
+	Name:  "rotate-secret",
+	Usage: "Start signing tokens with a new secret",
+	Description: `Tokens signed with the previous secrets keep working until the grace
+   period ends. The token used by the local CLI is re-issued immediately, other
+   tokens have to be re-created before the grace period runs out.`,
+	Flags: []cli.Flag{
+		&cli.DurationFlag{
+			Name:  "grace",
+			Usage: "how long tokens signed with previous secrets remain valid",
+			Value: 24 * time.Hour,
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		napi, closer, err := GetFullNodeAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := ReqContext(cctx)
+
+		kid, err := napi.AuthRotateSecret(ctx, cctx.Duration("grace"))
+		if err != nil {
+			return err
+		}
+
+		t := NewTable("Result")
+		t.Headless = true
+		t.Add(fmt.Sprintf("signing tokens with key %s, previous keys expire in %s", kid, cctx.Duration("grace")))
+
+		return PrintResult(cctx, struct {
+			KeyID string
+			Grace string
+		}{KeyID: kid, Grace: cctx.Duration("grace").String()}, t)
 	},
 }
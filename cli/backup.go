@@ -0,0 +1,150 @@
+package cli
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/ipfs/go-datastore"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/lyswifter/dbridge/lib/backupds"
+	"github.com/lyswifter/dbridge/types"
+)
+
+var BackupCmd = &cli.Command{
+	Name:  "backup",
+	Usage: "Manage metadata backups",
+	Subcommands: []*cli.Command{
+		BackupCreate,
+		BackupList,
+		BackupVerify,
+	},
+}
+
+var BackupCreate = &cli.Command{
+	Name:      "create",
+	Usage:     "Write a backup of the node metadata",
+	ArgsUsage: "[file name in the backup directory]",
+	Action: func(cctx *cli.Context) error {
+		api, closer, err := GetAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		bi, err := api.Backup(ReqContext(cctx), cctx.Args().First())
+		if err != nil {
+			return err
+		}
+
+		t := NewTable("Path", "Size")
+		t.Add(bi.Path, humanize.IBytes(uint64(bi.Size)))
+		return PrintResult(cctx, bi, t)
+	},
+}
+
+var BackupList = &cli.Command{
+	Name:  "list",
+	Usage: "List the backups in the backup directory of the node",
+	Action: func(cctx *cli.Context) error {
+		api, closer, err := GetAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		backups, err := api.BackupList(ReqContext(cctx))
+		if err != nil {
+			return err
+		}
+
+		t := NewTable("Name", "Size", "Time", "Scheduled")
+		for _, bi := range backups {
+			t.Add(bi.Name, humanize.IBytes(uint64(bi.Size)), bi.Time.Format(time.RFC3339), bi.Scheduled)
+		}
+		return PrintResult(cctx, backups, t)
+	},
+}
+
+var BackupVerify = &cli.Command{
+	Name:      "verify",
+	Usage:     "Check the checksum of a backup file",
+	ArgsUsage: "<backup file>",
+	Description: `Reads the backup, which must be available locally, and checks that its
+   entries match the checksum it was written with. Encrypted backups are read
+   with the keys given with --key-file, or the passphrase in
+   DBRIDGE_BACKUP_PASSPHRASE.`,
+	Flags: []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:  "key-file",
+			Usage: "keystore file of a backup key, e.g. <repo>/keystore/MJQWG23VOAWWWZLZ",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		if cctx.NArg() != 1 {
+			return ShowHelp(cctx, xerrors.New("expected one backup file"))
+		}
+
+		kr := backupds.NewKeyring()
+		for _, p := range cctx.StringSlice("key-file") {
+			data, err := ioutil.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			var ki types.KeyInfo
+			if err := json.Unmarshal(data, &ki); err != nil {
+				return xerrors.Errorf("decoding key file %s: %w", p, err)
+			}
+			k, err := backupds.NewKey(ki.PrivateKey)
+			if err != nil {
+				return xerrors.Errorf("key file %s: %w", p, err)
+			}
+			kr.Add(k)
+		}
+		if pass := os.Getenv(backupds.PassphraseEnv); pass != "" {
+			kr.AddPassphrase([]byte(pass))
+		}
+
+		f, err := os.Open(cctx.Args().First())
+		if err != nil {
+			return err
+		}
+		defer f.Close() //nolint:errcheck
+
+		res := struct {
+			Path       string
+			Keys       int
+			LogEntries int
+			Valid      bool
+			Error      string `json:",omitempty"`
+		}{Path: f.Name()}
+
+		_, err = backupds.ReadBackupWithKeys(f, kr, func(_ datastore.Key, _ []byte, log bool) error {
+			if log {
+				res.LogEntries++
+			} else {
+				res.Keys++
+			}
+			return nil
+		})
+		res.Valid = err == nil
+		if err != nil {
+			res.Error = err.Error()
+		}
+
+		t := NewTable("Path", "Keys", "Log Entries", "Valid")
+		t.Add(res.Path, res.Keys, res.LogEntries, res.Valid)
+		if err := PrintResult(cctx, res, t); err != nil {
+			return err
+		}
+
+		if !res.Valid {
+			return xerrors.Errorf("backup %s is invalid: %w", res.Path, err)
+		}
+		return nil
+	},
+}
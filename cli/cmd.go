@@ -20,9 +20,13 @@ var ReqContext = cliutil.ReqContext
 
 var GetFullNodeAPI = cliutil.GetFullNodeAPI
 
+var ForAllNodes = cliutil.ForAllNodes
+
 var Commands = []*cli.Command{
 	WithCategory("developer", AuthCmd),
 	WithCategory("network", NetCmd),
+	WithCategory("developer", LogCmd),
+	WithCategory("developer", BackupCmd),
 }
 
 func WithCategory(cat string, cmd *cli.Command) *cli.Command {
@@ -1,12 +1,17 @@
 package cli
 
 import (
+	"encoding/csv"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
+	"strings"
+	"text/tabwriter"
 
 	ufcli "github.com/urfave/cli/v2"
 	"golang.org/x/xerrors"
+	"gopkg.in/yaml.v3"
 )
 
 type PrintHelpErr struct {
@@ -74,3 +79,110 @@ func (a *AppFmt) Printf(fmtstr string, args ...interface{}) {
 func (a *AppFmt) Scan(args ...interface{}) (int, error) {
 	return fmt.Fscan(a.Stdin, args...)
 }
+
+// Output formats selectable with FlagOutput.
+const (
+	OutputTable = "table"
+	OutputJSON  = "json"
+	OutputYAML  = "yaml"
+	OutputCSV   = "csv"
+)
+
+// FlagOutput selects the format commands print their results in. It should be
+// included as a flag on the top-level command.
+var FlagOutput = &ufcli.StringFlag{
+	Name:    "output",
+	EnvVars: []string{"DBRIDGE_OUTPUT"},
+	Value:   OutputTable,
+	Usage:   "output format, one of: table, json, yaml, csv",
+}
+
+// Table is the tabular form of a command's result.
+type Table struct {
+	Columns []string
+	Rows    [][]string
+
+	// Headless tables are printed without the column names in table output,
+	// for results which are a single value, like a token.
+	Headless bool
+}
+
+func NewTable(columns ...string) *Table {
+	return &Table{Columns: columns}
+}
+
+// Add appends a row, values are formatted with fmt.Sprint.
+func (t *Table) Add(values ...interface{}) {
+	row := make([]string, len(values))
+	for i, v := range values {
+		row[i] = fmt.Sprint(v)
+	}
+	t.Rows = append(t.Rows, row)
+}
+
+// PrintResult prints the result of a command in the format selected with the
+// output flag. In json and yaml output, value is printed, in table and csv
+// output, the table is.
+func PrintResult(cctx *ufcli.Context, value interface{}, t *Table) error {
+	w := cctx.App.Writer
+	if w == nil {
+		w = os.Stdout
+	}
+
+	switch format := cctx.String(FlagOutput.Name); format {
+	case OutputTable, "":
+		tw := tabwriter.NewWriter(w, 4, 4, 2, ' ', 0)
+		if !t.Headless {
+			fmt.Fprintln(tw, strings.Join(t.Columns, "\t"))
+		}
+		for _, row := range t.Rows {
+			fmt.Fprintln(tw, strings.Join(row, "\t"))
+		}
+		return tw.Flush()
+	case OutputCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(t.Columns); err != nil {
+			return err
+		}
+		if err := cw.WriteAll(t.Rows); err != nil {
+			return err
+		}
+		return cw.Error()
+	case OutputJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(value)
+	case OutputYAML:
+		// round-trip through JSON, so that yaml output uses the same field
+		// names and value encodings as json output
+		b, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		var v interface{}
+		if err := json.Unmarshal(b, &v); err != nil {
+			return err
+		}
+
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(v); err != nil {
+			return err
+		}
+		return enc.Close()
+	default:
+		return CheckOutputFormat(cctx)
+	}
+}
+
+// CheckOutputFormat returns an error if the output flag is set to an unknown
+// format. Run it before commands make any changes, so that they don't fail
+// only once printing their result.
+func CheckOutputFormat(cctx *ufcli.Context) error {
+	switch format := cctx.String(FlagOutput.Name); format {
+	case OutputTable, OutputJSON, OutputYAML, OutputCSV, "":
+		return nil
+	default:
+		return xerrors.Errorf("unknown output format '%s', expected one of: %s, %s, %s, %s", format, OutputTable, OutputJSON, OutputYAML, OutputCSV)
+	}
+}
@@ -0,0 +1,298 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/lyswifter/dbridge/api"
+	"github.com/lyswifter/dbridge/lib/alerting"
+)
+
+var LogCmd = &cli.Command{
+	Name:  "log",
+	Usage: "Manage logging",
+	Subcommands: []*cli.Command{
+		LogList,
+		LogSetLevel,
+		LogAlerts,
+		LogTail,
+		LogJournal,
+	},
+}
+
+var LogList = &cli.Command{
+	Name:  "list",
+	Usage: "List log systems",
+	Action: func(cctx *cli.Context) error {
+		api, closer, err := GetAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := ReqContext(cctx)
+
+		systems, err := api.LogList(ctx)
+		if err != nil {
+			return err
+		}
+
+		t := NewTable("System")
+		t.Headless = true
+		for _, system := range systems {
+			t.Add(system)
+		}
+
+		return PrintResult(cctx, systems, t)
+	},
+}
+
+var LogSetLevel = &cli.Command{
+	Name:      "set-level",
+	Usage:     "Set log level",
+	ArgsUsage: "[level]",
+	Description: `Set the log level for logging systems:
+
+   The system flag can be specified multiple times.
+
+   eg) log set-level --system rpc --system peermgr debug
+
+   Available Levels:
+   debug
+   info
+   warn
+   error
+
+   Environment Variables:
+   GOLOG_LOG_LEVEL - Default log level for all log systems
+   GOLOG_LOG_FMT   - Change output log format (json, nocolor)
+   GOLOG_FILE      - Write logs to file
+   GOLOG_OUTPUT    - Specify whether to output to file, stderr, stdout or a combination, i.e. file+stderr
+`,
+	Flags: []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:  "system",
+			Usage: "limit to log system",
+			Value: &cli.StringSlice{},
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		api, closer, err := GetAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+		ctx := ReqContext(cctx)
+
+		if !cctx.Args().Present() {
+			return ShowHelp(cctx, xerrors.New("level is required"))
+		}
+
+		systems := cctx.StringSlice("system")
+		if len(systems) == 0 {
+			var err error
+			systems, err = api.LogList(ctx)
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, system := range systems {
+			if err := api.LogSetLevel(ctx, system, cctx.Args().First()); err != nil {
+				return xerrors.Errorf("setting log level on %s: %w", system, err)
+			}
+		}
+
+		return nil
+	},
+}
+
+var LogAlerts = &cli.Command{
+	Name:  "alerts",
+	Usage: "Get alert states",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "all",
+			Usage: "get all (active and inactive) alerts",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		api, closer, err := GetAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := ReqContext(cctx)
+
+		alerts, err := api.LogAlerts(ctx)
+		if err != nil {
+			return xerrors.Errorf("getting alerts: %w", err)
+		}
+
+		all := cctx.Bool("all")
+
+		t := NewTable("Alert", "State", "Since", "Message")
+		out := make([]alerting.Alert, 0, len(alerts))
+		for _, alert := range alerts {
+			if !all && !alert.Active {
+				continue
+			}
+			out = append(out, alert)
+
+			state, since, msg := "resolved", "-", ""
+			ev := alert.LastResolved
+			if alert.Active {
+				state, ev = "active", alert.LastActive
+			}
+			if ev != nil {
+				since, msg = ev.Time.Format(time.RFC3339), string(ev.Message)
+			}
+
+			t.Add(fmt.Sprintf("%s:%s", alert.Type.System, alert.Type.Subsystem), state, since, msg)
+		}
+
+		return PrintResult(cctx, out, t)
+	},
+}
+
+var LogJournal = &cli.Command{
+	Name:  "journal",
+	Usage: "Print recent system events from the node journal",
+	Flags: []cli.Flag{
+		&cli.IntFlag{
+			Name:    "lines",
+			Aliases: []string{"n"},
+			Usage:   "number of events to print",
+			Value:   20,
+		},
+		&cli.StringSliceFlag{
+			Name:  "type",
+			Usage: "only print events of this type, as system:event or system (can be repeated)",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		api, closer, err := GetAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := ReqContext(cctx)
+
+		evts, err := api.JournalRecent(ctx, cctx.Int("lines"), cctx.StringSlice("type"))
+		if err != nil {
+			return xerrors.Errorf("getting journal events: %w", err)
+		}
+
+		t := NewTable("Time", "Event", "Data")
+		for _, evt := range evts {
+			data, err := json.Marshal(evt.Data)
+			if err != nil {
+				return xerrors.Errorf("encoding event data: %w", err)
+			}
+			t.Add(evt.Timestamp.Format(time.RFC3339), evt.EventType.String(), string(data))
+		}
+
+		return PrintResult(cctx, evts, t)
+	},
+}
+
+var LogTail = &cli.Command{
+	Name:  "tail",
+	Usage: "Stream log messages from the node",
+	Description: `Streams log messages until interrupted. With --output json every message
+   is printed as a json object on its own line.
+
+   Only messages enabled on the node are streamed, use 'log set-level' to
+   enable debug messages.`,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "level",
+			Usage: "minimum level of streamed messages",
+			Value: "info",
+		},
+		&cli.StringSliceFlag{
+			Name:  "subsystem",
+			Usage: "limit to log system, can be specified multiple times",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		var printEntry func(api.LogEntry) error
+		switch format := cctx.String(FlagOutput.Name); format {
+		case OutputJSON:
+			enc := json.NewEncoder(cctx.App.Writer)
+			printEntry = func(ent api.LogEntry) error {
+				return enc.Encode(&ent)
+			}
+		case OutputTable, "":
+			printEntry = func(ent api.LogEntry) error {
+				_, err := fmt.Fprintln(cctx.App.Writer, formatLogEntry(ent))
+				return err
+			}
+		default:
+			return xerrors.Errorf("output format '%s' not supported when streaming logs", format)
+		}
+
+		napi, closer, err := GetAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		ctx := ReqContext(cctx)
+
+		entries, err := napi.LogStream(ctx, cctx.String("level"), cctx.StringSlice("subsystem"))
+		if err != nil {
+			return err
+		}
+
+		for ent := range entries {
+			if err := printEntry(ent); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	},
+}
+
+// formatLogEntry formats the entry like go-log's plaintext output.
+func formatLogEntry(ent api.LogEntry) string {
+	var sb strings.Builder
+	sb.WriteString(ent.Time.Format("2006-01-02T15:04:05.000Z0700"))
+	sb.WriteString("\t")
+	sb.WriteString(strings.ToUpper(ent.Level))
+	sb.WriteString("\t")
+	sb.WriteString(ent.System)
+	if ent.Caller != "" {
+		sb.WriteString("\t")
+		sb.WriteString(ent.Caller)
+	}
+	sb.WriteString("\t")
+	sb.WriteString(ent.Message)
+
+	if len(ent.Fields) > 0 {
+		keys := make([]string, 0, len(ent.Fields))
+		for k := range ent.Fields {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		sb.WriteString("\t")
+		for i, k := range keys {
+			if i > 0 {
+				sb.WriteString(" ")
+			}
+			fmt.Fprintf(&sb, "%s=%v", k, ent.Fields[k])
+		}
+	}
+
+	return sb.String()
+}
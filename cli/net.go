@@ -1,18 +1,21 @@
 package cli
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"os"
 	"sort"
 	"strings"
-	"text/tabwriter"
+	"sync"
 
 	"github.com/dustin/go-humanize"
 	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
 
+	"github.com/libp2p/go-libp2p-core/metrics"
 	"github.com/libp2p/go-libp2p-core/peer"
 	protocol "github.com/libp2p/go-libp2p-core/protocol"
+	ma "github.com/multiformats/go-multiaddr"
 
 	atypes "github.com/lyswifter/dbridge/api"
 	"github.com/lyswifter/dbridge/lib/addrutil"
@@ -34,6 +37,14 @@ var NetCmd = &cli.Command{
 	},
 }
 
+// netPeer is a connected peer, as printed by 'net peers'.
+type netPeer struct {
+	Node  string `json:",omitempty"`
+	ID    peer.ID
+	Addrs []ma.Multiaddr
+	Agent string `json:",omitempty"`
+}
+
 var NetPeers = &cli.Command{
 	Name:  "peers",
 	Usage: "Print peers",
@@ -48,63 +59,167 @@ var NetPeers = &cli.Command{
 			Aliases: []string{"x"},
 			Usage:   "Print extended peer information in json",
 		},
+		&cli.BoolFlag{
+			Name:  "all",
+			Usage: "Print the peers of all nodes in the node profiles file",
+		},
 	},
 	Action: func(cctx *cli.Context) error {
+		if cctx.Bool("all") {
+			if cctx.Bool("extended") {
+				return xerrors.Errorf("--extended can't be combined with --all")
+			}
+			return netPeersAll(cctx)
+		}
+
 		api, closer, err := GetAPI(cctx)
 		if err != nil {
 			return err
 		}
 		defer closer()
 		ctx := ReqContext(cctx)
-		peers, err := api.NetPeers(ctx)
+
+		if cctx.Bool("extended") {
+			infos, err := extendedPeers(ctx, api)
+			if err != nil {
+				return err
+			}
+
+			// one json object per line in table output
+			t := NewTable("Info")
+			t.Headless = true
+			for _, info := range infos {
+				b, err := json.Marshal(&info)
+				if err != nil {
+					return xerrors.Errorf("marshalling extended peer info: %w", err)
+				}
+				t.Add(string(b))
+			}
+
+			return PrintResult(cctx, infos, t)
+		}
+
+		peers, err := listPeers(ctx, api, "", cctx.Bool("agent"))
 		if err != nil {
 			return err
 		}
 
-		sort.Slice(peers, func(i, j int) bool {
-			return strings.Compare(string(peers[i].ID), string(peers[j].ID)) > 0
-		})
+		return PrintResult(cctx, peers, peersTable(peers, false, cctx.Bool("agent")))
+	},
+}
 
-		if cctx.Bool("extended") {
-			// deduplicate
-			seen := make(map[peer.ID]struct{})
+func netPeersAll(cctx *cli.Context) error {
+	ctx := ReqContext(cctx)
+	agents := cctx.Bool("agent")
 
-			for _, peer := range peers {
-				_, dup := seen[peer.ID]
-				if dup {
-					continue
-				}
-				seen[peer.ID] = struct{}{}
+	var lk sync.Mutex
+	peers := []netPeer{}
 
-				info, err := api.NetPeerInfo(ctx, peer.ID)
-				if err != nil {
-					log.Warnf("error getting extended peer info: %s", err)
-				} else {
-					bytes, err := json.Marshal(&info)
-					if err != nil {
-						log.Warnf("error marshalling extended peer info: %s", err)
-					} else {
-						fmt.Println(string(bytes))
-					}
-				}
-			}
-		} else {
-			for _, peer := range peers {
-				var agent string
-				if cctx.Bool("agent") {
-					agent, err = api.NetAgentVersion(ctx, peer.ID)
-					if err != nil {
-						log.Warnf("getting agent version: %s", err)
-					} else {
-						agent = ", " + agent
-					}
-				}
-				fmt.Printf("%s, %s%s\n", peer.ID, peer.Addrs, agent)
-			}
+	err := ForAllNodes(cctx, func(node string, api atypes.CommonNet) error {
+		np, err := listPeers(ctx, api, node, agents)
+		if err != nil {
+			return err
 		}
 
+		lk.Lock()
+		peers = append(peers, np...)
+		lk.Unlock()
 		return nil
-	},
+	})
+
+	// peers of each node are sorted already, the sort must be stable
+	sort.SliceStable(peers, func(i, j int) bool {
+		return peers[i].Node < peers[j].Node
+	})
+
+	if perr := PrintResult(cctx, peers, peersTable(peers, true, agents)); perr != nil {
+		return perr
+	}
+
+	return err
+}
+
+func listPeers(ctx context.Context, api atypes.CommonNet, node string, agents bool) ([]netPeer, error) {
+	peers, err := api.NetPeers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(peers, func(i, j int) bool {
+		return strings.Compare(string(peers[i].ID), string(peers[j].ID)) > 0
+	})
+
+	out := make([]netPeer, len(peers))
+	for i, p := range peers {
+		out[i] = netPeer{Node: node, ID: p.ID, Addrs: p.Addrs}
+		if agents {
+			out[i].Agent, err = api.NetAgentVersion(ctx, p.ID)
+			if err != nil {
+				log.Warnf("getting agent version: %s", err)
+			}
+		}
+	}
+
+	return out, nil
+}
+
+func peersTable(peers []netPeer, nodes, agents bool) *Table {
+	var cols []string
+	if nodes {
+		cols = append(cols, "Node")
+	}
+	cols = append(cols, "Peer", "Addrs")
+	if agents {
+		cols = append(cols, "Agent")
+	}
+
+	t := NewTable(cols...)
+	for _, p := range peers {
+		var row []interface{}
+		if nodes {
+			row = append(row, p.Node)
+		}
+		row = append(row, p.ID, p.Addrs)
+		if agents {
+			row = append(row, p.Agent)
+		}
+		t.Add(row...)
+	}
+
+	return t
+}
+
+func extendedPeers(ctx context.Context, api atypes.CommonNet) ([]atypes.ExtendedPeerInfo, error) {
+	peers, err := api.NetPeers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(peers, func(i, j int) bool {
+		return strings.Compare(string(peers[i].ID), string(peers[j].ID)) > 0
+	})
+
+	out := []atypes.ExtendedPeerInfo{}
+
+	// deduplicate
+	seen := make(map[peer.ID]struct{})
+
+	for _, peer := range peers {
+		_, dup := seen[peer.ID]
+		if dup {
+			continue
+		}
+		seen[peer.ID] = struct{}{}
+
+		info, err := api.NetPeerInfo(ctx, peer.ID)
+		if err != nil {
+			log.Warnf("error getting extended peer info: %s", err)
+			continue
+		}
+		out = append(out, *info)
+	}
+
+	return out, nil
 }
 
 var NetScores = &cli.Command{
@@ -130,20 +245,33 @@ var NetScores = &cli.Command{
 		}
 
 		if cctx.Bool("extended") {
-			enc := json.NewEncoder(os.Stdout)
+			// one json object per line in table output
+			t := NewTable("Score")
+			t.Headless = true
 			for _, peer := range scores {
-				err := enc.Encode(peer)
+				b, err := json.Marshal(peer)
 				if err != nil {
 					return err
 				}
+				t.Add(string(b))
 			}
-		} else {
-			for _, peer := range scores {
-				fmt.Printf("%s, %f\n", peer.ID, peer.Score.Score)
-			}
+
+			return PrintResult(cctx, scores, t)
 		}
 
-		return nil
+		type peerScore struct {
+			ID    peer.ID
+			Score float64
+		}
+
+		out := make([]peerScore, len(scores))
+		t := NewTable("Peer", "Score")
+		for i, peer := range scores {
+			out[i] = peerScore{ID: peer.ID, Score: peer.Score.Score}
+			t.Add(peer.ID, fmt.Sprintf("%f", peer.Score.Score))
+		}
+
+		return PrintResult(cctx, out, t)
 	},
 }
 
@@ -163,10 +291,15 @@ var NetListen = &cli.Command{
 			return err
 		}
 
-		for _, peer := range addrs.Addrs {
-			fmt.Printf("%s/p2p/%s\n", peer, addrs.ID)
+		out := make([]string, len(addrs.Addrs))
+		t := NewTable("Address")
+		t.Headless = true
+		for i, peer := range addrs.Addrs {
+			out[i] = fmt.Sprintf("%s/p2p/%s", peer, addrs.ID)
+			t.Add(out[i])
 		}
-		return nil
+
+		return PrintResult(cctx, out, t)
 	},
 }
 
@@ -187,17 +320,35 @@ var NetConnect = &cli.Command{
 			return err
 		}
 
+		type connectResult struct {
+			ID     peer.ID
+			Result string
+		}
+
+		out := []connectResult{}
+		t := NewTable("Peer", "Result")
+
+		// stop at the first failure, printing the results so far
 		for _, pi := range pis {
-			fmt.Printf("connect %s: ", pi.ID.Pretty())
-			err := api.NetConnect(ctx, pi)
+			err = api.NetConnect(ctx, pi)
+
+			res := "success"
 			if err != nil {
-				fmt.Println("failure")
-				return err
+				res = "failure"
+			}
+			out = append(out, connectResult{ID: pi.ID, Result: res})
+			t.Add(pi.ID.Pretty(), res)
+
+			if err != nil {
+				break
 			}
-			fmt.Println("success")
 		}
 
-		return nil
+		if perr := PrintResult(cctx, out, t); perr != nil {
+			return perr
+		}
+
+		return err
 	},
 }
 
@@ -218,8 +369,11 @@ var NetId = &cli.Command{
 			return err
 		}
 
-		fmt.Println(pid)
-		return nil
+		t := NewTable("ID")
+		t.Headless = true
+		t.Add(pid)
+
+		return PrintResult(cctx, pid, t)
 	},
 }
 
@@ -229,8 +383,7 @@ var NetFindPeer = &cli.Command{
 	ArgsUsage: "[peerId]",
 	Action: func(cctx *cli.Context) error {
 		if cctx.NArg() != 1 {
-			fmt.Println("Usage: findpeer [peer ID]")
-			return nil
+			return ShowHelp(cctx, xerrors.New("expected exactly one peer ID"))
 		}
 
 		pid, err := peer.Decode(cctx.Args().First())
@@ -252,8 +405,10 @@ var NetFindPeer = &cli.Command{
 			return err
 		}
 
-		fmt.Println(addrs)
-		return nil
+		t := NewTable("Peer", "Addrs")
+		t.Add(addrs.ID, addrs.Addrs)
+
+		return PrintResult(cctx, addrs, t)
 	},
 }
 
@@ -274,14 +429,28 @@ var NetReachability = &cli.Command{
 			return err
 		}
 
-		fmt.Println("AutoNAT status: ", i.Reachability.String())
-		if i.PublicAddr != "" {
-			fmt.Println("Public address: ", i.PublicAddr)
+		out := struct {
+			Reachability string
+			PublicAddr   string `json:",omitempty"`
+		}{
+			Reachability: i.Reachability.String(),
+			PublicAddr:   i.PublicAddr,
 		}
-		return nil
+
+		t := NewTable("AutoNAT status", "Public address")
+		t.Add(out.Reachability, out.PublicAddr)
+
+		return PrintResult(cctx, out, t)
 	},
 }
 
+// bandwidth is a row of 'net bandwidth' output.
+type bandwidth struct {
+	Node    string `json:",omitempty"`
+	Segment string
+	metrics.Stats
+}
+
 var NetBandwidthCmd = &cli.Command{
 	Name:  "bandwidth",
 	Usage: "Print bandwidth usage information",
@@ -294,77 +463,133 @@ var NetBandwidthCmd = &cli.Command{
 			Name:  "by-protocol",
 			Usage: "list bandwidth usage by protocol",
 		},
+		&cli.BoolFlag{
+			Name:  "all",
+			Usage: "list bandwidth usage of all nodes in the node profiles file",
+		},
 	},
 	Action: func(cctx *cli.Context) error {
+		ctx := ReqContext(cctx)
+
+		bypeer := cctx.Bool("by-peer")
+		byproto := cctx.Bool("by-protocol")
+
+		if cctx.Bool("all") {
+			var lk sync.Mutex
+			rows := []bandwidth{}
+
+			err := ForAllNodes(cctx, func(node string, api atypes.CommonNet) error {
+				out, err := bandwidthRows(ctx, api, node, bypeer, byproto)
+				if err != nil {
+					return err
+				}
+
+				lk.Lock()
+				rows = append(rows, out...)
+				lk.Unlock()
+				return nil
+			})
+
+			// rows of each node are sorted already, the sort must be stable
+			sort.SliceStable(rows, func(i, j int) bool {
+				return rows[i].Node < rows[j].Node
+			})
+
+			if perr := PrintResult(cctx, rows, bandwidthTable(rows, true)); perr != nil {
+				return perr
+			}
+
+			return err
+		}
+
 		api, closer, err := GetAPI(cctx)
 		if err != nil {
 			return err
 		}
 		defer closer()
 
-		ctx := ReqContext(cctx)
+		rows, err := bandwidthRows(ctx, api, "", bypeer, byproto)
+		if err != nil {
+			return err
+		}
 
-		bypeer := cctx.Bool("by-peer")
-		byproto := cctx.Bool("by-protocol")
+		return PrintResult(cctx, rows, bandwidthTable(rows, false))
+	},
+}
 
-		tw := tabwriter.NewWriter(os.Stdout, 4, 4, 2, ' ', 0)
+// bandwidthRows returns the bandwidth usage of the node, in the order it is
+// printed in.
+func bandwidthRows(ctx context.Context, api atypes.CommonNet, node string, bypeer, byproto bool) ([]bandwidth, error) {
+	rows := []bandwidth{}
 
-		fmt.Fprintf(tw, "Segment\tTotalIn\tTotalOut\tRateIn\tRateOut\n")
+	if bypeer {
+		bw, err := api.NetBandwidthStatsByPeer(ctx)
+		if err != nil {
+			return nil, err
+		}
 
-		if bypeer {
-			bw, err := api.NetBandwidthStatsByPeer(ctx)
-			if err != nil {
-				return err
-			}
+		var peers []string
+		for p := range bw {
+			peers = append(peers, p)
+		}
 
-			var peers []string
-			for p := range bw {
-				peers = append(peers, p)
-			}
+		sort.Slice(peers, func(i, j int) bool {
+			return peers[i] < peers[j]
+		})
 
-			sort.Slice(peers, func(i, j int) bool {
-				return peers[i] < peers[j]
-			})
+		for _, p := range peers {
+			rows = append(rows, bandwidth{Node: node, Segment: p, Stats: bw[p]})
+		}
+	} else if byproto {
+		bw, err := api.NetBandwidthStatsByProtocol(ctx)
+		if err != nil {
+			return nil, err
+		}
 
-			for _, p := range peers {
-				s := bw[p]
-				fmt.Fprintf(tw, "%s\t%s\t%s\t%s/s\t%s/s\n", p, humanize.Bytes(uint64(s.TotalIn)), humanize.Bytes(uint64(s.TotalOut)), humanize.Bytes(uint64(s.RateIn)), humanize.Bytes(uint64(s.RateOut)))
-			}
-		} else if byproto {
-			bw, err := api.NetBandwidthStatsByProtocol(ctx)
-			if err != nil {
-				return err
-			}
+		var protos []protocol.ID
+		for p := range bw {
+			protos = append(protos, p)
+		}
+
+		sort.Slice(protos, func(i, j int) bool {
+			return protos[i] < protos[j]
+		})
 
-			var protos []protocol.ID
-			for p := range bw {
-				protos = append(protos, p)
+		for _, p := range protos {
+			s := bw[p]
+			if p == "" {
+				p = "<unknown>"
 			}
+			rows = append(rows, bandwidth{Node: node, Segment: string(p), Stats: s})
+		}
+	} else {
+		s, err := api.NetBandwidthStats(ctx)
+		if err != nil {
+			return nil, err
+		}
 
-			sort.Slice(protos, func(i, j int) bool {
-				return protos[i] < protos[j]
-			})
+		rows = append(rows, bandwidth{Node: node, Segment: "Total", Stats: s})
+	}
 
-			for _, p := range protos {
-				s := bw[p]
-				if p == "" {
-					p = "<unknown>"
-				}
-				fmt.Fprintf(tw, "%s\t%s\t%s\t%s/s\t%s/s\n", p, humanize.Bytes(uint64(s.TotalIn)), humanize.Bytes(uint64(s.TotalOut)), humanize.Bytes(uint64(s.RateIn)), humanize.Bytes(uint64(s.RateOut)))
-			}
-		} else {
+	return rows, nil
+}
 
-			s, err := api.NetBandwidthStats(ctx)
-			if err != nil {
-				return err
-			}
+func bandwidthTable(rows []bandwidth, nodes bool) *Table {
+	cols := []string{"Segment", "TotalIn", "TotalOut", "RateIn", "RateOut"}
+	if nodes {
+		cols = append([]string{"Node"}, cols...)
+	}
 
-			fmt.Fprintf(tw, "Total\t%s\t%s\t%s/s\t%s/s\n", humanize.Bytes(uint64(s.TotalIn)), humanize.Bytes(uint64(s.TotalOut)), humanize.Bytes(uint64(s.RateIn)), humanize.Bytes(uint64(s.RateOut)))
+	t := NewTable(cols...)
+	for _, r := range rows {
+		row := []interface{}{r.Segment, humanize.Bytes(uint64(r.TotalIn)), humanize.Bytes(uint64(r.TotalOut)), humanize.Bytes(uint64(r.RateIn)) + "/s", humanize.Bytes(uint64(r.RateOut)) + "/s"}
+		if nodes {
+			row = append([]interface{}{r.Node}, row...)
 		}
+		t.Add(row...)
+	}
 
-		return tw.Flush()
-
-	},
+	return t
 }
 
 var NetBlockCmd = &cli.Command{
@@ -529,39 +754,23 @@ var NetBlockListCmd = &cli.Command{
 			return err
 		}
 
-		if len(acl.Peers) != 0 {
-			sort.Slice(acl.Peers, func(i, j int) bool {
-				return strings.Compare(string(acl.Peers[i]), string(acl.Peers[j])) > 0
-			})
+		sort.Slice(acl.Peers, func(i, j int) bool {
+			return strings.Compare(string(acl.Peers[i]), string(acl.Peers[j])) > 0
+		})
+		sort.Strings(acl.IPAddrs)
+		sort.Strings(acl.IPSubnets)
 
-			fmt.Println("Blocked Peers:")
-			for _, p := range acl.Peers {
-				fmt.Printf("\t%s\n", p)
-			}
+		t := NewTable("Type", "Value")
+		for _, p := range acl.Peers {
+			t.Add("peer", p)
 		}
-
-		if len(acl.IPAddrs) != 0 {
-			sort.Slice(acl.IPAddrs, func(i, j int) bool {
-				return strings.Compare(acl.IPAddrs[i], acl.IPAddrs[j]) < 0
-			})
-
-			fmt.Println("Blocked IPs:")
-			for _, a := range acl.IPAddrs {
-				fmt.Printf("\t%s\n", a)
-			}
+		for _, a := range acl.IPAddrs {
+			t.Add("ip", a)
 		}
-
-		if len(acl.IPSubnets) != 0 {
-			sort.Slice(acl.IPSubnets, func(i, j int) bool {
-				return strings.Compare(acl.IPSubnets[i], acl.IPSubnets[j]) < 0
-			})
-
-			fmt.Println("Blocked Subnets:")
-			for _, n := range acl.IPSubnets {
-				fmt.Printf("\t%s\n", n)
-			}
+		for _, n := range acl.IPSubnets {
+			t.Add("subnet", n)
 		}
 
-		return nil
+		return PrintResult(cctx, acl, t)
 	},
 }
@@ -63,9 +63,10 @@ func EnvsForAPIInfos(t repo.RepoType) (primary string, fallbacks []string, depre
 // The order of precedence is as follows:
 //
 //  1. *-api-url command line flags.
-//  2. *_API_INFO environment variables
-//  3. deprecated *_API_INFO environment variables
-//  4. *-repo command line flags.
+//  2. --node command line flag (or DBRIDGE_NODE), selecting a node profile
+//  3. *_API_INFO environment variables
+//  4. deprecated *_API_INFO environment variables
+//  5. *-repo command line flags.
 func GetAPIInfo(ctx *cli.Context, t repo.RepoType) (APIInfo, error) {
 	// Check if there was a flag passed with the listen address of the API
 	// server (only used by the tests)
@@ -80,6 +81,16 @@ func GetAPIInfo(ctx *cli.Context, t repo.RepoType) (APIInfo, error) {
 		return APIInfo{Addr: strma}, nil
 	}
 
+	// A node profile selected on the command line takes precedence over the
+	// environment and the local repo.
+	if name := ctx.String(FlagNode.Name); name != "" {
+		p, err := getProfile(ctx, name)
+		if err != nil {
+			return APIInfo{}, err
+		}
+		return p.APIInfo(), nil
+	}
+
 	//
 	// Note: it is not correct/intuitive to prefer environment variables over
 	// CLI flags (repo flags below).
@@ -157,11 +168,21 @@ func GetRawAPI(ctx *cli.Context, t repo.RepoType, version string) (string, http.
 		return "", nil, xerrors.Errorf("could not get API info for %s: %w", t, err)
 	}
 
+	return dialArgs(ctx, ainfo, version)
+}
+
+// dialArgs returns the endpoint URL and headers for connecting to the API
+// described by ainfo, and sets up the websocket dialer for it.
+func dialArgs(ctx *cli.Context, ainfo APIInfo, version string) (string, http.Header, error) {
 	addr, err := ainfo.DialArgs(version)
 	if err != nil {
 		return "", nil, xerrors.Errorf("could not get DialArgs: %w", err)
 	}
 
+	if addr, err = setupDialer(ctx, ainfo, addr); err != nil {
+		return "", nil, err
+	}
+
 	if IsVeryVerbose {
 		_, _ = fmt.Fprintf(ctx.App.Writer, "using raw API %s endpoint: %s\n", version, addr)
 	}
@@ -36,15 +36,26 @@ func ParseApiInfo(s string) APIInfo {
 	}
 }
 
+// DialArgs returns the URL of the API endpoint. For unix socket endpoints the
+// URL host is 'unix', and the client must dial the path from SocketPath.
 func (a APIInfo) DialArgs(version string) (string, error) {
 	ma, err := multiaddr.NewMultiaddr(a.Addr)
 	if err == nil {
+		if _, ok := socketPath(ma); ok {
+			return "ws://unix/rpc/" + version, nil
+		}
+
 		_, addr, err := manet.DialArgs(ma)
 		if err != nil {
 			return "", err
 		}
 
-		return "ws://" + addr + "/rpc/" + version, nil
+		scheme := "ws://"
+		if isTLS(ma) {
+			scheme = "wss://"
+		}
+
+		return scheme + addr + "/rpc/" + version, nil
 	}
 
 	_, err = url.Parse(a.Addr)
@@ -54,9 +65,46 @@ func (a APIInfo) DialArgs(version string) (string, error) {
 	return a.Addr + "/rpc/" + version, nil
 }
 
+// SocketPath returns the path of the unix socket the API is served on, if the
+// API address is a /unix multiaddr.
+func (a APIInfo) SocketPath() (string, bool) {
+	ma, err := multiaddr.NewMultiaddr(a.Addr)
+	if err != nil {
+		return "", false
+	}
+	return socketPath(ma)
+}
+
+func socketPath(ma multiaddr.Multiaddr) (string, bool) {
+	path, err := ma.ValueForProtocol(multiaddr.P_UNIX)
+	if err != nil {
+		return "", false
+	}
+	return path, true
+}
+
+// isTLS returns true for API multiaddrs which are served over TLS, like
+// /ip4/1.2.3.4/tcp/1235/https.
+func isTLS(ma multiaddr.Multiaddr) bool {
+	tls := false
+	multiaddr.ForEach(ma, func(c multiaddr.Component) bool {
+		switch c.Protocol().Code {
+		case multiaddr.P_HTTPS, multiaddr.P_TLS, multiaddr.P_WSS:
+			tls = true
+			return false
+		}
+		return true
+	})
+	return tls
+}
+
 func (a APIInfo) Host() (string, error) {
 	ma, err := multiaddr.NewMultiaddr(a.Addr)
 	if err == nil {
+		if path, ok := socketPath(ma); ok {
+			return path, nil
+		}
+
 		_, addr, err := manet.DialArgs(ma)
 		if err != nil {
 			return "", err
@@ -78,6 +126,9 @@ func (a APIInfo) AuthHeader() http.Header {
 		headers.Add("Authorization", "Bearer "+string(a.Token))
 		return headers
 	}
-	log.Warn("API Token not set and requested, capabilities might be limited.")
+	if _, ok := a.SocketPath(); !ok {
+		// the node grants full access to local socket connections
+		log.Warn("API Token not set and requested, capabilities might be limited.")
+	}
 	return nil
 }
@@ -0,0 +1,148 @@
+package cliutil
+
+import (
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/BurntSushi/toml"
+	"github.com/filecoin-project/go-jsonrpc"
+	"github.com/mitchellh/go-homedir"
+	"github.com/urfave/cli/v2"
+	"go.uber.org/multierr"
+	"golang.org/x/xerrors"
+
+	"github.com/lyswifter/dbridge/api"
+	"github.com/lyswifter/dbridge/api/client"
+)
+
+// Node profile settings, they should be included as flags on the top-level
+// command.
+var (
+	FlagNode = &cli.StringFlag{
+		Name:    "node",
+		EnvVars: []string{"DBRIDGE_NODE"},
+		Usage:   "name of the node profile to connect to",
+	}
+	FlagNodesFile = &cli.StringFlag{
+		Name:    "nodes-file",
+		EnvVars: []string{"DBRIDGE_NODES_FILE"},
+		Value:   "~/.dbridge/nodes.toml",
+		Usage:   "file with the node profiles",
+	}
+)
+
+// NodeProfile describes how to connect to a node. The profiles file is a TOML
+// file with a table for each node:
+//
+//	[alpha]
+//	API = "/ip4/10.0.0.1/tcp/1234/http"
+//	Token = "eyJhbGciOiJIUzI1NiIsInR5cCI6IkpXVCJ9..."
+//
+// API may also be in the TOKEN:ADDR format of the *_API_INFO variables.
+type NodeProfile struct {
+	API   string
+	Token string
+}
+
+func (p NodeProfile) APIInfo() APIInfo {
+	ai := ParseApiInfo(p.API)
+	if p.Token != "" {
+		ai.Token = []byte(p.Token)
+	}
+	return ai
+}
+
+// LoadProfiles reads the node profiles from the file at path.
+func LoadProfiles(path string) (map[string]NodeProfile, error) {
+	path, err := homedir.Expand(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		return nil, xerrors.Errorf("opening node profiles: %w", err)
+	}
+
+	profiles := map[string]NodeProfile{}
+	if _, err := toml.DecodeFile(path, &profiles); err != nil {
+		return nil, xerrors.Errorf("decoding node profiles %s: %w", path, err)
+	}
+
+	for name, p := range profiles {
+		if p.API == "" {
+			return nil, xerrors.Errorf("node profile '%s' has no API address", name)
+		}
+	}
+
+	return profiles, nil
+}
+
+func getProfile(ctx *cli.Context, name string) (NodeProfile, error) {
+	profiles, err := LoadProfiles(ctx.String(FlagNodesFile.Name))
+	if err != nil {
+		return NodeProfile{}, err
+	}
+
+	p, ok := profiles[name]
+	if !ok {
+		return NodeProfile{}, xerrors.Errorf("node profile '%s' not found", name)
+	}
+	return p, nil
+}
+
+// ForAllNodes connects to every node in the profiles file concurrently, and
+// calls cb with each connection. Errors are collected so that a failing node
+// doesn't prevent reaching the others.
+func ForAllNodes(ctx *cli.Context, cb func(name string, api api.CommonNet) error) error {
+	profiles, err := LoadProfiles(ctx.String(FlagNodesFile.Name))
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var (
+		lk   sync.Mutex
+		errs error
+		wg   sync.WaitGroup
+	)
+
+	for _, name := range names {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+
+			err := func() error {
+				napi, closer, err := dialNode(ctx, profiles[name])
+				if err != nil {
+					return err
+				}
+				defer closer()
+
+				return cb(name, napi)
+			}()
+			if err != nil {
+				lk.Lock()
+				errs = multierr.Append(errs, xerrors.Errorf("node %s: %w", name, err))
+				lk.Unlock()
+			}
+		}(name)
+	}
+
+	wg.Wait()
+	return errs
+}
+
+func dialNode(ctx *cli.Context, p NodeProfile) (api.CommonNet, jsonrpc.ClientCloser, error) {
+	addr, headers, err := dialArgs(ctx, p.APIInfo(), "v0")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return client.NewCommonRPCV0(ctx.Context, addr, headers)
+}
@@ -0,0 +1,135 @@
+package cliutil
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/lyswifter/dbridge/lib/tlsutil"
+)
+
+// TLS settings used when connecting to a remote API listener. They should be
+// included as flags on the top-level command.
+var (
+	FlagAPITLSCA = &cli.StringFlag{
+		Name:    "api-tls-ca",
+		EnvVars: []string{"DBRIDGE_API_TLS_CA"},
+		Usage:   "PEM certificate used to verify a remote API server, e.g. its self-signed certificate",
+	}
+	FlagAPITLSCert = &cli.StringFlag{
+		Name:    "api-tls-cert",
+		EnvVars: []string{"DBRIDGE_API_TLS_CERT"},
+		Usage:   "client certificate presented to a remote API server",
+	}
+	FlagAPITLSKey = &cli.StringFlag{
+		Name:    "api-tls-key",
+		EnvVars: []string{"DBRIDGE_API_TLS_KEY"},
+		Usage:   "private key of the client certificate presented to a remote API server",
+	}
+)
+
+// go-jsonrpc dials every websocket client, and re-dials it when reconnecting,
+// through websocket.DefaultDialer, and takes no dialer option. So instead of
+// pointing DefaultDialer at the endpoint being connected to, which breaks the
+// reconnects of clients of other endpoints, it's set once to a dialer which
+// routes each connection to the dialer of its endpoint, by the URL host.
+var (
+	routeOnce sync.Once
+	routeErr  error
+
+	routesLk sync.Mutex
+	routes   = map[string]*websocket.Dialer{}
+	// unixHosts are the URL hosts assigned to unix socket paths
+	unixHosts = map[string]string{}
+)
+
+// setupDialer makes the websocket dialer of the RPC client connect to the
+// API described by ainfo, and returns the URL to connect to, which for unix
+// sockets has a host assigned to the socket path.
+func setupDialer(ctx *cli.Context, ainfo APIInfo, addr string) (string, error) {
+	routeOnce.Do(func() {
+		// the TLS settings are process wide, so they're loaded once for all
+		// wss endpoints, and only fail connecting to those
+		var cfg *tls.Config
+		cfg, routeErr = apiTLSConfig(ctx)
+
+		websocket.DefaultDialer = &websocket.Dialer{
+			Proxy:            routeProxy,
+			NetDialContext:   routeDial,
+			HandshakeTimeout: 45 * time.Second,
+			TLSClientConfig:  cfg,
+		}
+	})
+	if routeErr != nil && strings.HasPrefix(addr, "wss://") {
+		return "", routeErr
+	}
+
+	path, ok := ainfo.SocketPath()
+	if !ok {
+		return addr, nil
+	}
+
+	routesLk.Lock()
+	defer routesLk.Unlock()
+
+	host, ok := unixHosts[path]
+	if !ok {
+		host = fmt.Sprintf("unix-%d", len(unixHosts))
+		unixHosts[path] = host
+		routes[host+":80"] = &websocket.Dialer{
+			NetDialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", path)
+			},
+		}
+	}
+
+	return strings.Replace(addr, "ws://unix/", "ws://"+host+"/", 1), nil
+}
+
+func apiTLSConfig(ctx *cli.Context) (*tls.Config, error) {
+	cfg, err := tlsutil.ClientConfig(
+		ctx.String(FlagAPITLSCA.Name),
+		ctx.String(FlagAPITLSCert.Name),
+		ctx.String(FlagAPITLSKey.Name))
+	if err != nil {
+		return nil, xerrors.Errorf("loading API TLS settings: %w", err)
+	}
+	return cfg, nil
+}
+
+func route(hostPort string) *websocket.Dialer {
+	routesLk.Lock()
+	defer routesLk.Unlock()
+	return routes[hostPort]
+}
+
+func routeDial(ctx context.Context, network, addr string) (net.Conn, error) {
+	if d := route(addr); d != nil {
+		return d.NetDialContext(ctx, network, addr)
+	}
+
+	var d net.Dialer
+	return d.DialContext(ctx, network, addr)
+}
+
+func routeProxy(r *http.Request) (*url.URL, error) {
+	hostPort := r.URL.Host
+	if r.URL.Port() == "" {
+		hostPort += ":80"
+	}
+	if route(hostPort) != nil {
+		return nil, nil
+	}
+	return http.ProxyFromEnvironment(r)
+}
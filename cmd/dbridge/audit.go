@@ -0,0 +1,142 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+
+	lcli "github.com/lyswifter/dbridge/cli"
+	"github.com/lyswifter/dbridge/lib/audit"
+	"github.com/mitchellh/go-homedir"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+)
+
+// auditDir is the directory in the repo holding the API audit log.
+const auditDir = "audit"
+
+var auditCmd = &cli.Command{
+	Name:  "audit",
+	Usage: "Inspect the API audit log",
+	Subcommands: []*cli.Command{
+		auditTailCmd,
+		auditSearchCmd,
+	},
+}
+
+var auditTailCmd = &cli.Command{
+	Name:  "tail",
+	Usage: "Print the most recent audit records",
+	Flags: []cli.Flag{
+		&cli.IntFlag{
+			Name:    "lines",
+			Aliases: []string{"n"},
+			Usage:   "number of records to print",
+			Value:   20,
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		n := cctx.Int("lines")
+		if n <= 0 {
+			return xerrors.Errorf("number of records must be positive")
+		}
+
+		recs := []audit.Record{}
+		err := readAudit(cctx, func(r audit.Record) error {
+			recs = append(recs, r)
+			if len(recs) > n {
+				recs = recs[1:]
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		return printAudit(cctx, recs)
+	},
+}
+
+var auditSearchCmd = &cli.Command{
+	Name:  "search",
+	Usage: "Print audit records matching the given filters",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:  "method",
+			Usage: "only print calls to this method",
+		},
+		&cli.StringFlag{
+			Name:  "token",
+			Usage: "only print calls made with the token with this ID or label",
+		},
+		&cli.TimestampFlag{
+			Name:   "since",
+			Usage:  "only print calls made at or after this time",
+			Layout: time.RFC3339,
+		},
+		&cli.TimestampFlag{
+			Name:   "until",
+			Usage:  "only print calls made before this time",
+			Layout: time.RFC3339,
+		},
+		&cli.BoolFlag{
+			Name:  "errors",
+			Usage: "only print calls which returned an error",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		method := cctx.String("method")
+		token := cctx.String("token")
+		since := cctx.Timestamp("since")
+		until := cctx.Timestamp("until")
+		errs := cctx.Bool("errors")
+
+		recs := []audit.Record{}
+		err := readAudit(cctx, func(r audit.Record) error {
+			switch {
+			case method != "" && !strings.EqualFold(r.Method, method):
+			case token != "" && r.TokenID != token && r.Label != token:
+			case since != nil && r.Time.Before(*since):
+			case until != nil && !r.Time.Before(*until):
+			case errs && r.Error == "":
+			default:
+				recs = append(recs, r)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		return printAudit(cctx, recs)
+	},
+}
+
+func readAudit(cctx *cli.Context, cb func(audit.Record) error) error {
+	repoPath, err := homedir.Expand(cctx.String(FlagDbridgeRepo))
+	if err != nil {
+		return err
+	}
+
+	return audit.Read(filepath.Join(repoPath, auditDir), cb)
+}
+
+func printAudit(cctx *cli.Context, recs []audit.Record) error {
+	t := lcli.NewTable("Time", "Method", "Token", "Remote", "Error")
+
+	for _, r := range recs {
+		token := r.TokenID
+		switch {
+		case r.Label != "":
+			token = r.Label
+		case r.CertName != "":
+			token = "cert:" + r.CertName
+		case token == "":
+			token = "-"
+		}
+
+		t.Add(r.Time.Format(time.RFC3339), r.Method, token, r.Remote, r.Error)
+	}
+
+	return lcli.PrintResult(cctx, recs, t)
+}
@@ -1 +1,403 @@
 package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/mitchellh/go-homedir"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	lcli "github.com/lyswifter/dbridge/cli"
+	"github.com/lyswifter/dbridge/node/config"
+	"github.com/lyswifter/dbridge/node/repo"
+)
+
+var configCmd = &cli.Command{
+	Name:  "config",
+	Usage: "Manage the node config",
+	Description: `Config values are taken from, in order of precedence: flags of 'dbridge run',
+   DBRIDGE_ environment variables, the config file in the repo, and the
+   defaults. 'dbridge config default' lists the environment variable of each
+   field. LOTUS_ environment variables are still read when the DBRIDGE_ one
+   isn't set, but are deprecated; set DBRIDGE_LEGACY_ENV=0 to ignore them.`,
+	Subcommands: []*cli.Command{
+		configDefaultCmd,
+		configShowCmd,
+		configDiffCmd,
+		configEditCmd,
+		configValidateCmd,
+		configReloadCmd,
+	},
+}
+
+var configDefaultCmd = &cli.Command{
+	Name:  "default",
+	Usage: "Print the default config, with documentation for each field",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "no-comment",
+			Usage: "don't include comments in the output",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		c := config.DefaultDbridgeNode()
+
+		cb, err := config.ConfigUpdate(c, nil, !cctx.Bool("no-comment"))
+		if err != nil {
+			return err
+		}
+
+		fmt.Print(string(cb))
+		return nil
+	},
+}
+
+var configShowCmd = &cli.Command{
+	Name:  "show",
+	Usage: "Print the config of the node repo, including environment overrides",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "commented",
+			Usage: "document each field, and comment out fields set to their default value",
+		},
+		&cli.BoolFlag{
+			Name:  "effective",
+			Usage: "list the value of each field along with where it came from; environment variables are read from this shell",
+		},
+		&cli.StringFlag{
+			Name:  "api",
+			Usage: "the --api flag 'dbridge run' is started with, for --effective",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		if cctx.Bool("effective") {
+			return showEffectiveConfig(cctx)
+		}
+
+		_, cfg, err := readRepoConfig(cctx)
+		if err != nil {
+			return err
+		}
+
+		var def interface{}
+		if cctx.Bool("commented") {
+			def = config.DefaultDbridgeNode()
+		}
+
+		cb, err := config.ConfigUpdate(cfg, def, cctx.Bool("commented"))
+		if err != nil {
+			return err
+		}
+
+		fmt.Print(string(cb))
+		return nil
+	},
+}
+
+var configDiffCmd = &cli.Command{
+	Name:  "diff",
+	Usage: "Print the config fields which differ from their default value",
+	Action: func(cctx *cli.Context) error {
+		_, cfg, err := readRepoConfig(cctx)
+		if err != nil {
+			return err
+		}
+		def := config.DefaultDbridgeNode()
+
+		type fieldDiff struct {
+			Field   string
+			Default json.RawMessage
+			Value   json.RawMessage
+		}
+
+		out := []fieldDiff{}
+		t := lcli.NewTable("Field", "Default", "Value")
+		for _, f := range config.Diff(def, cfg) {
+			d, err := fieldJSON(def, f)
+			if err != nil {
+				return err
+			}
+			v, err := fieldJSON(cfg, f)
+			if err != nil {
+				return err
+			}
+
+			out = append(out, fieldDiff{Field: f, Default: d, Value: v})
+			t.Add(f, string(d), string(v))
+		}
+
+		return lcli.PrintResult(cctx, out, t)
+	},
+}
+
+var configEditCmd = &cli.Command{
+	Name:  "edit",
+	Usage: "Edit the config of the node repo in $EDITOR",
+	Description: `The config is opened in a copy, and only saved once it's valid. Changes
+   take effect when the node is restarted; settings which can be changed on a
+   running node are applied by 'dbridge config reload'.`,
+	Action: func(cctx *cli.Context) error {
+		path, _, err := readRepoConfig(cctx)
+		if err != nil {
+			return err
+		}
+
+		cur, err := ioutil.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			return xerrors.Errorf("reading config: %w", err)
+		}
+
+		tmp, err := ioutil.TempFile(filepath.Dir(path), ".config-edit-*.toml")
+		if err != nil {
+			return xerrors.Errorf("creating temporary config: %w", err)
+		}
+		defer os.Remove(tmp.Name()) //nolint:errcheck
+
+		if _, err := tmp.Write(cur); err != nil {
+			_ = tmp.Close()
+			return err
+		}
+		if err := tmp.Close(); err != nil {
+			return err
+		}
+
+		editor := os.Getenv("VISUAL")
+		if editor == "" {
+			editor = os.Getenv("EDITOR")
+		}
+		if editor == "" {
+			editor = "vi"
+		}
+
+		in := bufio.NewReader(os.Stdin)
+		for {
+			// the editor may be given with arguments, e.g. "code --wait"
+			args := append(strings.Fields(editor), tmp.Name())
+			cmd := exec.Command(args[0], args[1:]...)
+			cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+			if err := cmd.Run(); err != nil {
+				return xerrors.Errorf("running editor: %w", err)
+			}
+
+			edited, err := ioutil.ReadFile(tmp.Name())
+			if err != nil {
+				return err
+			}
+			if bytes.Equal(edited, cur) {
+				fmt.Println("config unchanged")
+				return nil
+			}
+
+			err = validateConfigFile(tmp.Name())
+			if err == nil {
+				if err := ioutil.WriteFile(path, edited, 0644); err != nil {
+					return xerrors.Errorf("writing config: %w", err)
+				}
+				fmt.Printf("saved %s\n", path)
+				return nil
+			}
+
+			fmt.Printf("invalid config:\n%s\n", err)
+			fmt.Print("edit again? [Y/n] ")
+			answer, _ := in.ReadString('\n')
+			if a := strings.ToLower(strings.TrimSpace(answer)); a != "" && a != "y" && a != "yes" {
+				return xerrors.New("config not saved")
+			}
+		}
+	},
+}
+
+var configValidateCmd = &cli.Command{
+	Name:      "validate",
+	Usage:     "Check a config file for errors",
+	ArgsUsage: "[config file, defaults to the config of the node repo]",
+	Action: func(cctx *cli.Context) error {
+		path := cctx.Args().First()
+		if path == "" {
+			p, err := repoConfigPath(cctx)
+			if err != nil {
+				return err
+			}
+			path = p
+		}
+
+		if err := validateConfigFile(path); err != nil {
+			return xerrors.Errorf("%s:\n%w", path, err)
+		}
+
+		fmt.Printf("%s is valid\n", path)
+		return nil
+	},
+}
+
+var configReloadCmd = &cli.Command{
+	Name:  "reload",
+	Usage: "Apply config changes to the running node",
+	Description: `Settings which can't be changed while the node is running are listed,
+   and take effect when the node is restarted.`,
+	Action: func(cctx *cli.Context) error {
+		napi, closer, err := lcli.GetAPI(cctx)
+		if err != nil {
+			return err
+		}
+		defer closer()
+
+		changes, err := napi.ConfigReload(lcli.ReqContext(cctx))
+		if err != nil {
+			return err
+		}
+
+		t := lcli.NewTable("Field", "State", "Note")
+		for _, c := range changes {
+			state := "restart required"
+			if c.Applied {
+				state = "applied"
+			}
+			t.Add(c.Field, state, c.Note)
+		}
+
+		return lcli.PrintResult(cctx, changes, t)
+	},
+}
+
+func showEffectiveConfig(cctx *cli.Context) error {
+	path, err := repoConfigPath(cctx)
+	if err != nil {
+		return err
+	}
+
+	c, sources, err := config.FromFileWithSources(path, config.DefaultDbridgeNode())
+	if err != nil {
+		return xerrors.Errorf("loading config %s: %w", path, err)
+	}
+	cfg := c.(*config.BdridgeNode)
+
+	if cctx.IsSet("api") {
+		cfg.API.ListenAddress = apiFlagAddress(cctx)
+		sources["API.ListenAddress"] = config.Source{Origin: config.OriginFlag, Name: "--api"}
+	}
+
+	type effectiveField struct {
+		Field  string
+		Value  json.RawMessage
+		Source config.Source
+	}
+
+	fields := make([]string, 0, len(sources))
+	for f := range sources {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+
+	out := make([]effectiveField, 0, len(fields))
+	t := lcli.NewTable("Field", "Value", "Source")
+	for _, f := range fields {
+		v, err := fieldJSON(cfg, f)
+		if err != nil {
+			return err
+		}
+
+		src := sources[f]
+		desc := string(src.Origin)
+		if src.Name != "" {
+			desc += " " + src.Name
+		}
+		if src.Deprecated {
+			desc += " (deprecated)"
+		}
+
+		out = append(out, effectiveField{Field: f, Value: v, Source: src})
+		t.Add(f, string(v), desc)
+	}
+
+	return lcli.PrintResult(cctx, out, t)
+}
+
+// apiFlagAddress returns the API listen address set by the --api flag, which
+// takes the port to listen on.
+func apiFlagAddress(cctx *cli.Context) string {
+	return "/ip4/127.0.0.1/tcp/" + cctx.String("api")
+}
+
+func repoConfigPath(cctx *cli.Context) (string, error) {
+	repoPath, err := homedir.Expand(cctx.String(FlagDbridgeRepo))
+	if err != nil {
+		return "", err
+	}
+
+	r, err := repo.NewFS(repoPath)
+	if err != nil {
+		return "", err
+	}
+	return r.ConfigPath(), nil
+}
+
+// readRepoConfig reads the config of the node repo. The repo isn't locked,
+// so that the config can be read while the node is running.
+func readRepoConfig(cctx *cli.Context) (string, *config.BdridgeNode, error) {
+	path, err := repoConfigPath(cctx)
+	if err != nil {
+		return "", nil, err
+	}
+
+	c, err := config.FromFile(path, config.DefaultDbridgeNode())
+	if err != nil {
+		return "", nil, xerrors.Errorf("loading config %s: %w", path, err)
+	}
+
+	cfg, ok := c.(*config.BdridgeNode)
+	if !ok {
+		return "", nil, xerrors.Errorf("invalid config, got: %T", c)
+	}
+	return path, cfg, nil
+}
+
+// validateConfigFile checks that the file at path decodes, has no unknown
+// keys, and has valid values.
+func validateConfigFile(path string) error {
+	md, err := toml.DecodeFile(path, config.DefaultDbridgeNode())
+	if err != nil {
+		return err
+	}
+
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		keys := make([]string, len(undecoded))
+		for i, k := range undecoded {
+			keys[i] = k.String()
+		}
+		sort.Strings(keys)
+		return xerrors.Errorf("unknown config keys: %s", strings.Join(keys, ", "))
+	}
+
+	c, err := config.FromFile(path, config.DefaultDbridgeNode())
+	if err != nil {
+		return err
+	}
+
+	return config.Validate(c.(*config.BdridgeNode))
+}
+
+// fieldJSON returns the JSON encoded value of the field at the dotted path in
+// cfg.
+func fieldJSON(cfg *config.BdridgeNode, path string) (json.RawMessage, error) {
+	v := reflect.ValueOf(cfg).Elem()
+	for _, name := range strings.Split(path, ".") {
+		v = v.FieldByName(name)
+		if !v.IsValid() {
+			return nil, xerrors.Errorf("unknown config field %s", path)
+		}
+	}
+
+	return json.Marshal(v.Interface())
+}
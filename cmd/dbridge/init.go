@@ -2,20 +2,39 @@ package main
 
 import (
 	"fmt"
+	"os"
 
 	"github.com/ipfs/go-datastore"
 	"github.com/mitchellh/go-homedir"
 	"github.com/urfave/cli/v2"
 
 	lcli "github.com/lyswifter/dbridge/cli/util"
+	"github.com/lyswifter/dbridge/lib/backupds"
+	"github.com/lyswifter/dbridge/lib/tlsutil"
+	"github.com/lyswifter/dbridge/node/config"
 	"github.com/lyswifter/dbridge/node/repo"
+	"github.com/lyswifter/dbridge/types"
 	"golang.org/x/xerrors"
 )
 
 var initCmd = &cli.Command{
 	Name:  "init",
 	Usage: "Initialize a dbridge node repo",
-	Flags: []cli.Flag{},
+	Flags: []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:  "tls-host",
+			Usage: "additional host name or IP address to include in the self-signed remote API certificate",
+		},
+		&cli.StringFlag{
+			Name:  "restore",
+			Usage: "restore the node metadata from a backup file, or from a kvlog directory (e.g. <old repo>/kvlog/metadata)",
+		},
+		&cli.StringFlag{
+			Name:  "restore-archive",
+			Usage: "restore config.toml and the keystore from a tar(.gz) archive of those repo files, used with --restore. Backup keys in its keystore are used to read encrypted backups",
+		},
+		keystorePassphraseFileFlag,
+	},
 	Action: func(c *cli.Context) error {
 		log.Info("Initializing dbridge node")
 
@@ -39,11 +58,66 @@ var initCmd = &cli.Command{
 			return xerrors.Errorf("opening fs repo: %w", err)
 		}
 
+		// check everything to restore before creating the repo, so that a bad
+		// backup doesn't leave a half initialized one behind
+		var restoreFrom string
+		var archive *repoArchive
+		var restoreKeys *backupds.Keyring
+		if c.IsSet("restore") {
+			exists, err := r.Exists()
+			if err != nil {
+				return err
+			}
+			if exists {
+				return xerrors.Errorf("repo at '%s' already exists, restoring needs a new repo", repoPath)
+			}
+
+			restoreFrom, err = restoreSource(c.String("restore"))
+			if err != nil {
+				return xerrors.Errorf("finding backup to restore: %w", err)
+			}
+
+			// encrypted backups are read with the backup keys in the archive's
+			// keystore, or the passphrase from the environment
+			var keys []types.KeyInfo
+			if c.IsSet("restore-archive") {
+				if archive, err = readRepoArchive(c.String("restore-archive")); err != nil {
+					return xerrors.Errorf("reading repo archive: %w", err)
+				}
+				if keys, err = archive.keys(func() ([]byte, error) {
+					return keystorePassphrase(c)
+				}); err != nil {
+					return err
+				}
+			}
+			if restoreKeys, err = repo.BackupKeyring(keys); err != nil {
+				return err
+			}
+
+			log.Infof("verifying backup %s", restoreFrom)
+			if _, err := readMetadataBackup(restoreFrom, restoreKeys, func(datastore.Key, []byte) error { return nil }); err != nil {
+				return xerrors.Errorf("verifying backup: %w", err)
+			}
+		} else if c.IsSet("restore-archive") {
+			return xerrors.New("--restore-archive can only be used with --restore")
+		}
+
 		err = r.Init(repo.Dbridge)
 		if err != nil && err != repo.ErrRepoExists {
 			return xerrors.Errorf("repo init error: %w", err)
 		}
 
+		if archive != nil {
+			dir, err := homedir.Expand(repoPath)
+			if err != nil {
+				return err
+			}
+			if err := archive.write(dir, r.ConfigPath()); err != nil {
+				return err
+			}
+			log.Infof("restored config and %d keystore files", len(archive.keystore))
+		}
+
 		lr, err := r.Lock(repo.Dbridge)
 		if err != nil {
 			return err
@@ -55,9 +129,28 @@ var initCmd = &cli.Command{
 			return err
 		}
 
+		if restoreFrom != "" {
+			stats, err := restoreMetadata(ctx, lr, restoreFrom, restoreKeys)
+			if err != nil {
+				return xerrors.Errorf("restoring metadata: %w", err)
+			}
+			log.Infow("restored metadata", "from", restoreFrom, "keys", stats.Keys, "logEntries", stats.LogEntries)
+			if stats.Truncated {
+				log.Warn("the backup log ended in a truncated entry, which was not restored")
+			}
+		}
+
+		if err := initAPICert(lr, c.StringSlice("tls-host")); err != nil {
+			return xerrors.Errorf("initializing remote API certificate: %w", err)
+		}
+
 		nodeName := "node-1"
 
-		if err := mds.Put(ctx, datastore.NewKey("node-address"), []byte(nodeName)); err != nil {
+		if restored, err := mds.Get(ctx, datastore.NewKey("node-address")); err == nil {
+			nodeName = string(restored)
+		} else if err != datastore.ErrNotFound {
+			return err
+		} else if err := mds.Put(ctx, datastore.NewKey("node-address"), []byte(nodeName)); err != nil {
 			return err
 		}
 
@@ -68,3 +161,42 @@ var initCmd = &cli.Command{
 		return nil
 	},
 }
+
+// initAPICert generates a self-signed certificate for the remote API, unless
+// the configured certificate already exists.
+func initAPICert(lr repo.LockedRepo, hosts []string) error {
+	c, err := lr.Config()
+	if err != nil {
+		return err
+	}
+
+	cfg, ok := c.(*config.BdridgeNode)
+	if !ok {
+		return xerrors.Errorf("invalid config from repo, got: %T", c)
+	}
+
+	certPath := repoRelative(lr.Path(), cfg.API.TLSCertFile)
+	keyPath := repoRelative(lr.Path(), cfg.API.TLSKeyFile)
+	if certPath == "" || keyPath == "" {
+		return nil
+	}
+
+	if _, err := os.Stat(certPath); err == nil {
+		log.Infof("remote API certificate already exists at %s", certPath)
+		return nil
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	hosts = append([]string{"localhost", "127.0.0.1", "::1"}, hosts...)
+	if hn, err := os.Hostname(); err == nil {
+		hosts = append(hosts, hn)
+	}
+
+	if err := tlsutil.GenerateSelfSigned(certPath, keyPath, hosts); err != nil {
+		return err
+	}
+
+	log.Infof("generated self-signed remote API certificate at %s", certPath)
+	return nil
+}
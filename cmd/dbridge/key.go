@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/lyswifter/dbridge/api"
+	lcli "github.com/lyswifter/dbridge/cli"
+	"github.com/lyswifter/dbridge/node/modules"
+	"github.com/lyswifter/dbridge/node/repo"
+)
+
+var keyCmd = &cli.Command{
+	Name:  "key",
+	Usage: "Manage the keys in the keystore",
+	Description: `Works on the repo when the node is stopped, unlocking an encrypted keystore
+   like 'dbridge keystore' does, and through the admin API when it's running.`,
+	Flags: []cli.Flag{
+		keystorePassphraseFileFlag,
+	},
+	Subcommands: []*cli.Command{
+		keyListCmd,
+		keyExportCmd,
+		keyImportCmd,
+		keyDeleteCmd,
+		keyRotateLibp2pCmd,
+	},
+}
+
+var exportPassphraseFileFlag = &cli.StringFlag{
+	Name:  "passphrase-file",
+	Usage: "read the passphrase of the exported key from this file, instead of a prompt",
+}
+
+var keyListCmd = &cli.Command{
+	Name:  "list",
+	Usage: "List the keys in the keystore",
+	Action: func(cctx *cli.Context) error {
+		return withKeyManager(cctx, func(ctx context.Context, km keyManager, online bool) error {
+			keys, err := km.KeyList(ctx)
+			if err != nil {
+				return err
+			}
+
+			t := lcli.NewTable("Name", "Type", "PeerID")
+			for _, k := range keys {
+				t.Add(k.Name, k.Type, k.PeerID)
+			}
+			return lcli.PrintResult(cctx, keys, t)
+		})
+	},
+}
+
+var keyExportCmd = &cli.Command{
+	Name:      "export",
+	Usage:     "Export a key, encrypted with a passphrase",
+	ArgsUsage: "<name>",
+	Flags: []cli.Flag{
+		exportPassphraseFileFlag,
+		&cli.StringFlag{
+			Name:    "out-file",
+			Aliases: []string{"o"},
+			Usage:   "write the exported key to this file instead of stdout",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		if cctx.Args().Len() != 1 {
+			return xerrors.New("expected one argument: the key name")
+		}
+		name := cctx.Args().First()
+
+		pass, err := exportPassphrase(cctx, true)
+		if err != nil {
+			return err
+		}
+
+		return withKeyManager(cctx, func(ctx context.Context, km keyManager, online bool) error {
+			data, err := km.KeyExport(ctx, name, pass)
+			if err != nil {
+				return err
+			}
+
+			if p := cctx.String("out-file"); p != "" {
+				if err := ioutil.WriteFile(p, append(data, '\n'), 0600); err != nil {
+					return xerrors.Errorf("writing exported key: %w", err)
+				}
+				fmt.Fprintf(os.Stderr, "exported key '%s' to %s\n", name, p)
+				return nil
+			}
+
+			fmt.Println(string(data))
+			return nil
+		})
+	},
+}
+
+var keyImportCmd = &cli.Command{
+	Name:      "import",
+	Usage:     "Import a key exported with 'dbridge key export'",
+	ArgsUsage: "<file>",
+	Flags: []cli.Flag{
+		exportPassphraseFileFlag,
+		&cli.StringFlag{
+			Name:  "name",
+			Usage: "store the key under this name, instead of the one it was exported under",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		if cctx.Args().Len() != 1 {
+			return xerrors.New("expected one argument: the exported key file")
+		}
+
+		data, err := ioutil.ReadFile(cctx.Args().First())
+		if err != nil {
+			return xerrors.Errorf("reading exported key: %w", err)
+		}
+		pass, err := exportPassphrase(cctx, false)
+		if err != nil {
+			return err
+		}
+
+		return withKeyManager(cctx, func(ctx context.Context, km keyManager, online bool) error {
+			name, err := km.KeyImport(ctx, cctx.String("name"), data, pass)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("imported key '%s'\n", name)
+			if online {
+				fmt.Println("keys the node uses are read when it starts, restart it to use the imported key")
+			}
+			return nil
+		})
+	},
+}
+
+var keyDeleteCmd = &cli.Command{
+	Name:      "delete",
+	Usage:     "Remove a key from the keystore",
+	ArgsUsage: "<name>",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "force",
+			Usage: "also remove keys the node uses, like the libp2p host key",
+		},
+	},
+	Action: func(cctx *cli.Context) error {
+		if cctx.Args().Len() != 1 {
+			return xerrors.New("expected one argument: the key name")
+		}
+		name := cctx.Args().First()
+
+		return withKeyManager(cctx, func(ctx context.Context, km keyManager, online bool) error {
+			if err := km.KeyDelete(ctx, name, cctx.Bool("force")); err != nil {
+				return err
+			}
+
+			fmt.Printf("removed key '%s'\n", name)
+			return nil
+		})
+	},
+}
+
+var keyRotateLibp2pCmd = &cli.Command{
+	Name:  "rotate-libp2p",
+	Usage: "Replace the libp2p host key, changing the peer ID of the node",
+	Description: `The old key is kept in the keystore under a trash- prefixed name. A running
+   node keeps its peer ID until it's restarted.`,
+	Action: func(cctx *cli.Context) error {
+		return withKeyManager(cctx, func(ctx context.Context, km keyManager, online bool) error {
+			id, err := km.KeyRotateLibp2p(ctx)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("new peer ID: %s\n", id)
+			if online {
+				fmt.Println("restart the node to use the new identity")
+			}
+			return nil
+		})
+	},
+}
+
+// keyManager is implemented by the node API, and by modules.Keys over the
+// keystore of a locked repo.
+type keyManager interface {
+	KeyList(ctx context.Context) ([]api.KeyEntry, error)
+	KeyExport(ctx context.Context, name string, passphrase []byte) ([]byte, error)
+	KeyImport(ctx context.Context, name string, exported []byte, passphrase []byte) (string, error)
+	KeyDelete(ctx context.Context, name string, force bool) error
+	KeyRotateLibp2p(ctx context.Context) (peer.ID, error)
+}
+
+// withKeyManager calls cb with the keystore of the repo, or with the node API
+// if the node is running and holds the repo lock.
+func withKeyManager(cctx *cli.Context, cb func(ctx context.Context, km keyManager, online bool) error) error {
+	ctx := lcli.ReqContext(cctx)
+
+	r, err := openRepo(cctx)
+	if err != nil {
+		return err
+	}
+
+	lr, err := r.Lock(repo.Dbridge)
+	if xerrors.Is(err, repo.ErrRepoAlreadyLocked) {
+		napi, closer, err := lcli.GetFullNodeAPI(cctx)
+		if err != nil {
+			return xerrors.Errorf("repo is locked, and connecting to the node failed: %w", err)
+		}
+		defer closer()
+
+		return cb(ctx, napi, true)
+	}
+	if err != nil {
+		return err
+	}
+	defer lr.Close() //nolint:errcheck
+
+	if _, err := unlockKeyStore(cctx, lr); err != nil {
+		return err
+	}
+	ks, err := lr.KeyStore()
+	if err != nil {
+		return err
+	}
+
+	return cb(ctx, modules.NewKeys(ks), false)
+}
+
+// exportPassphrase returns the passphrase of an exported key, from a file, or
+// prompted for; twice when confirm is set.
+func exportPassphrase(cctx *cli.Context, confirm bool) ([]byte, error) {
+	if p := cctx.String(exportPassphraseFileFlag.Name); p != "" {
+		return readPassphraseFile(p)
+	}
+
+	pass, err := promptPassphrase("Export passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+	if confirm {
+		again, err := promptPassphrase("Repeat the passphrase: ")
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(pass, again) {
+			return nil, xerrors.New("passphrases don't match")
+		}
+	}
+	if len(strings.TrimSpace(string(pass))) == 0 {
+		return nil, xerrors.New("the passphrase is empty")
+	}
+	return pass, nil
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/urfave/cli/v2"
+	"golang.org/x/term"
+	"golang.org/x/xerrors"
+
+	"github.com/lyswifter/dbridge/node/repo"
+)
+
+// keystorePassphraseEnv holds the passphrase of an encrypted keystore, when
+// it's not read from a file or prompted for.
+const keystorePassphraseEnv = "DBRIDGE_KEYSTORE_PASSPHRASE"
+
+var keystorePassphraseFileFlag = &cli.StringFlag{
+	Name:  "keystore-passphrase-file",
+	Usage: "read the passphrase of the encrypted keystore from this file, instead of " + keystorePassphraseEnv + " or a prompt",
+}
+
+var keystoreCmd = &cli.Command{
+	Name:  "keystore",
+	Usage: "Encrypt or decrypt the keystore of the repo",
+	Description: `The keys in the keystore, like the libp2p host key and the API secret, can be
+   encrypted with a key derived from a passphrase. The node then needs the
+   passphrase to start, read from --keystore-passphrase-file, the
+   DBRIDGE_KEYSTORE_PASSPHRASE environment variable, or a prompt. These
+   commands need the node to be stopped.`,
+	Flags: []cli.Flag{
+		keystorePassphraseFileFlag,
+	},
+	Subcommands: []*cli.Command{
+		keystoreEncryptCmd,
+		keystoreDecryptCmd,
+		keystoreChangePassphraseCmd,
+	},
+}
+
+var newPassphraseFileFlag = &cli.StringFlag{
+	Name:  "new-passphrase-file",
+	Usage: "read the new passphrase from this file, instead of a prompt",
+}
+
+var keystoreEncryptCmd = &cli.Command{
+	Name:  "encrypt",
+	Usage: "Encrypt the keystore with a passphrase",
+	Flags: []cli.Flag{
+		newPassphraseFileFlag,
+	},
+	Action: func(cctx *cli.Context) error {
+		return withKeyStore(cctx, func(lr repo.LockedRepo, encrypted bool) error {
+			if encrypted {
+				return xerrors.New("keystore is already encrypted, use 'dbridge keystore change-passphrase' to change its passphrase")
+			}
+
+			pass, err := newPassphrase(cctx)
+			if err != nil {
+				return err
+			}
+			if err := lr.SetKeyStorePassphrase(pass); err != nil {
+				return err
+			}
+
+			fmt.Println("keystore encrypted")
+			return nil
+		})
+	},
+}
+
+var keystoreDecryptCmd = &cli.Command{
+	Name:  "decrypt",
+	Usage: "Decrypt the keystore, storing keys in plaintext",
+	Action: func(cctx *cli.Context) error {
+		return withKeyStore(cctx, func(lr repo.LockedRepo, encrypted bool) error {
+			if !encrypted {
+				return xerrors.New("keystore isn't encrypted")
+			}
+			if err := lr.SetKeyStorePassphrase(nil); err != nil {
+				return err
+			}
+
+			fmt.Println("keystore decrypted")
+			return nil
+		})
+	},
+}
+
+var keystoreChangePassphraseCmd = &cli.Command{
+	Name:  "change-passphrase",
+	Usage: "Re-encrypt the keystore with a new passphrase",
+	Flags: []cli.Flag{
+		newPassphraseFileFlag,
+	},
+	Action: func(cctx *cli.Context) error {
+		return withKeyStore(cctx, func(lr repo.LockedRepo, encrypted bool) error {
+			if !encrypted {
+				return xerrors.New("keystore isn't encrypted, use 'dbridge keystore encrypt' to encrypt it")
+			}
+
+			pass, err := newPassphrase(cctx)
+			if err != nil {
+				return err
+			}
+			if err := lr.SetKeyStorePassphrase(pass); err != nil {
+				return err
+			}
+
+			fmt.Println("keystore passphrase changed")
+			return nil
+		})
+	},
+}
+
+// withKeyStore locks the repo and calls cb with it, unlocking the keystore
+// first if it's encrypted.
+func withKeyStore(cctx *cli.Context, cb func(lr repo.LockedRepo, encrypted bool) error) error {
+	r, err := openRepo(cctx)
+	if err != nil {
+		return err
+	}
+
+	lr, err := r.Lock(repo.Dbridge)
+	if err != nil {
+		return err
+	}
+	defer lr.Close() //nolint:errcheck
+
+	encrypted, err := unlockKeyStore(cctx, lr)
+	if err != nil {
+		return err
+	}
+	return cb(lr, encrypted)
+}
+
+// unlockKeyStore unlocks the keystore of lr if it's encrypted, returning
+// whether it was.
+func unlockKeyStore(cctx *cli.Context, lr repo.LockedRepo) (bool, error) {
+	locked, err := lr.KeyStoreLocked()
+	if err != nil || !locked {
+		return false, err
+	}
+
+	pass, err := keystorePassphrase(cctx)
+	if err != nil {
+		return true, err
+	}
+	return true, lr.UnlockKeyStore(pass)
+}
+
+// keystorePassphrase returns the keystore passphrase, from the passphrase
+// file, the environment, or a prompt, in that order.
+func keystorePassphrase(cctx *cli.Context) ([]byte, error) {
+	if p := cctx.String(keystorePassphraseFileFlag.Name); p != "" {
+		return readPassphraseFile(p)
+	}
+	if pass, ok := os.LookupEnv(keystorePassphraseEnv); ok {
+		return []byte(pass), nil
+	}
+	pass, err := promptPassphrase("Keystore passphrase: ")
+	if xerrors.Is(err, errNoTerminal) {
+		return nil, xerrors.Errorf("%w; set %s or --%s", err, keystorePassphraseEnv, keystorePassphraseFileFlag.Name)
+	}
+	return pass, err
+}
+
+// newPassphrase returns a new keystore passphrase, read from a file, or
+// prompted for twice.
+func newPassphrase(cctx *cli.Context) ([]byte, error) {
+	var pass []byte
+	if p := cctx.String(newPassphraseFileFlag.Name); p != "" {
+		var err error
+		if pass, err = readPassphraseFile(p); err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		if pass, err = promptPassphrase("New keystore passphrase: "); err != nil {
+			return nil, err
+		}
+		again, err := promptPassphrase("Repeat the passphrase: ")
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(pass, again) {
+			return nil, xerrors.New("passphrases don't match")
+		}
+	}
+
+	if len(pass) == 0 {
+		return nil, xerrors.New("the passphrase is empty")
+	}
+	return pass, nil
+}
+
+func readPassphraseFile(p string) ([]byte, error) {
+	data, err := ioutil.ReadFile(p)
+	if err != nil {
+		return nil, xerrors.Errorf("reading passphrase file: %w", err)
+	}
+	return bytes.TrimRight(data, "\r\n"), nil
+}
+
+var errNoTerminal = xerrors.New("can't prompt for a passphrase, stdin isn't a terminal")
+
+// promptPassphrase reads a passphrase from the terminal, without echoing it.
+func promptPassphrase(prompt string) ([]byte, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return nil, errNoTerminal
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	pass, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, xerrors.Errorf("reading passphrase: %w", err)
+	}
+	return pass, nil
+}
@@ -24,6 +24,11 @@ func main() {
 		sampleCmd,
 		initCmd,
 		RunCmd,
+		auditCmd,
+		configCmd,
+		repoCmd,
+		keystoreCmd,
+		keyCmd,
 	}
 
 	if AdvanceBlockCmd != nil {
@@ -47,7 +52,14 @@ func main() {
 				Usage:   "Specify dbridge node repo path.",
 			},
 			cliutil.FlagVeryVerbose,
+			cliutil.FlagAPITLSCA,
+			cliutil.FlagAPITLSCert,
+			cliutil.FlagAPITLSKey,
+			cliutil.FlagNode,
+			cliutil.FlagNodesFile,
+			lcli.FlagOutput,
 		},
+		Before: lcli.CheckOutputFormat,
 		After: func(c *cli.Context) error {
 			return nil
 		},
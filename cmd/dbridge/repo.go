@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/xerrors"
+
+	lcli "github.com/lyswifter/dbridge/cli"
+	"github.com/lyswifter/dbridge/lib/backupds"
+	"github.com/lyswifter/dbridge/node/config"
+	"github.com/lyswifter/dbridge/node/repo"
+)
+
+var repoCmd = &cli.Command{
+	Name:  "repo",
+	Usage: "Manage the node repo",
+	Subcommands: []*cli.Command{
+		repoVersionCmd,
+		repoMigrateCmd,
+		repoReencryptCmd,
+	},
+}
+
+var repoVersionCmd = &cli.Command{
+	Name:  "version",
+	Usage: "Print the repo version, and the migrations it needs",
+	Action: func(cctx *cli.Context) error {
+		r, err := openRepo(cctx)
+		if err != nil {
+			return err
+		}
+
+		v, err := r.Version()
+		if err != nil {
+			return err
+		}
+
+		type migration struct {
+			From        int
+			To          int
+			Description string
+		}
+		out := struct {
+			Version   int
+			Supported int
+			Pending   []migration
+		}{
+			Version:   v,
+			Supported: repo.RepoVersion,
+			Pending:   []migration{},
+		}
+
+		pending, err := r.PendingMigrations()
+		if err != nil {
+			return err
+		}
+		for _, m := range pending {
+			out.Pending = append(out.Pending, migration{From: m.From, To: m.From + 1, Description: m.Description})
+		}
+
+		t := lcli.NewTable("From", "To", "Migration")
+		for _, m := range out.Pending {
+			t.Add(m.From, m.To, m.Description)
+		}
+
+		switch cctx.String(lcli.FlagOutput.Name) {
+		case lcli.OutputTable, "":
+			fmt.Printf("repo version: %d (supported: %d)\n", v, repo.RepoVersion)
+			if len(pending) == 0 {
+				fmt.Println("repo is up to date")
+				return nil
+			}
+			fmt.Printf("%d pending migrations, applied by 'dbridge repo migrate' or when the node starts:\n", len(pending))
+		}
+		return lcli.PrintResult(cctx, out, t)
+	},
+}
+
+var repoMigrateCmd = &cli.Command{
+	Name:  "migrate",
+	Usage: "Apply pending repo migrations",
+	Description: `Migrations are also applied when the node starts. The metadata datastore is
+   backed up into the backups directory of the repo before migrating, encrypted
+   as set by Backup.Encryption.`,
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "list the pending migrations without applying them",
+		},
+		&cli.BoolFlag{
+			Name:  "no-backup",
+			Usage: "don't back up the metadata datastore before migrating",
+		},
+		keystorePassphraseFileFlag,
+	},
+	Action: func(cctx *cli.Context) error {
+		r, err := openRepo(cctx)
+		if err != nil {
+			return err
+		}
+
+		res, err := r.Migrate(lcli.ReqContext(cctx), repo.MigrateOptions{
+			DryRun:   cctx.Bool("dry-run"),
+			NoBackup: cctx.Bool("no-backup"),
+			KeyStorePassphrase: func() ([]byte, error) {
+				return keystorePassphrase(cctx)
+			},
+		})
+		if res != nil && res.Backup != "" {
+			fmt.Printf("metadata backed up to %s\n", res.Backup)
+		}
+		if err != nil {
+			return err
+		}
+
+		if len(res.Pending) == 0 {
+			fmt.Printf("repo is up to date (version %d)\n", res.From)
+			return nil
+		}
+
+		for _, m := range res.Pending {
+			if cctx.Bool("dry-run") {
+				fmt.Printf("would migrate %d -> %d: %s\n", m.From, m.From+1, m.Description)
+			} else {
+				fmt.Printf("migrated %d -> %d: %s\n", m.From, m.From+1, m.Description)
+			}
+		}
+		return nil
+	},
+}
+
+var repoReencryptCmd = &cli.Command{
+	Name:      "reencrypt-backups",
+	Usage:     "Re-encrypt metadata logs and backups with the configured backup encryption",
+	ArgsUsage: "[files]",
+	Description: `Rewrites the metadata log files in kvlog/metadata, the backups in the
+   backup directory and the pre-migration backups in the backups directory of
+   the repo, or the given files, encrypted as set by Backup.Encryption,
+   or in plaintext with --plaintext. Files are read with the backup keys in the
+   keystore, and the passphrase in DBRIDGE_BACKUP_PASSPHRASE. The node must not
+   be running.`,
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "plaintext",
+			Usage: "decrypt the files instead",
+		},
+		keystorePassphraseFileFlag,
+	},
+	Action: func(cctx *cli.Context) error {
+		r, err := openRepo(cctx)
+		if err != nil {
+			return err
+		}
+
+		lr, err := r.Lock(repo.Dbridge)
+		if err != nil {
+			return err
+		}
+		defer lr.Close() //nolint:errcheck
+
+		c, err := lr.Config()
+		if err != nil {
+			return err
+		}
+		cfg, ok := c.(*config.BdridgeNode)
+		if !ok {
+			return xerrors.Errorf("invalid config from repo, got: %T", c)
+		}
+
+		if _, err := unlockKeyStore(cctx, lr); err != nil {
+			return err
+		}
+		ks, err := lr.KeyStore()
+		if err != nil {
+			return err
+		}
+
+		encryption := cfg.Backup.Encryption
+		if cctx.Bool("plaintext") {
+			encryption = config.BackupEncryptionNone
+		}
+		key, keys, err := repo.BackupKeys(ks, encryption)
+		if err != nil {
+			return err
+		}
+
+		files := cctx.Args().Slice()
+		if len(files) == 0 {
+			dirs := []string{filepath.Join(lr.Path(), "kvlog/metadata"), repoRelative(lr.Path(), cfg.Backup.Dir)}
+			// backups taken before migrating are always in the repo
+			if migrateDir := filepath.Join(lr.Path(), "backups"); filepath.Clean(dirs[1]) != migrateDir {
+				dirs = append(dirs, migrateDir)
+			}
+
+			for _, dir := range dirs {
+				ents, err := ioutil.ReadDir(dir)
+				if os.IsNotExist(err) {
+					continue
+				}
+				if err != nil {
+					return err
+				}
+				for _, ent := range ents {
+					if ent.Mode().IsRegular() && !strings.HasSuffix(ent.Name(), ".tmp") {
+						files = append(files, filepath.Join(dir, ent.Name()))
+					}
+				}
+			}
+		}
+
+		for _, f := range files {
+			if err := reencryptFile(f, keys, key); err != nil {
+				return xerrors.Errorf("re-encrypting %s: %w", f, err)
+			}
+			fmt.Printf("re-encrypted %s\n", f)
+		}
+		return nil
+	},
+}
+
+// reencryptFile rewrites the backup or log at p encrypted with key, replacing
+// it only once the new file is written and synced.
+func reencryptFile(p string, keys *backupds.Keyring, key *backupds.Key) error {
+	in, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer in.Close() //nolint:errcheck
+
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	// keep the mode of the old file, backups are only readable by their owner
+	tmp := p + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	err = backupds.Reencrypt(bufio.NewReader(in), out, keys, key)
+	if err == nil {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+
+	return os.Rename(tmp, p)
+}
+
+func openRepo(cctx *cli.Context) (*repo.FsRepo, error) {
+	repoPath, err := homedir.Expand(cctx.String(FlagDbridgeRepo))
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := repo.NewFS(repoPath)
+	if err != nil {
+		return nil, err
+	}
+
+	ok, err := r.Exists()
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, xerrors.Errorf("repo at '%s' is not initialized", repoPath)
+	}
+	return r, nil
+}
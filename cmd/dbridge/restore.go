@@ -0,0 +1,221 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/multiformats/go-base32"
+	"golang.org/x/xerrors"
+
+	"github.com/lyswifter/dbridge/lib/backupds"
+	"github.com/lyswifter/dbridge/node/config"
+	"github.com/lyswifter/dbridge/node/repo"
+	"github.com/lyswifter/dbridge/types"
+)
+
+// restoreSource resolves the metadata backup to restore from: either a backup
+// file, or a kvlog directory, from which the latest log file is used.
+func restoreSource(p string) (string, error) {
+	st, err := os.Stat(p)
+	if err != nil {
+		return "", err
+	}
+	if !st.IsDir() {
+		return p, nil
+	}
+
+	return backupds.LatestLog(p)
+}
+
+type restoreStats struct {
+	Keys       int
+	LogEntries int
+	// Truncated is set when the log ended in a partial entry, which was
+	// dropped
+	Truncated bool
+}
+
+// readMetadataBackup reads the backup at p, decrypting it with a key from kr
+// if it's encrypted, calling cb for each entry. The checksum of the backup is
+// checked by backupds.ReadBackupWithKeys.
+func readMetadataBackup(p string, kr *backupds.Keyring, cb func(datastore.Key, []byte) error) (restoreStats, error) {
+	var stats restoreStats
+
+	f, err := os.Open(p)
+	if err != nil {
+		return stats, err
+	}
+	defer f.Close() //nolint:errcheck
+
+	clean, err := backupds.ReadBackupWithKeys(bufio.NewReader(f), kr, func(k datastore.Key, v []byte, log bool) error {
+		if log {
+			stats.LogEntries++
+		} else {
+			stats.Keys++
+		}
+		return cb(k, v)
+	})
+	if err != nil {
+		return stats, xerrors.Errorf("reading backup %s: %w", p, err)
+	}
+	stats.Truncated = !clean
+
+	return stats, nil
+}
+
+// restoreMetadata writes the entries of the backup at p into the metadata
+// datastore of lr. Log entries are applied in order, after the base backup, so
+// they overwrite older values. Nothing is written unless the checksum matches.
+func restoreMetadata(ctx context.Context, lr repo.LockedRepo, p string, kr *backupds.Keyring) (restoreStats, error) {
+	mds, err := lr.Datastore(ctx, "/metadata")
+	if err != nil {
+		return restoreStats{}, err
+	}
+
+	batch, err := mds.Batch(ctx)
+	if err != nil {
+		return restoreStats{}, xerrors.Errorf("creating batch: %w", err)
+	}
+
+	stats, err := readMetadataBackup(p, kr, func(k datastore.Key, v []byte) error {
+		return batch.Put(ctx, k, v)
+	})
+	if err != nil {
+		return stats, err
+	}
+
+	if err := batch.Commit(ctx); err != nil {
+		return stats, xerrors.Errorf("committing restored metadata: %w", err)
+	}
+	return stats, nil
+}
+
+// repoArchive holds the files of a repo archive: the config, and the keys of
+// the keystore by file name.
+type repoArchive struct {
+	config   []byte
+	keystore map[string][]byte
+}
+
+// readRepoArchive reads a tar archive, optionally gzip compressed, holding
+// config.toml and the files of the keystore directory of a repo, as created by
+// e.g. 'tar -czf repo.tar.gz -C ~/.lorry config.toml keystore'. Other files
+// are ignored.
+func readRepoArchive(p string) (*repoArchive, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close() //nolint:errcheck
+
+	br := bufio.NewReader(f)
+	var r io.Reader = br
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, xerrors.Errorf("opening gzip stream: %w", err)
+		}
+		defer gz.Close() //nolint:errcheck
+		r = gz
+	}
+
+	out := &repoArchive{keystore: map[string][]byte{}}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, xerrors.Errorf("reading archive: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		name := path.Clean(strings.TrimPrefix(hdr.Name, "./"))
+		dir, file := path.Split(name)
+		switch {
+		case name == "config.toml":
+			if out.config, err = ioutil.ReadAll(tr); err != nil {
+				return nil, xerrors.Errorf("reading config from archive: %w", err)
+			}
+		case dir == "keystore/" && file != "":
+			// keys are stored under their base32 encoded names, next to the
+			// encryption parameters of encrypted keystores
+			if _, err := base32.RawStdEncoding.DecodeString(file); err != nil && file != repo.KeyStoreEncryptionFile {
+				log.Warnf("ignoring %s in repo archive, not a key file", hdr.Name)
+				continue
+			}
+			if out.keystore[file], err = ioutil.ReadAll(tr); err != nil {
+				return nil, xerrors.Errorf("reading key %s from archive: %w", file, err)
+			}
+		default:
+			log.Warnf("ignoring %s in repo archive", hdr.Name)
+		}
+	}
+
+	if out.config == nil && len(out.keystore) == 0 {
+		return nil, xerrors.Errorf("archive %s has no config.toml or keystore files", p)
+	}
+
+	if out.config != nil {
+		c, err := config.FromReader(bytes.NewReader(out.config), config.DefaultDbridgeNode())
+		if err != nil {
+			return nil, xerrors.Errorf("parsing config from archive: %w", err)
+		}
+		if err := config.Validate(c.(*config.BdridgeNode)); err != nil {
+			return nil, xerrors.Errorf("invalid config in archive: %w", err)
+		}
+	}
+
+	return out, nil
+}
+
+// keys returns the keys in the keystore of the archive. An encrypted keystore
+// is unlocked with the passphrase pass returns.
+func (a *repoArchive) keys(pass func() ([]byte, error)) ([]types.KeyInfo, error) {
+	keys, err := repo.DecodeKeyStoreFiles(a.keystore, func() ([]byte, error) {
+		p, err := pass()
+		if err != nil {
+			return nil, xerrors.Errorf("archive keystore is encrypted: %w", err)
+		}
+		return p, nil
+	})
+	if err != nil {
+		return nil, xerrors.Errorf("reading keys from archive: %w", err)
+	}
+
+	out := make([]types.KeyInfo, 0, len(keys))
+	for _, ki := range keys {
+		out = append(out, ki)
+	}
+	return out, nil
+}
+
+// write writes the archive files into the repo at repoPath, replacing the
+// config written by init.
+func (a *repoArchive) write(repoPath, configPath string) error {
+	if a.config != nil {
+		if err := ioutil.WriteFile(configPath, a.config, 0644); err != nil {
+			return xerrors.Errorf("restoring config: %w", err)
+		}
+	}
+
+	for name, data := range a.keystore {
+		if err := ioutil.WriteFile(filepath.Join(repoPath, "keystore", name), data, 0600); err != nil {
+			return xerrors.Errorf("restoring key %s: %w", name, err)
+		}
+	}
+	return nil
+}
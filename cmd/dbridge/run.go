@@ -2,16 +2,28 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
+	"path/filepath"
 
 	"github.com/filecoin-project/go-jsonrpc"
+	"github.com/filecoin-project/go-jsonrpc/auth"
 	"github.com/lyswifter/dbridge/api"
-	"github.com/lyswifter/dbridge/lib/peermgr"
+	"github.com/lyswifter/dbridge/build"
+	"github.com/lyswifter/dbridge/lib/audit"
+	"github.com/lyswifter/dbridge/lib/ratelimit"
+	"github.com/lyswifter/dbridge/lib/tlsutil"
+	"github.com/lyswifter/dbridge/lib/tracing"
+	"github.com/lyswifter/dbridge/metrics"
 	"github.com/lyswifter/dbridge/node"
+	"github.com/lyswifter/dbridge/node/config"
 	"github.com/lyswifter/dbridge/node/modules/dtypes"
 	"github.com/lyswifter/dbridge/node/repo"
 	"github.com/multiformats/go-multiaddr"
 	"github.com/urfave/cli/v2"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
 	"golang.org/x/xerrors"
 )
 
@@ -59,14 +71,35 @@ var RunCmd = &cli.Command{
 			Usage:  "start lorry in lite mode",
 			Hidden: false,
 		},
+		&cli.DurationFlag{
+			Name:  "trace-slow-calls",
+			Usage: "trace all API calls and log those which take longer than this duration (0 disables)",
+		},
+		keystorePassphraseFileFlag,
 	},
 	Action: func(cctx *cli.Context) error {
 
-		// ctx, _ := tag.New(context.Background(),
-		// 	tag.Insert(metrics.NodeType, "dkg-node"),
-		// )
+		ctx, _ := tag.New(context.Background(),
+			tag.Insert(metrics.Version, build.BuildVersion),
+			tag.Insert(metrics.Commit, build.CurrentCommit),
+			tag.Insert(metrics.NodeType, "dkg-node"),
+		)
+
+		// Register all metric views
+		if err := view.Register(metrics.DefaultViews...); err != nil {
+			return xerrors.Errorf("registering metric views: %w", err)
+		}
+
+		// Set the metric to one so it is published to the exporter
+		stats.Record(ctx, metrics.DbridgeInfo.M(1))
+
+		// Export metrics of instrumented ipfs components (e.g. datastore latencies),
+		// this has to happen before any of them is constructed
+		if err := metrics.InjectIpfsMetrics(); err != nil {
+			return xerrors.Errorf("injecting ipfs metrics: %w", err)
+		}
 
-		ctx := context.Background()
+		tracing.SetupSlowSpanLogging(cctx.Duration("trace-slow-calls"))
 
 		isLite := cctx.Bool("lite")
 
@@ -86,6 +119,26 @@ var RunCmd = &cli.Command{
 			return xerrors.Errorf("repo at '%s' is not initialized, run 'lorry init' to set it up", bridgeRepoPath)
 		}
 
+		cfg, repoPath, err := loadConfig(r)
+		if err != nil {
+			return xerrors.Errorf("loading config: %w", err)
+		}
+
+		remote, err := loadRemoteAPI(cfg, repoPath)
+		if err != nil {
+			return xerrors.Errorf("loading remote api config: %w", err)
+		}
+
+		auditLog, err := openAuditLog(cfg, repoPath)
+		if err != nil {
+			return xerrors.Errorf("opening audit log: %w", err)
+		}
+
+		limiter, err := newRateLimiter(cfg)
+		if err != nil {
+			return xerrors.Errorf("loading api rate limits: %w", err)
+		}
+
 		var api api.FullNode
 		stop, err := node.New(ctx,
 			node.FullAPI(&api, node.Lite(isLite)),
@@ -94,20 +147,19 @@ var RunCmd = &cli.Command{
 			node.Repo(r),
 
 			node.Override(new(dtypes.ShutdownChan), shutdownChan),
+			node.Override(new(dtypes.KeyStorePassphrase), dtypes.KeyStorePassphrase(func() ([]byte, error) {
+				return keystorePassphrase(cctx)
+			})),
+			node.If(limiter != nil, node.Override(new(*ratelimit.Limiter), limiter)),
 
 			node.ApplyIf(func(s *node.Settings) bool { return cctx.IsSet("api") },
 				node.Override(node.SetApiEndpointKey, func(lr repo.LockedRepo) error {
-					apima, err := multiaddr.NewMultiaddr("/ip4/127.0.0.1/tcp/" +
-						cctx.String("api"))
+					apima, err := multiaddr.NewMultiaddr(apiFlagAddress(cctx))
 					if err != nil {
 						return err
 					}
 					return lr.SetAPIEndpoint(apima)
 				})),
-			node.ApplyIf(func(s *node.Settings) bool { return !cctx.Bool("bootstrap") },
-				node.Unset(node.RunPeerMgrKey),
-				node.Unset(new(*peermgr.PeerMgr)),
-			),
 		)
 		if err != nil {
 			return xerrors.Errorf("initializing node: %w", err)
@@ -129,7 +181,7 @@ var RunCmd = &cli.Command{
 		}
 
 		// Instantiate the full node handler.
-		h, err := node.FullNodeHandler(api, true, serverOptions...)
+		h, err := node.FullNodeHandler(api, true, auditLog, limiter, serverOptions...)
 		if err != nil {
 			return fmt.Errorf("failed to instantiate rpc handler: %s", err)
 		}
@@ -140,10 +192,35 @@ var RunCmd = &cli.Command{
 			return fmt.Errorf("failed to start json-rpc endpoint: %s", err)
 		}
 
+		shutdownHandlers := []node.ShutdownHandler{
+			{Component: "rpc server", StopFunc: rpcStopper},
+		}
+
+		// Serve the remote RPC over TLS, if configured.
+		if remote != nil {
+			rh, err := node.RemoteFullNodeHandler(api, auditLog, limiter, serverOptions...)
+			if err != nil {
+				return fmt.Errorf("failed to instantiate remote rpc handler: %s", err)
+			}
+
+			remoteStopper, err := node.ServeRemoteRPC(node.ClientCertAuth(rh, remote.certPerms), "lorry-daemon-remote", remote.addr, remote.tls)
+			if err != nil {
+				return fmt.Errorf("failed to start remote json-rpc endpoint: %s", err)
+			}
+			log.Infof("remote API server listening on %s", remote.addr)
+
+			shutdownHandlers = append(shutdownHandlers, node.ShutdownHandler{Component: "remote rpc server", StopFunc: remoteStopper})
+		}
+
+		if auditLog != nil {
+			shutdownHandlers = append(shutdownHandlers, node.ShutdownHandler{Component: "audit log", StopFunc: func(context.Context) error {
+				return auditLog.Close()
+			}})
+		}
+
 		// Monitor for shutdown.
 		finishCh := node.MonitorShutdown(shutdownChan,
-			node.ShutdownHandler{Component: "rpc server", StopFunc: rpcStopper},
-			node.ShutdownHandler{Component: "node", StopFunc: stop},
+			append(shutdownHandlers, node.ShutdownHandler{Component: "node", StopFunc: stop})...,
 		)
 		<-finishCh // fires when shutdown is complete.
 
@@ -153,3 +230,100 @@ var RunCmd = &cli.Command{
 		StopCmd,
 	},
 }
+
+type remoteAPI struct {
+	addr      multiaddr.Multiaddr
+	tls       *tls.Config
+	certPerms map[string][]auth.Permission
+}
+
+// loadConfig reads the node config, along with the repo path config paths are
+// resolved against.
+func loadConfig(r repo.Repo) (*config.BdridgeNode, string, error) {
+	lr, err := r.Lock(repo.Dbridge)
+	if err != nil {
+		return nil, "", err
+	}
+	defer lr.Close() //nolint:errcheck
+
+	c, err := lr.Config()
+	if err != nil {
+		return nil, "", err
+	}
+
+	cfg, ok := c.(*config.BdridgeNode)
+	if !ok {
+		return nil, "", xerrors.Errorf("invalid config from repo, got: %T", c)
+	}
+
+	if err := config.Validate(cfg); err != nil {
+		return nil, "", xerrors.Errorf("invalid config, check it with 'dbridge config validate':\n%w", err)
+	}
+
+	return cfg, lr.Path(), nil
+}
+
+func openAuditLog(cfg *config.BdridgeNode, repoPath string) (*audit.Log, error) {
+	if cfg.Audit.Disable {
+		return nil, nil
+	}
+
+	return audit.Open(filepath.Join(repoPath, auditDir), cfg.Audit.MaxFileSize, cfg.Audit.MaxFiles)
+}
+
+func newRateLimiter(cfg *config.BdridgeNode) (*ratelimit.Limiter, error) {
+	if len(cfg.API.RateLimits) == 0 {
+		return nil, nil
+	}
+
+	limits := map[string]ratelimit.Limit{}
+	for class, l := range cfg.API.RateLimits {
+		limits[class] = ratelimit.Limit(l)
+	}
+	return ratelimit.New(limits)
+}
+
+// loadRemoteAPI reads the remote API settings from the repo config. It
+// returns nil when the remote listener is disabled.
+func loadRemoteAPI(cfg *config.BdridgeNode, repoPath string) (*remoteAPI, error) {
+	if cfg.API.RemoteListenAddress == "" {
+		return nil, nil
+	}
+
+	addr, err := multiaddr.NewMultiaddr(cfg.API.RemoteListenAddress)
+	if err != nil {
+		return nil, xerrors.Errorf("parsing remote listen address: %w", err)
+	}
+
+	tlsCfg, err := tlsutil.ServerConfig(
+		repoRelative(repoPath, cfg.API.TLSCertFile),
+		repoRelative(repoPath, cfg.API.TLSKeyFile),
+		repoRelative(repoPath, cfg.API.TLSClientCAFile),
+		cfg.API.RequireClientCert)
+	if err != nil {
+		return nil, err
+	}
+
+	certPerms := map[string][]auth.Permission{}
+	for cn, level := range cfg.API.ClientCertPerms {
+		perms, err := api.PermissionsUpTo(auth.Permission(level))
+		if err != nil {
+			return nil, xerrors.Errorf("client certificate '%s': %w", cn, err)
+		}
+		certPerms[cn] = perms
+	}
+
+	return &remoteAPI{
+		addr:      addr,
+		tls:       tlsCfg,
+		certPerms: certPerms,
+	}, nil
+}
+
+// repoRelative resolves config paths relative to the repo directory.
+func repoRelative(repoPath, p string) string {
+	if p == "" || filepath.IsAbs(p) {
+		return p
+	}
+	return filepath.Join(repoPath, p)
+}
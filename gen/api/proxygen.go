@@ -335,6 +335,11 @@ func (s *{{$name}}Stub) {{.Name}}({{.NamedParams}}) ({{.Results}}) {
 {{range .Infos}}var _ {{.Name}} = new({{.Name}}Struct)
 {{end}}
 
+// MethodPerms maps each API method to the permission required to call it.
+var MethodPerms = map[string]auth.Permission{
+{{range .Infos}}{{range .Methods}}	"{{.Name}}": "{{index .Tags.perm 1}}",
+{{end}}{{end}}}
+
 `)
 	return err
 }
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+type docField struct {
+	Name    string
+	Type    string
+	Comment string
+}
+
+func main() {
+	if err := generate("./node/config/types.go", "./node/config/doc_gen.go"); err != nil {
+		fmt.Println("error: ", err)
+	}
+}
+
+// generate collects the doc comments of the config struct fields in path, and
+// writes them out as the Doc map used when printing documented configs.
+func generate(path, outPath string) error {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, path, nil, parser.ParseComments)
+	if err != nil {
+		return xerrors.Errorf("parsing %s: %w", path, err)
+	}
+
+	docs := map[string][]docField{}
+	for _, decl := range f.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.TYPE {
+			continue
+		}
+
+		for _, spec := range gd.Specs {
+			ts := spec.(*ast.TypeSpec)
+			st, ok := ts.Type.(*ast.StructType)
+			if !ok {
+				continue
+			}
+
+			var fields []docField
+			for _, fl := range st.Fields.List {
+				if len(fl.Names) == 0 {
+					continue // embedded
+				}
+
+				typ, err := typeName(fl.Type)
+				if err != nil {
+					return xerrors.Errorf("%s: %w", ts.Name.Name, err)
+				}
+
+				comment := strings.TrimSpace(fl.Doc.Text())
+				for _, n := range fl.Names {
+					fields = append(fields, docField{Name: n.Name, Type: typ, Comment: comment})
+				}
+			}
+			docs[ts.Name.Name] = fields
+		}
+	}
+
+	names := make([]string, 0, len(docs))
+	for n := range docs {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	fmt.Fprint(&buf, `// Code generated by github.com/lyswifter/dbridge/gen/config. DO NOT EDIT.
+
+package config
+
+type DocField struct {
+	Name    string
+	Type    string
+	Comment string
+}
+
+var Doc = map[string][]DocField{
+`)
+	for _, n := range names {
+		fmt.Fprintf(&buf, "\t%q: {\n", n)
+		for _, f := range docs[n] {
+			fmt.Fprintf(&buf, "\t\t{\n\t\t\tName: %q,\n\t\t\tType: %q,\n\n\t\t\tComment: `%s`,\n\t\t},\n", f.Name, f.Type, strings.ReplaceAll(f.Comment, "`", "'"))
+		}
+		fmt.Fprint(&buf, "\t},\n")
+	}
+	fmt.Fprint(&buf, "}\n")
+
+	out, err := format.Source(buf.Bytes())
+	if err != nil {
+		return xerrors.Errorf("formatting generated docs: %w", err)
+	}
+
+	return ioutil.WriteFile(outPath, out, 0644)
+}
+
+func typeName(e ast.Expr) (string, error) {
+	switch t := e.(type) {
+	case *ast.Ident:
+		return t.Name, nil
+	case *ast.SelectorExpr:
+		return t.X.(*ast.Ident).Name + "." + t.Sel.Name, nil
+	case *ast.ArrayType:
+		sub, err := typeName(t.Elt)
+		if err != nil {
+			return "", err
+		}
+		return "[]" + sub, nil
+	case *ast.MapType:
+		k, err := typeName(t.Key)
+		if err != nil {
+			return "", err
+		}
+		v, err := typeName(t.Value)
+		if err != nil {
+			return "", err
+		}
+		return "map[" + k + "]" + v, nil
+	case *ast.StarExpr:
+		sub, err := typeName(t.X)
+		if err != nil {
+			return "", err
+		}
+		return "*" + sub, nil
+	default:
+		return "", xerrors.Errorf("unsupported field type %T", e)
+	}
+}
@@ -0,0 +1,170 @@
+// Package alerting tracks conditions which need the operator's attention,
+// like a low file descriptor limit. Alerts are raised and resolved by the
+// subsystems which detect them, and can be listed through the API.
+package alerting
+
+import (
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	logging "github.com/ipfs/go-log/v2"
+
+	"github.com/lyswifter/dbridge/lib/journal"
+)
+
+var log = logging.Logger("alerting")
+
+// AlertType is a unique alert identifier
+type AlertType struct {
+	System, Subsystem string
+}
+
+// AlertEvent contains information about alert state transition
+type AlertEvent struct {
+	Type    string // either 'raised' or 'resolved'
+	Message json.RawMessage
+	Time    time.Time
+}
+
+type Alert struct {
+	Type   AlertType
+	Active bool
+
+	LastActive   *AlertEvent // NOTE: pointer for nullability, don't mutate the referenced object!
+	LastResolved *AlertEvent
+}
+
+// Alerting provides simple stateful alert system. Consumers can register alerts,
+// which can be raised and resolved.
+type Alerting struct {
+	j journal.Journal
+
+	evtRaised, evtResolved journal.EventType
+
+	lk     sync.Mutex
+	alerts map[AlertType]Alert
+}
+
+// AlertEvt is the journal record of an alert state transition.
+type AlertEvt struct {
+	Type    AlertType
+	Message json.RawMessage
+}
+
+func NewAlertingSystem(j journal.Journal) *Alerting {
+	return &Alerting{
+		j:           j,
+		evtRaised:   j.RegisterEventType("alert", "raised"),
+		evtResolved: j.RegisterEventType("alert", "resolved"),
+
+		alerts: map[AlertType]Alert{},
+	}
+}
+
+func (a *Alerting) AddAlertType(system, subsystem string) AlertType {
+	a.lk.Lock()
+	defer a.lk.Unlock()
+
+	at := AlertType{
+		System:    system,
+		Subsystem: subsystem,
+	}
+
+	if _, exists := a.alerts[at]; exists {
+		return at
+	}
+
+	a.alerts[at] = Alert{
+		Type:   at,
+		Active: false,
+	}
+	return at
+}
+
+func (a *Alerting) update(at AlertType, message interface{}, et journal.EventType, upd func(Alert, json.RawMessage) Alert) {
+	a.lk.Lock()
+	defer a.lk.Unlock()
+
+	alert, ok := a.alerts[at]
+	if !ok {
+		log.Errorw("unknown alert", "type", at, "message", message)
+		alert.Type = at
+	}
+
+	rawMsg, err := json.Marshal(message)
+	if err != nil {
+		log.Errorw("marshaling alert message failed", "type", at, "error", err)
+		rawMsg, _ = json.Marshal(&struct {
+			AlertError string
+		}{
+			AlertError: err.Error(),
+		})
+	}
+
+	a.alerts[at] = upd(alert, rawMsg)
+
+	a.j.RecordEvent(et, func() interface{} {
+		return AlertEvt{Type: at, Message: rawMsg}
+	})
+}
+
+// Raise marks the alert condition as active
+func (a *Alerting) Raise(at AlertType, message interface{}) {
+	log.Errorw("alert raised", "type", at, "message", message)
+
+	a.update(at, message, a.evtRaised, func(alert Alert, rawMsg json.RawMessage) Alert {
+		alert.Active = true
+		alert.LastActive = &AlertEvent{
+			Type:    "raised",
+			Message: rawMsg,
+			Time:    time.Now(),
+		}
+
+		return alert
+	})
+}
+
+// Resolve marks the alert condition as resolved
+func (a *Alerting) Resolve(at AlertType, message interface{}) {
+	log.Infow("alert resolved", "type", at, "message", message)
+
+	a.update(at, message, a.evtResolved, func(alert Alert, rawMsg json.RawMessage) Alert {
+		alert.Active = false
+		alert.LastResolved = &AlertEvent{
+			Type:    "resolved",
+			Message: rawMsg,
+			Time:    time.Now(),
+		}
+
+		return alert
+	})
+}
+
+// GetAlerts returns all registered (active and inactive) alerts
+func (a *Alerting) GetAlerts() []Alert {
+	a.lk.Lock()
+	defer a.lk.Unlock()
+
+	out := make([]Alert, 0, len(a.alerts))
+	for _, alert := range a.alerts {
+		out = append(out, alert)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Type.System != out[j].Type.System {
+			return out[i].Type.System < out[j].Type.System
+		}
+
+		return out[i].Type.Subsystem < out[j].Type.Subsystem
+	})
+
+	return out
+}
+
+func (a *Alerting) IsRaised(at AlertType) bool {
+	a.lk.Lock()
+	defer a.lk.Unlock()
+
+	return a.alerts[at].Active
+}
@@ -0,0 +1,282 @@
+// Package audit records API calls which need more than read permission to an
+// append-only log. Log files use the backupds log format: an empty datastore
+// backup followed by log entries, each holding a JSON encoded Record.
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-datastore"
+	logging "github.com/ipfs/go-log/v2"
+	"golang.org/x/xerrors"
+
+	"github.com/lyswifter/dbridge/lib/backupds"
+)
+
+var log = logging.Logger("audit")
+
+const fileSuffix = ".audit.cbor"
+
+// Record describes a single API call.
+type Record struct {
+	Time     time.Time
+	Method   string
+	TokenID  string `json:",omitempty"`
+	Label    string `json:",omitempty"`
+	Role     string `json:",omitempty"`
+	CertName string `json:",omitempty"` // common name of the client certificate
+	Remote   string
+	// Params is the hex encoded sha256 digest of the JSON encoded call
+	// parameters, which allows matching calls without logging their content.
+	// Secret parameters, like passphrases, are left out.
+	Params string
+	Error  string `json:",omitempty"`
+}
+
+// Log is an append-only audit log, rotated once the current file grows past
+// MaxFileSize.
+type Log struct {
+	dir         string
+	maxFileSize int64
+	maxFiles    int
+
+	lk   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// Open opens the audit log in dir, appending to the latest log file. When
+// maxFiles is non-zero, the oldest files are removed on rotation so that at
+// most maxFiles remain.
+func Open(dir string, maxFileSize int64, maxFiles int) (*Log, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, xerrors.Errorf("creating audit log dir: %w", err)
+	}
+
+	l := &Log{
+		dir:         dir,
+		maxFileSize: maxFileSize,
+		maxFiles:    maxFiles,
+	}
+
+	files, err := logFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(files) == 0 {
+		if err := l.rotate(); err != nil {
+			return nil, err
+		}
+		return l, nil
+	}
+
+	latest := files[len(files)-1]
+	f, err := os.OpenFile(latest, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, xerrors.Errorf("opening audit log: %w", err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, xerrors.Errorf("stat audit log: %w", err)
+	}
+
+	l.file, l.size = f, fi.Size()
+	log.Infow("audit log opened", "file", latest)
+	return l, nil
+}
+
+// Append writes the record to the log and syncs it to disk.
+func (l *Log) Append(r Record) error {
+	val, err := json.Marshal(&r)
+	if err != nil {
+		return xerrors.Errorf("encoding audit record: %w", err)
+	}
+
+	ent := backupds.Entry{
+		Key:       datastore.NewKey(r.Method).Bytes(),
+		Value:     val,
+		Timestamp: r.Time.Unix(),
+	}
+
+	// marshal into a buffer first, so that each entry is written in one go
+	var buf bytes.Buffer
+	if err := ent.MarshalCBOR(&buf); err != nil {
+		return xerrors.Errorf("encoding audit entry: %w", err)
+	}
+
+	l.lk.Lock()
+	defer l.lk.Unlock()
+
+	if l.file == nil {
+		return xerrors.New("audit log closed")
+	}
+
+	if l.maxFileSize > 0 && l.size+int64(buf.Len()) > l.maxFileSize {
+		if err := l.rotate(); err != nil {
+			return xerrors.Errorf("rotating audit log: %w", err)
+		}
+	}
+
+	n, err := l.file.Write(buf.Bytes())
+	l.size += int64(n)
+	if err != nil {
+		return xerrors.Errorf("writing audit entry: %w", err)
+	}
+
+	return l.file.Sync()
+}
+
+// rotate starts a new log file, must be called with the lock held.
+func (l *Log) rotate() error {
+	if l.file != nil {
+		if err := l.file.Close(); err != nil {
+			log.Warnw("closing audit log", "error", err)
+		}
+		l.file = nil
+	}
+
+	p := filepath.Join(l.dir, strconv.FormatInt(time.Now().UnixNano(), 10)+fileSuffix)
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return xerrors.Errorf("creating audit log: %w", err)
+	}
+
+	// the log starts with an empty backup, which makes it readable with
+	// backupds.ReadBackup
+	bds, err := backupds.Wrap(datastore.NewMapDatastore(), backupds.NoLogdir)
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := bds.Backup(context.TODO(), f); err != nil {
+		_ = f.Close()
+		return xerrors.Errorf("writing audit log base: %w", err)
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return xerrors.Errorf("stat audit log: %w", err)
+	}
+
+	l.file, l.size = f, fi.Size()
+	log.Infow("audit log created", "file", p)
+
+	if l.maxFiles > 0 {
+		files, err := logFiles(l.dir)
+		if err != nil {
+			return err
+		}
+		for len(files) > l.maxFiles {
+			if err := os.Remove(files[0]); err != nil {
+				return xerrors.Errorf("removing old audit log: %w", err)
+			}
+			files = files[1:]
+		}
+	}
+
+	return nil
+}
+
+func (l *Log) Close() error {
+	l.lk.Lock()
+	defer l.lk.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// Read calls cb with all records in the audit log in dir, oldest first.
+func Read(dir string, cb func(Record) error) error {
+	files, err := logFiles(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if err := readFile(file, cb); err != nil {
+			return xerrors.Errorf("reading %s: %w", file, err)
+		}
+	}
+
+	return nil
+}
+
+func readFile(file string, cb func(Record) error) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close() //nolint:errcheck
+
+	_, err = backupds.ReadBackup(f, func(_ datastore.Key, value []byte, isLog bool) error {
+		if !isLog {
+			return nil
+		}
+
+		var r Record
+		if err := json.Unmarshal(value, &r); err != nil {
+			return xerrors.Errorf("decoding audit record: %w", err)
+		}
+		return cb(r)
+	})
+	return err
+}
+
+// logFiles returns the log files in dir, oldest first.
+func logFiles(dir string) ([]string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, xerrors.Errorf("reading audit log dir: %w", err)
+	}
+
+	type logFile struct {
+		path string
+		ts   int64
+	}
+
+	var files []logFile
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasSuffix(name, fileSuffix) {
+			continue
+		}
+
+		ts, err := strconv.ParseInt(strings.TrimSuffix(name, fileSuffix), 10, 64)
+		if err != nil {
+			log.Warnw("unexpected file in audit log dir", "file", name)
+			continue
+		}
+		files = append(files, logFile{path: filepath.Join(dir, name), ts: ts})
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].ts < files[j].ts
+	})
+
+	out := make([]string, len(files))
+	for i, f := range files {
+		out[i] = f.path
+	}
+	return out, nil
+}
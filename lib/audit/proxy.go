@@ -0,0 +1,94 @@
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"time"
+
+	"github.com/lyswifter/dbridge/api"
+	"github.com/lyswifter/dbridge/lib/caller"
+)
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// secretParams are the indexes of the parameters, after the context, which are
+// left out of the params digest. An unsalted digest of a passphrase could be
+// brute forced by anyone able to read the log.
+var secretParams = map[string][]int{
+	"KeyExport": {1},    // passphrase
+	"KeyImport": {1, 2}, // exported key, passphrase
+}
+
+// FullAPI records calls to methods which need more than read permission.
+func FullAPI(a api.FullNode, l *Log) api.FullNode {
+	var out api.FullNodeStruct
+	proxy(a, &out, l)
+	return &out
+}
+
+func proxy(in interface{}, outstr interface{}, l *Log) {
+	outs := api.GetInternalStructs(outstr)
+	for _, out := range outs {
+		rint := reflect.ValueOf(out).Elem()
+		ra := reflect.ValueOf(in)
+
+		for f := 0; f < rint.NumField(); f++ {
+			field := rint.Type().Field(f)
+			fn := ra.MethodByName(field.Name)
+
+			if api.MethodPerms[field.Name] == api.PermRead {
+				rint.Field(f).Set(fn)
+				continue
+			}
+
+			rint.Field(f).Set(reflect.MakeFunc(field.Type, func(args []reflect.Value) (results []reflect.Value) {
+				ctx := args[0].Interface().(context.Context)
+				c := caller.FromContext(ctx)
+
+				rec := Record{
+					Time:     time.Now(),
+					Method:   field.Name,
+					TokenID:  c.TokenID,
+					Label:    c.Label,
+					Role:     c.Role,
+					CertName: c.CertName,
+					Remote:   c.Remote,
+					Params:   paramsDigest(field.Name, args[1:]),
+				}
+
+				results = fn.Call(args)
+
+				if last := len(results) - 1; last >= 0 && field.Type.Out(last) == errorType && !results[last].IsNil() {
+					rec.Error = results[last].Interface().(error).Error()
+				}
+
+				if err := l.Append(rec); err != nil {
+					log.Errorw("failed to write audit record", "method", rec.Method, "error", err)
+				}
+
+				return results
+			}))
+		}
+	}
+}
+
+func paramsDigest(method string, args []reflect.Value) string {
+	params := make([]interface{}, len(args))
+	for i, a := range args {
+		params[i] = a.Interface()
+	}
+	for _, i := range secretParams[method] {
+		params[i] = nil
+	}
+
+	b, err := json.Marshal(params)
+	if err != nil {
+		return ""
+	}
+
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,79 @@
+package audit
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lyswifter/dbridge/api"
+)
+
+func TestParamsDigest(t *testing.T) {
+	values := func(args ...interface{}) []reflect.Value {
+		out := make([]reflect.Value, len(args))
+		for i, a := range args {
+			out[i] = reflect.ValueOf(a)
+		}
+		return out
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		a, b   []reflect.Value
+
+		same bool
+	}{
+		{
+			name:   "different params",
+			method: "NetConnect",
+			a:      values("a", []byte("1")),
+			b:      values("a", []byte("2")),
+		},
+		{
+			name:   "export passphrase left out",
+			method: "KeyExport",
+			a:      values("key", []byte("first passphrase")),
+			b:      values("key", []byte("second passphrase")),
+			same:   true,
+		},
+		{
+			name:   "export name kept",
+			method: "KeyExport",
+			a:      values("key", []byte("passphrase")),
+			b:      values("other", []byte("passphrase")),
+		},
+		{
+			name:   "import secrets left out",
+			method: "KeyImport",
+			a:      values("key", []byte("exported"), []byte("first passphrase")),
+			b:      values("key", []byte("other export"), []byte("second passphrase")),
+			same:   true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			a, b := paramsDigest(tc.method, tc.a), paramsDigest(tc.method, tc.b)
+			require.NotEmpty(t, a)
+			if tc.same {
+				require.Equal(t, a, b)
+			} else {
+				require.NotEqual(t, a, b)
+			}
+		})
+	}
+}
+
+func TestSecretParamsMatchAPI(t *testing.T) {
+	it := reflect.TypeOf((*api.FullNode)(nil)).Elem()
+	for method, idx := range secretParams {
+		m, ok := it.MethodByName(method)
+		require.True(t, ok, "no API method %s", method)
+		for _, i := range idx {
+			// parameters are counted after the context
+			require.Less(t, i+1, m.Type.NumIn(), "%s has no parameter %d", method, i)
+		}
+	}
+}
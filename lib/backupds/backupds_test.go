@@ -8,7 +8,9 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/ipfs/go-datastore"
 	"github.com/stretchr/testify/require"
@@ -84,3 +86,173 @@ func TestLogRestore(t *testing.T) {
 
 	checkVals(t, ds2, 0, 20, true)
 }
+
+func TestLogCompaction(t *testing.T) {
+	logdir, err := ioutil.TempDir("", "backupds-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(logdir) // nolint
+
+	ds1 := datastore.NewMapDatastore()
+
+	bds, err := Wrap(ds1, logdir, WithFlushInterval(0), WithMaxLogSize(1<<20), WithKeepLogs(1))
+	require.NoError(t, err)
+
+	latestLog := func() string {
+		l, err := LatestLog(logdir)
+		require.NoError(t, err)
+		return l
+	}
+
+	// logs are named by the second they were created in, and only compacted
+	// once that's passed
+	first := latestLog()
+	putVals(t, bds, 0, 4)
+	time.Sleep(1100 * time.Millisecond)
+	putVals(t, bds, 4, 5)
+	require.Eventually(t, func() bool { return latestLog() != first }, 5*time.Second, 10*time.Millisecond)
+
+	second := latestLog()
+	putVals(t, bds, 5, 6)
+	time.Sleep(1100 * time.Millisecond)
+	putVals(t, bds, 6, 8)
+	require.Eventually(t, func() bool { return latestLog() != second }, 5*time.Second, 10*time.Millisecond)
+
+	putVals(t, bds, 8, 10)
+	require.NoError(t, bds.Close())
+
+	// the first log was pruned, the previous one is kept
+	fls, err := logFiles(logdir)
+	require.NoError(t, err)
+	require.Len(t, fls, 2)
+	require.Equal(t, filepath.Base(second), fls[0].name)
+
+	bf, err := ioutil.ReadFile(latestLog())
+	require.NoError(t, err)
+
+	ds2 := datastore.NewMapDatastore()
+	require.NoError(t, RestoreInto(bytes.NewReader(bf), ds2))
+
+	checkVals(t, ds2, 0, 10, true)
+
+	// the compacted log is opened again
+	bds, err = Wrap(ds2, logdir)
+	require.NoError(t, err)
+	require.NoError(t, bds.Close())
+}
+
+func BenchmarkLogPut(b *testing.B) {
+	val := []byte(strings.Repeat("~", 256))
+
+	for _, flush := range []time.Duration{0, 10 * time.Millisecond} {
+		for _, parallel := range []bool{false, true} {
+			b.Run(fmt.Sprintf("flush=%s/parallel=%t", flush, parallel), func(b *testing.B) {
+				logdir, err := ioutil.TempDir("", "backupds-bench-")
+				require.NoError(b, err)
+				defer os.RemoveAll(logdir) // nolint
+
+				bds, err := Wrap(datastore.NewMapDatastore(), logdir, WithFlushInterval(flush))
+				require.NoError(b, err)
+				defer bds.Close() // nolint
+
+				var n int64
+				put := func() {
+					k := datastore.NewKey(fmt.Sprint(atomic.AddInt64(&n, 1)))
+					if err := bds.Put(context.TODO(), k, val); err != nil {
+						b.Fatal(err)
+					}
+				}
+
+				b.SetBytes(int64(len(val)))
+				b.ResetTimer()
+
+				if !parallel {
+					for i := 0; i < b.N; i++ {
+						put()
+					}
+					return
+				}
+
+				b.SetParallelism(16)
+				b.RunParallel(func(pb *testing.PB) {
+					for pb.Next() {
+						put()
+					}
+				})
+			})
+		}
+	}
+}
+
+func TestEncryptedLogRestore(t *testing.T) {
+	logdir, err := ioutil.TempDir("", "backupds-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(logdir) // nolint
+
+	key, err := NewKey(bytes.Repeat([]byte{1}, 32))
+	require.NoError(t, err)
+
+	ds1 := datastore.NewMapDatastore()
+	putVals(t, ds1, 0, 2)
+
+	bds, err := Wrap(ds1, logdir, WithEncryption(key))
+	require.NoError(t, err)
+	putVals(t, bds, 2, 4)
+	require.NoError(t, bds.Close())
+
+	// the log is appended to when it's opened again with the same key
+	bds, err = Wrap(ds1, logdir, WithEncryption(key))
+	require.NoError(t, err)
+	putVals(t, bds, 4, 6)
+
+	var bup bytes.Buffer
+	require.NoError(t, bds.Backup(context.TODO(), &bup))
+	require.NoError(t, bds.Close())
+
+	lf, err := LatestLog(logdir)
+	require.NoError(t, err)
+	bf, err := ioutil.ReadFile(lf)
+	require.NoError(t, err)
+	require.False(t, bytes.Contains(bf, []byte("~~~~~~~~")), "log is in plaintext")
+	require.False(t, bytes.Contains(bup.Bytes(), []byte("~~~~~~~~")), "backup is in plaintext")
+
+	for _, b := range [][]byte{bf, bup.Bytes()} {
+		_, err = ReadBackup(bytes.NewReader(b), func(datastore.Key, []byte, bool) error { return nil })
+		require.ErrorIs(t, err, ErrEncrypted)
+
+		other, err := NewKey(bytes.Repeat([]byte{2}, 32))
+		require.NoError(t, err)
+		_, err = ReadBackupWithKeys(bytes.NewReader(b), NewKeyring(other), func(datastore.Key, []byte, bool) error { return nil })
+		require.ErrorIs(t, err, ErrEncrypted)
+
+		ds2 := datastore.NewMapDatastore()
+		_, err = ReadBackupWithKeys(bytes.NewReader(b), NewKeyring(key), func(k datastore.Key, v []byte, _ bool) error {
+			return ds2.Put(context.TODO(), k, v)
+		})
+		require.NoError(t, err)
+		checkVals(t, ds2, 0, 6, true)
+	}
+
+	// a chunk cut short is a truncated log entry
+	_, err = ReadBackupWithKeys(bytes.NewReader(bf[:len(bf)-5]), NewKeyring(key), func(datastore.Key, []byte, bool) error { return nil })
+	require.ErrorIs(t, err, errTruncatedChunk)
+
+	// a flipped bit fails authentication
+	bad := append([]byte{}, bf...)
+	bad[len(bad)/2] ^= 1
+	_, err = ReadBackupWithKeys(bytes.NewReader(bad), NewKeyring(key), func(datastore.Key, []byte, bool) error { return nil })
+	require.Error(t, err)
+
+	// re-encrypted with a passphrase key, and back to plaintext
+	pkey, err := NewPassphraseKey([]byte("passphrase"))
+	require.NoError(t, err)
+	var pbuf, plain bytes.Buffer
+	require.NoError(t, Reencrypt(bytes.NewReader(bf), &pbuf, NewKeyring(key), pkey))
+
+	kr := NewKeyring()
+	kr.AddPassphrase([]byte("passphrase"))
+	require.NoError(t, Reencrypt(&pbuf, &plain, kr, nil))
+
+	ds3 := datastore.NewMapDatastore()
+	require.NoError(t, RestoreInto(&plain, ds3))
+	checkVals(t, ds3, 0, 6, true)
+}
@@ -0,0 +1,428 @@
+package backupds
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+
+	"github.com/ipfs/go-datastore"
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/xerrors"
+)
+
+// Encrypted backups and logs start with a header naming the key they're
+// encrypted with, followed by AES-GCM sealed chunks:
+//
+//	header: magic | version | kdf | key id [8] | salt [16], kdf=scrypt only | nonce [12]
+//	chunk:  uint32 length | sealed data
+//
+// Chunk nonces are the header nonce xor'ed with the chunk index, and the
+// header is authenticated with every chunk, so chunks can't be reordered or
+// moved between files. Plaintext backups start with a CBOR array header,
+// which never matches the magic.
+var cryptMagic = []byte("DBRENC")
+
+const (
+	cryptVersion = 1
+
+	kdfNone   = 0
+	kdfScrypt = 1
+
+	keyIDLen = 8
+	saltLen  = 16
+
+	// maxChunkSize bounds the memory a (possibly corrupted) chunk length can
+	// make the reader allocate
+	maxChunkSize = 16 << 20
+
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+// PassphraseEnv holds the passphrase of backups encrypted with a passphrase.
+const PassphraseEnv = "DBRIDGE_BACKUP_PASSPHRASE"
+
+// ErrEncrypted is returned when reading an encrypted backup without its key.
+var ErrEncrypted = xerrors.New("backup is encrypted")
+
+// errTruncatedChunk is returned when an encrypted stream ends in a partial
+// chunk, which, at the end of a log, is a truncated log entry.
+var errTruncatedChunk = xerrors.New("encrypted chunk truncated")
+
+// Key is an AES-256-GCM key backups and logs are encrypted with.
+type Key struct {
+	kdf  byte
+	id   [keyIDLen]byte
+	salt []byte
+	aead cipher.AEAD
+
+	// passphrase identifies the passphrase scrypt keys were derived from, so
+	// that keys derived with different salts can be told to be the same. It's
+	// never written out.
+	passphrase [sha256.Size]byte
+}
+
+// NewKey creates a key from a 32 byte secret, e.g. one kept in the keystore.
+func NewKey(secret []byte) (*Key, error) {
+	return newKey(kdfNone, nil, secret)
+}
+
+// NewPassphraseKey derives a key from a passphrase, with a new random salt.
+// The salt is written into the header of everything encrypted with the key,
+// so a Keyring holding the passphrase can derive it again.
+func NewPassphraseKey(passphrase []byte) (*Key, error) {
+	salt := make([]byte, saltLen)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+
+	return passphraseKey(passphrase, salt)
+}
+
+func passphraseKey(passphrase, salt []byte) (*Key, error) {
+	secret, err := scrypt.Key(passphrase, salt, scryptN, scryptR, scryptP, 32)
+	if err != nil {
+		return nil, xerrors.Errorf("deriving key: %w", err)
+	}
+
+	k, err := newKey(kdfScrypt, salt, secret)
+	if err != nil {
+		return nil, err
+	}
+	k.passphrase = sha256.Sum256(passphrase)
+	return k, nil
+}
+
+func newKey(kdf byte, salt, secret []byte) (*Key, error) {
+	if len(secret) != 32 {
+		return nil, xerrors.Errorf("expected a 32 byte key, got %d bytes", len(secret))
+	}
+
+	block, err := aes.NewCipher(secret)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	k := &Key{
+		kdf:  kdf,
+		salt: salt,
+		aead: aead,
+	}
+	sum := sha256.Sum256(secret)
+	copy(k.id[:], sum[:])
+	return k, nil
+}
+
+// ID identifies the key in the headers of encrypted backups.
+func (k *Key) ID() string {
+	return hex.EncodeToString(k.id[:])
+}
+
+// same returns true if o is k, or derived from the same passphrase.
+func (k *Key) same(o *Key) bool {
+	if k == nil || o == nil {
+		return k == o
+	}
+	if k.kdf == kdfScrypt && o.kdf == kdfScrypt {
+		return k.passphrase == o.passphrase
+	}
+	return k.kdf == o.kdf && k.id == o.id
+}
+
+// Keyring holds the keys encrypted backups can be read with.
+type Keyring struct {
+	keys        map[[keyIDLen]byte]*Key
+	passphrases [][]byte
+}
+
+func NewKeyring(keys ...*Key) *Keyring {
+	kr := &Keyring{keys: map[[keyIDLen]byte]*Key{}}
+	for _, k := range keys {
+		kr.Add(k)
+	}
+	return kr
+}
+
+func (kr *Keyring) Add(k *Key) {
+	kr.keys[k.id] = k
+}
+
+// AddPassphrase adds a passphrase keys are derived from, for backups
+// encrypted with a NewPassphraseKey key.
+func (kr *Keyring) AddPassphrase(passphrase []byte) {
+	kr.passphrases = append(kr.passphrases, passphrase)
+}
+
+func (kr *Keyring) find(kdf byte, id [keyIDLen]byte, salt []byte) (*Key, error) {
+	if kr == nil {
+		return nil, xerrors.Errorf("%w with key %x, no keys given", ErrEncrypted, id)
+	}
+
+	if k, ok := kr.keys[id]; ok {
+		return k, nil
+	}
+
+	if kdf == kdfScrypt {
+		for _, p := range kr.passphrases {
+			k, err := passphraseKey(p, salt)
+			if err != nil {
+				return nil, err
+			}
+			if k.id == id {
+				// cache, so that logs written with the key don't derive it again
+				kr.Add(k)
+				return k, nil
+			}
+		}
+		return nil, xerrors.Errorf("%w with a passphrase, none of the given passphrases match", ErrEncrypted)
+	}
+
+	return nil, xerrors.Errorf("%w with key %x, which isn't in the keyring", ErrEncrypted, id)
+}
+
+type cryptHeader struct {
+	raw   []byte
+	nonce []byte
+}
+
+// encWriter seals each write into a chunk.
+type encWriter struct {
+	w      io.Writer
+	key    *Key
+	hdr    cryptHeader
+	chunks uint64
+	buf    []byte
+}
+
+// newEncWriter writes the header of a stream encrypted with k to w.
+func newEncWriter(w io.Writer, k *Key) (*encWriter, error) {
+	nonce := make([]byte, k.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	var raw bytes.Buffer
+	raw.Write(cryptMagic)
+	raw.WriteByte(cryptVersion)
+	raw.WriteByte(k.kdf)
+	raw.Write(k.id[:])
+	if k.kdf == kdfScrypt {
+		raw.Write(k.salt)
+	}
+	raw.Write(nonce)
+
+	if _, err := w.Write(raw.Bytes()); err != nil {
+		return nil, xerrors.Errorf("writing encryption header: %w", err)
+	}
+
+	return &encWriter{
+		w:   w,
+		key: k,
+		hdr: cryptHeader{raw: raw.Bytes(), nonce: nonce},
+	}, nil
+}
+
+func (e *encWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if len(p) > maxChunkSize-e.key.aead.Overhead() {
+		// split, so that the reader accepts every chunk
+		n, err := e.Write(p[:maxChunkSize/2])
+		if err != nil {
+			return n, err
+		}
+		m, err := e.Write(p[maxChunkSize/2:])
+		return n + m, err
+	}
+
+	e.buf = append(e.buf[:0], 0, 0, 0, 0)
+	e.buf = e.key.aead.Seal(e.buf, chunkNonce(e.hdr.nonce, e.chunks), p, e.hdr.raw)
+	binary.BigEndian.PutUint32(e.buf, uint32(len(e.buf)-4))
+
+	// a chunk is written in one write, so only a crash leaves a partial one
+	if _, err := e.w.Write(e.buf); err != nil {
+		return 0, err
+	}
+	e.chunks++
+	return len(p), nil
+}
+
+func chunkNonce(base []byte, chunk uint64) []byte {
+	nonce := make([]byte, len(base))
+	copy(nonce, base)
+	off := len(nonce) - 8
+	binary.BigEndian.PutUint64(nonce[off:], binary.BigEndian.Uint64(nonce[off:])^chunk)
+	return nonce
+}
+
+// decReader reads a stream written by encWriter.
+type decReader struct {
+	r      io.Reader
+	key    *Key
+	hdr    cryptHeader
+	chunks uint64
+
+	buf, plain []byte
+}
+
+// newDecReader reads the header of an encrypted stream, after the first byte
+// of the magic, which was read by the caller to tell it from a plaintext one.
+func newDecReader(r io.Reader, kr *Keyring) (*decReader, error) {
+	raw := make([]byte, len(cryptMagic)+2+keyIDLen)
+	raw[0] = cryptMagic[0]
+	if _, err := io.ReadFull(r, raw[1:]); err != nil {
+		return nil, xerrors.Errorf("reading encryption header: %w", err)
+	}
+	if !bytes.Equal(raw[:len(cryptMagic)], cryptMagic) {
+		return nil, xerrors.Errorf("bad encryption header magic %x", raw[:len(cryptMagic)])
+	}
+	if v := raw[len(cryptMagic)]; v != cryptVersion {
+		return nil, xerrors.Errorf("unsupported encryption version %d", v)
+	}
+
+	kdf := raw[len(cryptMagic)+1]
+	var id [keyIDLen]byte
+	copy(id[:], raw[len(cryptMagic)+2:])
+
+	var salt []byte
+	switch kdf {
+	case kdfNone:
+	case kdfScrypt:
+		salt = make([]byte, saltLen)
+		if _, err := io.ReadFull(r, salt); err != nil {
+			return nil, xerrors.Errorf("reading encryption header: %w", err)
+		}
+		raw = append(raw, salt...)
+	default:
+		return nil, xerrors.Errorf("unknown key derivation %d", kdf)
+	}
+
+	k, err := kr.find(kdf, id, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, k.aead.NonceSize())
+	if _, err := io.ReadFull(r, nonce); err != nil {
+		return nil, xerrors.Errorf("reading encryption header: %w", err)
+	}
+	raw = append(raw, nonce...)
+
+	return &decReader{
+		r:   r,
+		key: k,
+		hdr: cryptHeader{raw: raw, nonce: nonce},
+	}, nil
+}
+
+func (d *decReader) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if err := d.next(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	return n, nil
+}
+
+func (d *decReader) next() error {
+	var lb [4]byte
+	if n, err := io.ReadFull(d.r, lb[:]); err != nil {
+		if err == io.EOF && n == 0 {
+			return io.EOF
+		}
+		return errTruncatedChunk
+	}
+
+	l := binary.BigEndian.Uint32(lb[:])
+	if l > maxChunkSize {
+		return xerrors.Errorf("encrypted chunk %d too large (%d bytes)", d.chunks, l)
+	}
+
+	if cap(d.buf) < int(l) {
+		d.buf = make([]byte, l)
+	}
+	d.buf = d.buf[:l]
+	if _, err := io.ReadFull(d.r, d.buf); err != nil {
+		return errTruncatedChunk
+	}
+
+	plain, err := d.key.aead.Open(d.buf[:0], chunkNonce(d.hdr.nonce, d.chunks), d.buf, d.hdr.raw)
+	if err != nil {
+		return xerrors.Errorf("decrypting chunk %d: %w", d.chunks, err)
+	}
+	d.chunks++
+	d.plain = plain
+	return nil
+}
+
+// resume returns a writer appending chunks to the stream after everything
+// was read.
+func (d *decReader) resume(w io.Writer) *encWriter {
+	return &encWriter{
+		w:      w,
+		key:    d.key,
+		hdr:    d.hdr,
+		chunks: d.chunks,
+	}
+}
+
+// openBackup returns a reader of the plaintext backup in r, decrypting it with
+// a key from kr if it's encrypted. The decReader is nil for plaintext backups.
+func openBackup(r io.Reader, kr *Keyring) (io.Reader, *decReader, error) {
+	var first [1]byte
+	if _, err := io.ReadFull(r, first[:]); err != nil {
+		return nil, nil, xerrors.Errorf("reading array header: %w", err)
+	}
+
+	if first[0] != cryptMagic[0] {
+		return io.MultiReader(bytes.NewReader(first[:]), r), nil, nil
+	}
+
+	dr, err := newDecReader(r, kr)
+	if err != nil {
+		return nil, nil, err
+	}
+	return dr, dr, nil
+}
+
+// Reencrypt copies the backup or log read from r to w, encrypted with to, or
+// in plaintext if to is nil. The entries are checked while they're copied.
+func Reencrypt(r io.Reader, w io.Writer, kr *Keyring, to *Key) error {
+	pr, _, err := openBackup(r, kr)
+	if err != nil {
+		return err
+	}
+
+	out := w
+	if to != nil {
+		if out, err = newEncWriter(w, to); err != nil {
+			return err
+		}
+	}
+
+	bw := bufio.NewWriterSize(out, 64<<10)
+	clean, err := readBackup(io.TeeReader(pr, bw), func(datastore.Key, []byte, bool) error { return nil })
+	if err != nil {
+		return err
+	}
+	if !clean {
+		return xerrors.New("log ends in a truncated entry")
+	}
+
+	return bw.Flush()
+}
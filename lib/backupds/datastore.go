@@ -1,6 +1,7 @@
 package backupds
 
 import (
+	"bufio"
 	"context"
 	"crypto/sha256"
 	"io"
@@ -27,6 +28,12 @@ type Datastore struct {
 
 	log             chan Entry
 	closing, closed chan struct{}
+
+	logdir string
+	opts   options
+	// swap hands a new log, compacted from a fresh base backup, to the log
+	// writer
+	swap chan logSwap
 }
 
 type Entry struct {
@@ -34,14 +41,27 @@ type Entry struct {
 	Timestamp  int64
 }
 
-func Wrap(child datastore.Batching, logdir string) (*Datastore, error) {
+// Wrap wraps child, recording writes in a log in logdir unless it's NoLogdir.
+func Wrap(child datastore.Batching, logdir string, opts ...Option) (*Datastore, error) {
 	ds := &Datastore{
-		child: child,
+		child:  child,
+		logdir: logdir,
+		opts:   defaultOptions(),
+	}
+	for _, o := range opts {
+		o(&ds.opts)
+	}
+	if ds.opts.key != nil {
+		if ds.opts.keys == nil {
+			ds.opts.keys = NewKeyring()
+		}
+		ds.opts.keys.Add(ds.opts.key)
 	}
 
 	if logdir != NoLogdir {
 		ds.closing, ds.closed = make(chan struct{}), make(chan struct{})
 		ds.log = make(chan Entry)
+		ds.swap = make(chan logSwap)
 
 		if err := ds.startLog(logdir); err != nil {
 			return nil, err
@@ -54,10 +74,33 @@ func Wrap(child datastore.Batching, logdir string) (*Datastore, error) {
 // Writes a datastore dump into the provided writer as
 // [array(*) of [key, value] tuples, checksum]
 func (d *Datastore) Backup(ctx context.Context, out io.Writer) error {
+	d.backupLk.Lock()
+	defer d.backupLk.Unlock()
+
+	if d.opts.key == nil {
+		_, err := d.backup(ctx, out)
+		return err
+	}
+
+	ew, err := newEncWriter(out, d.opts.key)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriterSize(ew, 64<<10)
+	if _, err := d.backup(ctx, bw); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// backup writes the datastore dump, returning the number of entries written.
+// The caller must hold backupLk for writing.
+func (d *Datastore) backup(ctx context.Context, out io.Writer) (int64, error) {
 	scratch := make([]byte, 9)
+	var entries int64
 
 	if err := cbg.WriteMajorTypeHeaderBuf(scratch, out, cbg.MajArray, 2); err != nil {
-		return xerrors.Errorf("writing tuple header: %w", err)
+		return 0, xerrors.Errorf("writing tuple header: %w", err)
 	}
 
 	hasher := sha256.New()
@@ -67,18 +110,15 @@ func (d *Datastore) Backup(ctx context.Context, out io.Writer) error {
 	{
 		// write indefinite length array header
 		if _, err := hout.Write([]byte{0x9f}); err != nil {
-			return xerrors.Errorf("writing header: %w", err)
+			return 0, xerrors.Errorf("writing header: %w", err)
 		}
 
-		d.backupLk.Lock()
-		defer d.backupLk.Unlock()
-
 		log.Info("Starting datastore backup")
 		defer log.Info("Datastore backup done")
 
 		qr, err := d.child.Query(ctx, query.Query{})
 		if err != nil {
-			return xerrors.Errorf("query: %w", err)
+			return 0, xerrors.Errorf("query: %w", err)
 		}
 		defer func() {
 			if err := qr.Close(); err != nil {
@@ -88,30 +128,35 @@ func (d *Datastore) Backup(ctx context.Context, out io.Writer) error {
 		}()
 
 		for result := range qr.Next() {
+			if result.Error != nil {
+				return 0, xerrors.Errorf("query result: %w", result.Error)
+			}
+			entries++
+
 			if err := cbg.WriteMajorTypeHeaderBuf(scratch, hout, cbg.MajArray, 2); err != nil {
-				return xerrors.Errorf("writing tuple header: %w", err)
+				return 0, xerrors.Errorf("writing tuple header: %w", err)
 			}
 
 			if err := cbg.WriteMajorTypeHeaderBuf(scratch, hout, cbg.MajByteString, uint64(len([]byte(result.Key)))); err != nil {
-				return xerrors.Errorf("writing key header: %w", err)
+				return 0, xerrors.Errorf("writing key header: %w", err)
 			}
 
 			if _, err := hout.Write([]byte(result.Key)[:]); err != nil {
-				return xerrors.Errorf("writing key: %w", err)
+				return 0, xerrors.Errorf("writing key: %w", err)
 			}
 
 			if err := cbg.WriteMajorTypeHeaderBuf(scratch, hout, cbg.MajByteString, uint64(len(result.Value))); err != nil {
-				return xerrors.Errorf("writing value header: %w", err)
+				return 0, xerrors.Errorf("writing value header: %w", err)
 			}
 
 			if _, err := hout.Write(result.Value[:]); err != nil {
-				return xerrors.Errorf("writing value: %w", err)
+				return 0, xerrors.Errorf("writing value: %w", err)
 			}
 		}
 
 		// array break
 		if _, err := hout.Write([]byte{0xff}); err != nil {
-			return xerrors.Errorf("writing array 'break': %w", err)
+			return 0, xerrors.Errorf("writing array 'break': %w", err)
 		}
 	}
 
@@ -120,15 +165,15 @@ func (d *Datastore) Backup(ctx context.Context, out io.Writer) error {
 		sum := hasher.Sum(nil)
 
 		if err := cbg.WriteMajorTypeHeaderBuf(scratch, hout, cbg.MajByteString, uint64(len(sum))); err != nil {
-			return xerrors.Errorf("writing checksum header: %w", err)
+			return 0, xerrors.Errorf("writing checksum header: %w", err)
 		}
 
 		if _, err := hout.Write(sum[:]); err != nil {
-			return xerrors.Errorf("writing checksum: %w", err)
+			return 0, xerrors.Errorf("writing checksum: %w", err)
 		}
 	}
 
-	return nil
+	return entries, nil
 }
 
 // proxy
@@ -214,15 +259,19 @@ type bbatch struct {
 	d   *Datastore
 	b   datastore.Batch
 	rlk sync.Locker
+
+	// entries are logged on commit, under the backup lock, so that a log
+	// compaction never sees a logged entry missing from the datastore
+	entries []Entry
 }
 
 func (b *bbatch) Put(ctx context.Context, key datastore.Key, value []byte) error {
 	if b.d.log != nil {
-		b.d.log <- Entry{
+		b.entries = append(b.entries, Entry{
 			Key:       []byte(key.String()),
 			Value:     value,
 			Timestamp: time.Now().Unix(),
-		}
+		})
 	}
 
 	return b.b.Put(ctx, key, value)
@@ -236,6 +285,11 @@ func (b *bbatch) Commit(ctx context.Context) error {
 	b.rlk.Lock()
 	defer b.rlk.Unlock()
 
+	for _, ent := range b.entries {
+		b.d.log <- ent
+	}
+	b.entries = nil
+
 	return b.b.Commit(ctx)
 }
 
@@ -1,12 +1,14 @@
 package backupds
 
 import (
+	"bufio"
 	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -19,44 +21,45 @@ import (
 
 var loghead = datastore.NewKey("/backupds/log/head") // string([logfile base name];[uuid];[unix ts])
 
+const (
+	logSuffix = ".log.cbor"
+
+	// maxLogBatch bounds the number of entries written before a sync
+	maxLogBatch = 1024
+
+	// minCompactSize is the size below which logs aren't compacted for
+	// holding more entries than the base backup
+	minCompactSize = 1 << 20
+
+	// rotateRetryDelay is how long a failed log compaction waits before it's
+	// retried
+	rotateRetryDelay = time.Minute
+)
+
+type logSwap struct {
+	l   *logfile
+	err error
+}
+
 func (d *Datastore) startLog(logdir string) error {
 	if err := os.MkdirAll(logdir, 0755); err != nil && !os.IsExist(err) {
 		return xerrors.Errorf("mkdir logdir ('%s'): %w", logdir, err)
 	}
 
-	files, err := ioutil.ReadDir(logdir)
+	files, err := logFiles(logdir)
 	if err != nil {
-		return xerrors.Errorf("read logdir ('%s'): %w", logdir, err)
-	}
-
-	var latest string
-	var latestTs int64
-
-	for _, file := range files {
-		fn := file.Name()
-		if !strings.HasSuffix(fn, ".log.cbor") {
-			log.Warn("logfile with wrong file extension", fn)
-			continue
-		}
-		sec, err := strconv.ParseInt(fn[:len(".log.cbor")], 10, 64)
-		if err != nil {
-			return xerrors.Errorf("parsing logfile as a number: %w", err)
-		}
-
-		if sec > latestTs {
-			latestTs = sec
-			latest = file.Name()
-		}
+		return err
 	}
 
 	var l *logfile
-	if latest == "" {
+	var latest string
+	if len(files) == 0 {
 		l, latest, err = d.createLog(logdir)
 		if err != nil {
 			return xerrors.Errorf("creating log: %w", err)
 		}
 	} else {
-		l, latest, err = d.openLog(filepath.Join(logdir, latest))
+		l, latest, err = d.openLog(filepath.Join(logdir, files[len(files)-1].name))
 		if err != nil {
 			return xerrors.Errorf("opening log: %w", err)
 		}
@@ -65,27 +68,101 @@ func (d *Datastore) startLog(logdir string) error {
 	if err := l.writeLogHead(latest, d.child); err != nil {
 		return xerrors.Errorf("writing new log head: %w", err)
 	}
+	if err := l.flush(); err != nil {
+		return xerrors.Errorf("syncing new log head: %w", err)
+	}
+
+	d.pruneLogs(latest)
 
 	go d.runLog(l)
 
 	return nil
 }
 
+// runLog writes log entries. Entries waiting to be written are written
+// together, and synced once the flush interval passes, so that concurrent
+// writers share a sync.
 func (d *Datastore) runLog(l *logfile) {
 	defer close(d.closed)
+
+	var flushTimer *time.Timer
+	var flushC <-chan time.Time
+	var rotating bool
+	var rotateAfter time.Time
+
+	flush := func() {
+		if flushTimer != nil {
+			flushTimer.Stop()
+			flushTimer, flushC = nil, nil
+		}
+
+		if err := l.flush(); err != nil {
+			log.Errorw("failed to sync log", "error", err)
+		}
+
+		if !rotating && time.Now().After(rotateAfter) && d.shouldRotate(l) {
+			rotating = true
+			go d.rotateLog()
+		}
+	}
+
+	write := func(ent *Entry) {
+		if err := l.writeEntry(ent); err != nil {
+			log.Errorw("failed to write log entry", "error", err)
+			// todo try to do something, maybe start a new log file (but not when we're out of disk space)
+		}
+	}
+
 	for {
 		select {
 		case ent := <-d.log:
-			if err := l.writeEntry(&ent); err != nil {
-				log.Errorw("failed to write log entry", "error", err)
-				// todo try to do something, maybe start a new log file (but not when we're out of disk space)
+			write(&ent)
+
+			// pick up the entries of other writers waiting meanwhile
+		drain:
+			for i := 1; i < maxLogBatch; i++ {
+				select {
+				case ent := <-d.log:
+					write(&ent)
+				default:
+					break drain
+				}
 			}
 
-			// todo: batch writes when multiple are pending; flush on a timer
-			if err := l.file.Sync(); err != nil {
-				log.Errorw("failed to sync log", "error", err)
+			if d.opts.flushInterval <= 0 || l.pending >= maxLogBatch {
+				flush()
+			} else if flushC == nil {
+				flushTimer = time.NewTimer(d.opts.flushInterval)
+				flushC = flushTimer.C
 			}
+		case <-flushC:
+			flushTimer, flushC = nil, nil
+			flush()
+		case sw := <-d.swap:
+			if sw.err != nil {
+				log.Errorw("failed to compact log", "error", sw.err)
+				rotating = false
+				rotateAfter = time.Now().Add(rotateRetryDelay)
+				continue
+			}
+
+			// the base of the new log was written with no writes in flight,
+			// so every entry written to the old log is in it
+			flush()
+			if err := l.Close(); err != nil {
+				log.Errorw("failed to close log", "error", err)
+			}
+
+			l = sw.l
+			if err := l.writeLogHead(l.name, d.child); err != nil {
+				log.Errorw("failed to write new log head", "error", err)
+			}
+			rotating = false
+			flush()
+
+			d.pruneLogs(l.name)
 		case <-d.closing:
+			flush()
 			if err := l.Close(); err != nil {
 				log.Errorw("failed to close log", "error", err)
 			}
@@ -94,35 +171,202 @@ func (d *Datastore) runLog(l *logfile) {
 	}
 }
 
+// shouldRotate returns true once the log is due to be compacted into a new
+// log, because it's too large or old, or holds many more entries than its
+// base backup.
+func (d *Datastore) shouldRotate(l *logfile) bool {
+	now := time.Now()
+	// log names have a resolution of a second
+	if now.Unix() <= l.ts {
+		return false
+	}
+
+	switch {
+	case d.opts.maxLogSize > 0 && l.size >= d.opts.maxLogSize:
+		return true
+	case d.opts.maxLogAge > 0 && now.Sub(time.Unix(l.ts, 0)) >= d.opts.maxLogAge:
+		return true
+	case l.size >= minCompactSize && l.logEntries > l.baseEntries*int64(compactThresh):
+		return true
+	}
+	return false
+}
+
+// rotateLog writes a new log, starting from a backup of the datastore, and
+// hands it to the log writer. Holding the backup lock keeps out writes until
+// the log writer has the new log.
+func (d *Datastore) rotateLog() {
+	d.backupLk.Lock()
+	defer d.backupLk.Unlock()
+
+	select {
+	case <-d.closing:
+		return
+	default:
+	}
+
+	l, _, err := d.createLog(d.logdir)
+	select {
+	case d.swap <- logSwap{l: l, err: err}:
+	case <-d.closing:
+		if l != nil {
+			_ = l.Close()
+		}
+	}
+}
+
+// pruneLogs removes the oldest logs, keeping the current one and the
+// configured number of previous ones.
+func (d *Datastore) pruneLogs(current string) {
+	files, err := logFiles(d.logdir)
+	if err != nil {
+		log.Errorw("listing logs to prune", "error", err)
+		return
+	}
+
+	keep := d.opts.keepLogs + 1
+	for i := 0; i < len(files)-keep; i++ {
+		if files[i].name == current {
+			continue
+		}
+
+		p := filepath.Join(d.logdir, files[i].name)
+		log.Infow("removing old log", "file", p)
+		if err := os.Remove(p); err != nil {
+			log.Errorw("removing old log", "file", p, "error", err)
+		}
+	}
+}
+
+type logName struct {
+	name string
+	ts   int64
+}
+
+// logFiles returns the log files in logdir, oldest first.
+func logFiles(logdir string) ([]logName, error) {
+	files, err := ioutil.ReadDir(logdir)
+	if err != nil {
+		return nil, xerrors.Errorf("read logdir ('%s'): %w", logdir, err)
+	}
+
+	var out []logName
+	for _, file := range files {
+		fn := file.Name()
+		if !strings.HasSuffix(fn, logSuffix) {
+			log.Warn("logfile with wrong file extension", fn)
+			continue
+		}
+		sec, err := strconv.ParseInt(strings.TrimSuffix(fn, logSuffix), 10, 64)
+		if err != nil {
+			return nil, xerrors.Errorf("parsing logfile as a number: %w", err)
+		}
+
+		out = append(out, logName{name: fn, ts: sec})
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].ts < out[j].ts
+	})
+	return out, nil
+}
+
 type logfile struct {
 	file *os.File
+	w    *bufio.Writer
+
+	name string
+	// ts is the creation time of the log, from its name
+	ts int64
+
+	size                    int64
+	baseEntries, logEntries int64
+	// pending is the number of entries written since the last sync
+	pending int
+}
+
+// newLogfile returns a log writing to f through sink, which encrypts entries
+// for encrypted logs.
+func newLogfile(f *os.File, sink io.Writer, size, baseEntries, logEntries int64) (*logfile, error) {
+	name := filepath.Base(f.Name())
+	ts, err := strconv.ParseInt(strings.TrimSuffix(name, logSuffix), 10, 64)
+	if err != nil {
+		return nil, xerrors.Errorf("parsing logfile as a number: %w", err)
+	}
+
+	return &logfile{
+		file:        f,
+		w:           bufio.NewWriterSize(sink, 64<<10),
+		name:        name,
+		ts:          ts,
+		size:        size,
+		baseEntries: baseEntries,
+		logEntries:  logEntries,
+	}, nil
 }
 
 var compactThresh = 2
 
+// createLog creates a new log, starting from a backup of the datastore. The
+// caller must hold backupLk for writing, or have no writers yet.
 func (d *Datastore) createLog(logdir string) (*logfile, string, error) {
 	ctx := context.TODO()
-	p := filepath.Join(logdir, strconv.FormatInt(time.Now().Unix(), 10)+".log.cbor")
-	log.Infow("creating log", "file", p)
-
-	f, err := os.OpenFile(p, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+	// a log compacted within the second it was created in takes the next
+	// name, logs are ordered by name
+	var p string
+	var f *os.File
+	var err error
+	for ts := time.Now().Unix(); ; ts++ {
+		p = filepath.Join(logdir, strconv.FormatInt(ts, 10)+logSuffix)
+		f, err = os.OpenFile(p, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+		if !os.IsExist(err) {
+			break
+		}
+	}
 	if err != nil {
 		return nil, "", err
 	}
+	log.Infow("creating log", "file", p)
+
+	var sink io.Writer = f
+	if d.opts.key != nil {
+		if sink, err = newEncWriter(f, d.opts.key); err != nil {
+			_ = f.Close()
+			_ = os.Remove(p)
+			return nil, "", xerrors.Errorf("writing log encryption header: %w", err)
+		}
+	}
 
-	if err := d.Backup(ctx, f); err != nil {
+	bw := bufio.NewWriterSize(sink, 64<<10)
+	entries, err := d.backup(ctx, bw)
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err != nil {
+		_ = f.Close()
+		_ = os.Remove(p)
 		return nil, "", xerrors.Errorf("writing log base: %w", err)
 	}
 	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		_ = os.Remove(p)
 		return nil, "", xerrors.Errorf("sync log base: %w", err)
 	}
+
+	size, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		_ = f.Close()
+		return nil, "", xerrors.Errorf("get log base size: %w", err)
+	}
 	log.Infow("log opened", "file", p)
 
-	return &logfile{
-		file: f,
-	}, filepath.Base(p), nil
+	l, err := newLogfile(f, sink, size, entries, 0)
+	if err != nil {
+		_ = f.Close()
+		return nil, "", err
+	}
+	return l, l.name, nil
 }
-
 func (d *Datastore) openLog(p string) (*logfile, string, error) {
 	ctx := context.TODO()
 	log.Infow("opening log", "file", p)
@@ -147,8 +391,13 @@ func (d *Datastore) openLog(p string) (*logfile, string, error) {
 
 	var lastLogHead string
 	var openCount, vals, logvals int64
+	pr, dr, err := openBackup(f, d.opts.keys)
+	if err != nil {
+		return nil, "", xerrors.Errorf("opening logfile: %w", err)
+	}
+
 	// check file integrity
-	clean, err := ReadBackup(f, func(k datastore.Key, v []byte, log bool) error {
+	clean, err := readBackup(pr, func(k datastore.Key, v []byte, log bool) error {
 		if log {
 			logvals++
 		} else {
@@ -180,9 +429,16 @@ func (d *Datastore) openLog(p string) (*logfile, string, error) {
 		return nil, "", xerrors.Errorf("logfile %s validated %d bytes, but the file has %d bytes (%d more)", p, at, end, end-at)
 	}
 
+	var logKey *Key
+	if dr != nil {
+		logKey = dr.key
+	}
+	// logs encrypted differently than configured are rewritten
+	reencrypt := !logKey.same(d.opts.key)
+
 	compact := logvals > vals*int64(compactThresh)
-	if compact || !clean {
-		log.Infow("compacting log", "current", p, "openCount", openCount, "baseValues", vals, "logValues", logvals, "truncated", !clean)
+	if compact || !clean || reencrypt {
+		log.Infow("compacting log", "current", p, "openCount", openCount, "baseValues", vals, "logValues", logvals, "truncated", !clean, "reencrypt", reencrypt)
 		if err := f.Close(); err != nil {
 			return nil, "", xerrors.Errorf("closing current log: %w", err)
 		}
@@ -209,9 +465,17 @@ func (d *Datastore) openLog(p string) (*logfile, string, error) {
 
 	// todo: maybe write a magic 'opened at' entry; pad the log to filesystem page to prevent more exotic types of corruption
 
-	return &logfile{
-		file: f,
-	}, filepath.Base(p), nil
+	var sink io.Writer = f
+	if dr != nil {
+		sink = dr.resume(f)
+	}
+
+	l, err := newLogfile(f, sink, end, vals, logvals)
+	if err != nil {
+		_ = f.Close()
+		return nil, "", err
+	}
+	return l, l.name, nil
 }
 
 func (l *logfile) writeLogHead(logname string, ds datastore.Batching) error {
@@ -237,17 +501,47 @@ func (l *logfile) writeLogHead(logname string, ds datastore.Batching) error {
 }
 
 func (l *logfile) writeEntry(e *Entry) error {
-	// todo: maybe marshal to some temp buffer, then put into the file?
-	if err := e.MarshalCBOR(l.file); err != nil {
+	if err := e.MarshalCBOR(l); err != nil {
 		return xerrors.Errorf("writing log entry: %w", err)
 	}
 
+	l.logEntries++
+	l.pending++
+	return nil
+}
+
+// Write implements io.Writer, buffering writes to the log file.
+func (l *logfile) Write(p []byte) (int, error) {
+	n, err := l.w.Write(p)
+	l.size += int64(n)
+	return n, err
+}
+
+// flush writes buffered entries to the log file and syncs it.
+func (l *logfile) flush() error {
+	if l.pending == 0 && l.w.Buffered() == 0 {
+		return nil
+	}
+
+	if err := l.w.Flush(); err != nil {
+		return xerrors.Errorf("writing log: %w", err)
+	}
+	if err := l.file.Sync(); err != nil {
+		return xerrors.Errorf("syncing log: %w", err)
+	}
+
+	l.pending = 0
 	return nil
 }
 
 func (l *logfile) Close() error {
 	// todo: maybe write a magic 'close at' entry; pad the log to filesystem page to prevent more exotic types of corruption
 
+	if err := l.flush(); err != nil {
+		_ = l.file.Close()
+		return err
+	}
+
 	if err := l.file.Close(); err != nil {
 		return err
 	}
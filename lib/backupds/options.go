@@ -0,0 +1,73 @@
+package backupds
+
+import "time"
+
+type options struct {
+	flushInterval time.Duration
+	maxLogSize    int64
+	maxLogAge     time.Duration
+	keepLogs      int
+
+	key  *Key
+	keys *Keyring
+}
+
+func defaultOptions() options {
+	return options{
+		flushInterval: 10 * time.Millisecond,
+		maxLogSize:    64 << 20,
+		maxLogAge:     7 * 24 * time.Hour,
+		keepLogs:      1,
+	}
+}
+
+// Option configures the log of a Datastore.
+type Option func(*options)
+
+// WithFlushInterval sets how long log entries may be buffered before they're
+// written and synced to disk. Entries waiting to be logged are always
+// written together. 0 syncs after every group of entries.
+func WithFlushInterval(d time.Duration) Option {
+	return func(o *options) {
+		o.flushInterval = d
+	}
+}
+
+// WithMaxLogSize sets the size above which the log is compacted into a new
+// log, starting from a fresh backup of the datastore. 0 disables the limit.
+func WithMaxLogSize(n int64) Option {
+	return func(o *options) {
+		o.maxLogSize = n
+	}
+}
+
+// WithMaxLogAge sets the age after which the log is compacted into a new log.
+// 0 disables the limit.
+func WithMaxLogAge(d time.Duration) Option {
+	return func(o *options) {
+		o.maxLogAge = d
+	}
+}
+
+// WithKeepLogs sets the number of previous logs kept after compaction, older
+// ones are removed.
+func WithKeepLogs(n int) Option {
+	return func(o *options) {
+		o.keepLogs = n
+	}
+}
+
+// WithEncryption encrypts backups and new logs with k. Existing logs
+// encrypted differently are compacted into a new log when they're opened.
+func WithEncryption(k *Key) Option {
+	return func(o *options) {
+		o.key = k
+	}
+}
+
+// WithKeyring sets the keys existing encrypted logs are read with.
+func WithKeyring(kr *Keyring) Option {
+	return func(o *options) {
+		o.keys = kr
+	}
+}
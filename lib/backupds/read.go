@@ -6,6 +6,7 @@ import (
 	"crypto/sha256"
 	"io"
 	"os"
+	"path/filepath"
 
 	"github.com/ipfs/go-datastore"
 	cbg "github.com/whyrusleeping/cbor-gen"
@@ -13,6 +14,21 @@ import (
 )
 
 func ReadBackup(r io.Reader, cb func(key datastore.Key, value []byte, log bool) error) (bool, error) {
+	return ReadBackupWithKeys(r, nil, cb)
+}
+
+// ReadBackupWithKeys reads a backup like ReadBackup, decrypting it with a key
+// from kr if it's encrypted.
+func ReadBackupWithKeys(r io.Reader, kr *Keyring, cb func(key datastore.Key, value []byte, log bool) error) (bool, error) {
+	pr, _, err := openBackup(r, kr)
+	if err != nil {
+		return false, err
+	}
+
+	return readBackup(pr, cb)
+}
+
+func readBackup(r io.Reader, cb func(key datastore.Key, value []byte, log bool) error) (bool, error) {
 	scratch := make([]byte, 9)
 
 	// read array[2](
@@ -85,11 +101,12 @@ func ReadBackup(r io.Reader, cb func(key datastore.Key, value []byte, log bool)
 	bp := cbg.GetPeeker(r)
 	for {
 		_, err := bp.ReadByte()
-		switch err {
-		case io.EOF, io.ErrUnexpectedEOF:
+		switch {
+		case err == io.EOF || err == io.ErrUnexpectedEOF:
 			return true, nil
-		case nil:
-		default:
+		case xerrors.Is(err, errTruncatedChunk):
+			return truncatedLog(err)
+		case err != nil:
 			return false, xerrors.Errorf("peek log: %w", err)
 		}
 		if err := bp.UnreadByte(); err != nil {
@@ -97,13 +114,9 @@ func ReadBackup(r io.Reader, cb func(key datastore.Key, value []byte, log bool)
 		}
 
 		if err := ent.UnmarshalCBOR(bp); err != nil {
-			switch err {
-			case io.EOF, io.ErrUnexpectedEOF:
-				if os.Getenv("LOTUS_ALLOW_TRUNCATED_LOG") == "1" {
-					log.Errorw("log entry potentially truncated")
-					return false, nil
-				}
-				return false, xerrors.Errorf("log entry potentially truncated, set LOTUS_ALLOW_TRUNCATED_LOG=1 to proceed: %w", err)
+			switch {
+			case err == io.EOF || err == io.ErrUnexpectedEOF || xerrors.Is(err, errTruncatedChunk):
+				return truncatedLog(err)
 			default:
 				return false, xerrors.Errorf("unmarshaling log entry: %w", err)
 			}
@@ -117,6 +130,19 @@ func ReadBackup(r io.Reader, cb func(key datastore.Key, value []byte, log bool)
 	}
 }
 
+// truncatedLog handles a log ending in a partial entry, which is ignored only
+// when the user opted in.
+func truncatedLog(err error) (bool, error) {
+	// LOTUS_ALLOW_TRUNCATED_LOG is the deprecated name, ignored like other
+	// LOTUS_ variables when DBRIDGE_LEGACY_ENV=0 (see config.LegacyEnvToggle)
+	legacy := os.Getenv("DBRIDGE_LEGACY_ENV") != "0" && os.Getenv("LOTUS_ALLOW_TRUNCATED_LOG") == "1"
+	if os.Getenv("DBRIDGE_ALLOW_TRUNCATED_LOG") == "1" || legacy {
+		log.Errorw("log entry potentially truncated")
+		return false, nil
+	}
+	return false, xerrors.Errorf("log entry potentially truncated, set DBRIDGE_ALLOW_TRUNCATED_LOG=1 to proceed: %w", err)
+}
+
 func RestoreInto(r io.Reader, dest datastore.Batching) error {
 	batch, err := dest.Batch(context.TODO())
 	if err != nil {
@@ -140,3 +166,18 @@ func RestoreInto(r io.Reader, dest datastore.Batching) error {
 
 	return nil
 }
+
+// LatestLog returns the path of the most recent log file in the kvlog
+// directory logdir. Each log file starts with a full backup of the datastore,
+// so the latest one holds all entries.
+func LatestLog(logdir string) (string, error) {
+	files, err := logFiles(logdir)
+	if err != nil {
+		return "", err
+	}
+
+	if len(files) == 0 {
+		return "", xerrors.Errorf("no log files in %s", logdir)
+	}
+	return filepath.Join(logdir, files[len(files)-1].name), nil
+}
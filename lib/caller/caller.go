@@ -0,0 +1,79 @@
+// Package caller identifies who made an API request, for the components which
+// act on it, like the audit log and the rate limiter.
+package caller
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// Caller identifies who made an API request.
+type Caller struct {
+	TokenID  string
+	Label    string
+	Role     string
+	CertName string
+	Remote   string
+}
+
+type callerKey struct{}
+
+func WithCaller(ctx context.Context, c Caller) context.Context {
+	return context.WithValue(ctx, callerKey{}, c)
+}
+
+func FromContext(ctx context.Context) Caller {
+	c, _ := ctx.Value(callerKey{}).(Caller)
+	return c
+}
+
+// Handler records the caller of each request in the request context.
+//
+// It must be wrapped by a handler which verifies API tokens, as the token
+// claims are read without verification.
+func Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c := Caller{Remote: r.RemoteAddr}
+
+		token := r.Header.Get("Authorization")
+		if token == "" {
+			token = r.FormValue("token")
+		}
+		if token != "" {
+			claims := tokenClaims(strings.TrimPrefix(token, "Bearer "))
+			c.TokenID, c.Label, c.Role = claims.ID, claims.Label, claims.Role
+		}
+
+		if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+			c.CertName = r.TLS.VerifiedChains[0][0].Subject.CommonName
+		}
+
+		next.ServeHTTP(w, r.WithContext(WithCaller(r.Context(), c)))
+	})
+}
+
+type claims struct {
+	ID    string `json:"jti"`
+	Label string
+	Role  string
+}
+
+func tokenClaims(token string) claims {
+	var c claims
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return c
+	}
+
+	pb, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return c
+	}
+
+	_ = json.Unmarshal(pb, &c) // best effort, the token was already verified
+	return c
+}
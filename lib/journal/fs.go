@@ -0,0 +1,287 @@
+package journal
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// RFC3339nocolon is the timestamp format of journal file names, fixed width so
+// that the files sort by creation time.
+const RFC3339nocolon = "2006-01-02T150405.000000000Z0700"
+
+const (
+	filePrefix = "dbridge-journal-"
+	fileSuffix = ".ndjson"
+)
+
+// recentSize is the number of events kept in memory for Recent.
+const recentSize = 1024
+
+// fsJournal is a basic journal backed by NDJSON files on a filesystem. A new
+// file is started each time the journal is opened, and whenever the current
+// file grows past the size limit.
+type fsJournal struct {
+	EventTypeRegistry
+
+	dir       string
+	sizeLimit int64
+	maxFiles  int
+
+	fi    *os.File
+	fSize int64
+
+	recentLk sync.Mutex
+	recent   []Event
+
+	incoming chan *Event
+	// dropped counts the events discarded since the last write, as the queue
+	// was full
+	dropped int64
+
+	closing chan struct{}
+	closed  chan struct{}
+}
+
+// OpenFSJournal constructs a rotating filesystem journal in dir. When
+// maxFiles is non-zero, the oldest files are removed on rotation so that at
+// most maxFiles remain.
+func OpenFSJournal(dir string, sizeLimit int64, maxFiles int, disabled DisabledEvents) (Journal, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, xerrors.Errorf("failed to mk directory %s for file journal: %w", dir, err)
+	}
+
+	f := &fsJournal{
+		EventTypeRegistry: NewEventTypeRegistry(disabled),
+		dir:               dir,
+		sizeLimit:         sizeLimit,
+		maxFiles:          maxFiles,
+		incoming:          make(chan *Event, 32),
+		closing:           make(chan struct{}),
+		closed:            make(chan struct{}),
+	}
+
+	// carry over the tail of the previous run, so that Recent covers events
+	// leading up to a restart
+	if err := f.loadRecent(); err != nil {
+		log.Warnw("failed to load recent journal events", "error", err)
+	}
+
+	if err := f.rollJournalFile(); err != nil {
+		return nil, err
+	}
+
+	go f.runLoop()
+
+	return f, nil
+}
+
+func (f *fsJournal) RecordEvent(evtType EventType, supplier func() interface{}) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Warnf("recovered from panic while recording journal event; type=%s, err=%v", evtType, r)
+		}
+	}()
+
+	if !evtType.Enabled() {
+		return
+	}
+
+	je := &Event{
+		EventType: evtType,
+		Timestamp: time.Now(),
+		Data:      supplier(),
+	}
+	// never block the caller, events may be recorded on hot paths like the
+	// pubsub validation pipeline
+	select {
+	case f.incoming <- je:
+	case <-f.closing:
+		log.Warnw("journal closed but tried to log event", "event", je)
+	default:
+		atomic.AddInt64(&f.dropped, 1)
+	}
+}
+
+func (f *fsJournal) Recent(limit int) []Event {
+	f.recentLk.Lock()
+	defer f.recentLk.Unlock()
+
+	start := 0
+	if limit > 0 && limit < len(f.recent) {
+		start = len(f.recent) - limit
+	}
+
+	out := make([]Event, len(f.recent)-start)
+	copy(out, f.recent[start:])
+	return out
+}
+
+func (f *fsJournal) Close() error {
+	close(f.closing)
+	<-f.closed
+	return nil
+}
+
+func (f *fsJournal) addRecent(evt Event) {
+	f.recentLk.Lock()
+	defer f.recentLk.Unlock()
+
+	if len(f.recent) >= recentSize {
+		f.recent = append(f.recent[:0], f.recent[1:]...)
+	}
+	f.recent = append(f.recent, evt)
+}
+
+func (f *fsJournal) putEvent(evt *Event) error {
+	if n := atomic.SwapInt64(&f.dropped, 0); n > 0 {
+		log.Warnw("journal queue was full, dropped events", "count", n)
+	}
+
+	f.addRecent(*evt)
+
+	b, err := json.Marshal(evt)
+	if err != nil {
+		return err
+	}
+	n, err := f.fi.Write(append(b, '\n'))
+	if err != nil {
+		return err
+	}
+
+	f.fSize += int64(n)
+
+	if f.sizeLimit > 0 && f.fSize >= f.sizeLimit {
+		return f.rollJournalFile()
+	}
+
+	return nil
+}
+
+func (f *fsJournal) rollJournalFile() error {
+	if f.fi != nil {
+		_ = f.fi.Close()
+	}
+
+	name := filePrefix + time.Now().UTC().Format(RFC3339nocolon) + fileSuffix
+	nfi, err := os.OpenFile(filepath.Join(f.dir, name), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return xerrors.Errorf("failed to open journal file: %w", err)
+	}
+
+	f.fi = nfi
+	f.fSize = 0
+
+	if f.maxFiles > 0 {
+		files, err := journalFiles(f.dir)
+		if err != nil {
+			return err
+		}
+		for len(files) > f.maxFiles {
+			if err := os.Remove(files[0]); err != nil {
+				return xerrors.Errorf("removing old journal file: %w", err)
+			}
+			files = files[1:]
+		}
+	}
+
+	return nil
+}
+
+// loadRecent fills the recent events from the newest journal files, going back
+// as many files as needed, as the last one may have only just been started.
+func (f *fsJournal) loadRecent() error {
+	files, err := journalFiles(f.dir)
+	if err != nil {
+		return err
+	}
+
+	var loaded [][]Event
+	var n int
+	for i := len(files) - 1; i >= 0 && n < recentSize; i-- {
+		evts, err := readEvents(files[i])
+		if err != nil {
+			return err
+		}
+		loaded = append(loaded, evts)
+		n += len(evts)
+	}
+
+	for i := len(loaded) - 1; i >= 0; i-- {
+		for _, evt := range loaded[i] {
+			f.addRecent(evt)
+		}
+	}
+	return nil
+}
+
+func readEvents(path string) ([]Event, error) {
+	fi, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fi.Close() //nolint:errcheck
+
+	var out []Event
+	sc := bufio.NewScanner(fi)
+	sc.Buffer(nil, 16<<20)
+	for sc.Scan() {
+		var evt Event
+		if err := json.Unmarshal(sc.Bytes(), &evt); err != nil {
+			// the node may have been killed halfway through a write
+			continue
+		}
+		out = append(out, evt)
+	}
+	return out, sc.Err()
+}
+
+func (f *fsJournal) runLoop() {
+	defer close(f.closed)
+
+	for {
+		select {
+		case je := <-f.incoming:
+			if err := f.putEvent(je); err != nil {
+				log.Errorw("failed to write out journal event", "event", je, "err", err)
+			}
+		case <-f.closing:
+			// write out events which were queued before closing
+			for len(f.incoming) > 0 {
+				je := <-f.incoming
+				if err := f.putEvent(je); err != nil {
+					log.Errorw("failed to write out journal event", "event", je, "err", err)
+				}
+			}
+			_ = f.fi.Close()
+			return
+		}
+	}
+}
+
+// journalFiles returns the paths of the journal files in dir, oldest first.
+func journalFiles(dir string) ([]string, error) {
+	ents, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, xerrors.Errorf("listing journal files: %w", err)
+	}
+
+	var out []string
+	for _, ent := range ents {
+		if ent.IsDir() || !strings.HasPrefix(ent.Name(), filePrefix) || !strings.HasSuffix(ent.Name(), fileSuffix) {
+			continue
+		}
+		out = append(out, filepath.Join(dir, ent.Name()))
+	}
+	sort.Strings(out)
+	return out, nil
+}
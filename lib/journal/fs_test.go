@@ -0,0 +1,111 @@
+package journal
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// recordEvents records the events numbered from to to-1.
+func recordEvents(t *testing.T, j Journal, from, to int) {
+	et := j.RegisterEventType("test", "event")
+	for i := from; i < to; i++ {
+		i := i
+		j.RecordEvent(et, func() interface{} {
+			return fmt.Sprintf("event %d", i)
+		})
+	}
+}
+
+func TestRotation(t *testing.T) {
+	tests := []struct {
+		name      string
+		sizeLimit int64
+		maxFiles  int
+		events    int
+
+		files int
+	}{
+		{name: "no size limit", sizeLimit: 0, events: 10, files: 1},
+		{name: "file per event", sizeLimit: 1, events: 10, files: 11},
+		{name: "max files", sizeLimit: 1, maxFiles: 3, events: 10, files: 3},
+		{name: "max files not reached", sizeLimit: 1, maxFiles: 20, events: 10, files: 11},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			j, err := OpenFSJournal(dir, tc.sizeLimit, tc.maxFiles, nil)
+			require.NoError(t, err)
+			recordEvents(t, j, 0, tc.events)
+			require.NoError(t, j.Close())
+
+			files, err := journalFiles(dir)
+			require.NoError(t, err)
+			require.Len(t, files, tc.files)
+		})
+	}
+}
+
+func TestLoadRecent(t *testing.T) {
+	tests := []struct {
+		name      string
+		sizeLimit int64
+		maxFiles  int
+		events    int
+
+		// events expected back after reopening, the newest ones
+		recent int
+	}{
+		{name: "single file", sizeLimit: 0, events: 10, recent: 10},
+		{name: "rotated files", sizeLimit: 1, events: 10, recent: 10},
+		{name: "pruned files", sizeLimit: 1, maxFiles: 4, events: 10, recent: 3},
+		{name: "over recent size", sizeLimit: 0, events: recentSize + 10, recent: recentSize},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			j, err := OpenFSJournal(dir, tc.sizeLimit, tc.maxFiles, nil)
+			require.NoError(t, err)
+			// stay under the queue size, so that no events are dropped
+			for from := 0; from < tc.events; from += 16 {
+				to := from + 16
+				if to > tc.events {
+					to = tc.events
+				}
+				recordEvents(t, j, from, to)
+				require.Eventually(t, func() bool { return len(j.(*fsJournal).incoming) == 0 }, time.Second, time.Millisecond)
+			}
+			require.NoError(t, j.Close())
+
+			j, err = OpenFSJournal(dir, tc.sizeLimit, tc.maxFiles, nil)
+			require.NoError(t, err)
+			defer j.Close() //nolint:errcheck
+
+			recent := j.Recent(0)
+			require.Len(t, recent, tc.recent)
+			for i, evt := range recent {
+				require.Equal(t, "test:event", evt.EventType.String())
+				require.Equal(t, fmt.Sprintf("event %d", tc.events-tc.recent+i), evt.Data)
+			}
+		})
+	}
+}
+
+func TestRecordEventQueueFull(t *testing.T) {
+	f := &fsJournal{
+		EventTypeRegistry: NewEventTypeRegistry(nil),
+		incoming:          make(chan *Event, 2),
+		closing:           make(chan struct{}),
+	}
+
+	// nothing drains the queue, recording must not block
+	recordEvents(t, f, 0, 5)
+	require.Len(t, f.incoming, 2)
+	require.EqualValues(t, 3, f.dropped)
+}
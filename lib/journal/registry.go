@@ -0,0 +1,50 @@
+package journal
+
+import "sync"
+
+// eventTypeRegistry is an embeddable mixin that takes care of tracking disabled
+// event types, and returning initialized/safe EventTypes when requested.
+type eventTypeRegistry struct {
+	sync.Mutex
+
+	disabled map[string]struct{}
+	m        map[string]EventType
+}
+
+var _ EventTypeRegistry = (*eventTypeRegistry)(nil)
+
+func NewEventTypeRegistry(disabled DisabledEvents) EventTypeRegistry {
+	ret := &eventTypeRegistry{
+		disabled: make(map[string]struct{}, len(disabled)),
+		m:        make(map[string]EventType, 32),
+	}
+
+	for _, et := range disabled {
+		ret.disabled[et.String()] = struct{}{}
+	}
+
+	return ret
+}
+
+func (d *eventTypeRegistry) RegisterEventType(system, event string) EventType {
+	d.Lock()
+	defer d.Unlock()
+
+	key := system + ":" + event
+	if et, ok := d.m[key]; ok {
+		return et
+	}
+
+	_, sysOff := d.disabled[system+":"]
+	_, evtOff := d.disabled[key]
+
+	et := EventType{
+		System:  system,
+		Event:   event,
+		enabled: !sysOff && !evtOff,
+		safe:    true,
+	}
+
+	d.m[key] = et
+	return et
+}
@@ -0,0 +1,115 @@
+// Package journal records structured system events, like peers connecting or
+// the node shutting down, to an append-only trail which operators can inspect
+// after the fact.
+package journal
+
+import (
+	"strings"
+	"time"
+
+	logging "github.com/ipfs/go-log/v2"
+	"golang.org/x/xerrors"
+)
+
+var log = logging.Logger("journal")
+
+// DisabledEvents is the set of event types whose journaling is suppressed.
+type DisabledEvents []EventType
+
+// ParseDisabledEvents parses a list of event types in the "system:event"
+// format into a DisabledEvents object. A bare "system" disables all events of
+// that system.
+func ParseDisabledEvents(events []string) (DisabledEvents, error) {
+	ret := make(DisabledEvents, 0, len(events))
+	for _, evt := range events {
+		evt = strings.TrimSpace(evt)
+		if evt == "" {
+			continue
+		}
+
+		s := strings.Split(evt, ":")
+		switch {
+		case len(s) == 1 && s[0] != "":
+			ret = append(ret, EventType{System: s[0]})
+		case len(s) == 2 && s[0] != "" && s[1] != "":
+			ret = append(ret, EventType{System: s[0], Event: s[1]})
+		default:
+			return nil, xerrors.Errorf("invalid event type %q, expected system:event", evt)
+		}
+	}
+	return ret, nil
+}
+
+// EventType represents the signature of an event.
+type EventType struct {
+	System string
+	Event  string
+
+	// enabled stores whether this event type is enabled.
+	enabled bool
+
+	// safe is a sentinel marker that's set to true if this EventType was
+	// constructed correctly (via Journal#RegisterEventType).
+	safe bool
+}
+
+func (et EventType) String() string {
+	return et.System + ":" + et.Event
+}
+
+// Enabled returns whether this event type is enabled in the journaling
+// subsystem. Users are advised to check this before actually attempting to
+// add a journal entry, as it helps bypass object construction for events that
+// would be discarded anyway.
+//
+// All event types are enabled by default, and specific event types can only
+// be disabled at Journal construction time.
+func (et EventType) Enabled() bool {
+	return et.safe && et.enabled
+}
+
+// EventTypeRegistry is a component that constructs tracked EventType tokens,
+// for usage with a Journal.
+type EventTypeRegistry interface {
+	// RegisterEventType introduces a new event type to a journal, and
+	// returns an EventType token that components can later use to check whether
+	// journalling for that type is enabled/suppressed, and to tag journal
+	// entries appropriately.
+	RegisterEventType(system, event string) EventType
+}
+
+// Journal represents an audit trail of system actions.
+//
+// Every entry is tagged with a timestamp, a system name, and an event name.
+// The supplied data can be any type, as long as it is JSON serializable,
+// including structs, map[string]interface{}, or primitive types.
+//
+// For cleanliness and type safety, we recommend to use typed events. See the
+// *Evt struct types in this package for more info.
+type Journal interface {
+	EventTypeRegistry
+
+	// RecordEvent records this event to the journal, if and only if the
+	// EventType is enabled. If so, it calls the supplier function to obtain
+	// the payload to record.
+	//
+	// Implementations MUST recover from panics raised by the supplier function.
+	RecordEvent(evtType EventType, supplier func() interface{})
+
+	// Recent returns up to limit of the most recently recorded events, oldest
+	// first.
+	Recent(limit int) []Event
+
+	// Close closes this journal for further writing.
+	Close() error
+}
+
+// Event represents a journal entry.
+//
+// See godocs on Journal for more information.
+type Event struct {
+	EventType
+
+	Timestamp time.Time
+	Data      interface{}
+}
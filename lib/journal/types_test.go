@@ -0,0 +1,51 @@
+package journal
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDisabledEvents(t *testing.T) {
+	tests := []struct {
+		in []string
+
+		expect DisabledEvents
+		err    bool
+	}{
+		{in: nil, expect: DisabledEvents{}},
+		{in: []string{"net:connect"}, expect: DisabledEvents{{System: "net", Event: "connect"}}},
+		{in: []string{"pubsub"}, expect: DisabledEvents{{System: "pubsub"}}},
+		{
+			in:     []string{" net:connect ", "", "pubsub"},
+			expect: DisabledEvents{{System: "net", Event: "connect"}, {System: "pubsub"}},
+		},
+		{in: []string{"net:"}, err: true},
+		{in: []string{":connect"}, err: true},
+		{in: []string{"net:connect:extra"}, err: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(fmt.Sprint(tc.in), func(t *testing.T) {
+			out, err := ParseDisabledEvents(tc.in)
+			if tc.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expect, out)
+		})
+	}
+}
+
+func TestDisabledEvents(t *testing.T) {
+	disabled, err := ParseDisabledEvents([]string{"net:connect", "pubsub"})
+	require.NoError(t, err)
+	reg := NewEventTypeRegistry(disabled)
+
+	require.False(t, reg.RegisterEventType("net", "connect").Enabled())
+	require.True(t, reg.RegisterEventType("net", "disconnect").Enabled())
+	require.False(t, reg.RegisterEventType("pubsub", "reject").Enabled())
+	require.False(t, EventType{System: "net", Event: "disconnect"}.Enabled())
+}
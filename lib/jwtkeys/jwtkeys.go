@@ -0,0 +1,166 @@
+// Package jwtkeys manages the set of HMAC keys API tokens are signed and
+// verified with. Tokens carry the ID of their signing key in the 'kid' header,
+// which allows rotating the signing key while tokens signed with previous keys
+// keep verifying until their key expires.
+package jwtkeys
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gbrlsnchs/jwt/v3"
+	"golang.org/x/xerrors"
+)
+
+// Key is a token signing key.
+type Key struct {
+	// ID is sent in the 'kid' header of tokens signed with the key. The key
+	// created before rotation was supported has an empty ID, and verifies
+	// tokens without a 'kid' header.
+	ID      string
+	Created time.Time
+	// Expires is set once the key is rotated out, after it tokens signed with
+	// the key no longer verify. Zero while the key is current.
+	Expires time.Time
+
+	Secret []byte `json:"-"`
+}
+
+func (k Key) Expired(now time.Time) bool {
+	return !k.Expires.IsZero() && now.After(k.Expires)
+}
+
+// KeySet is a set of keys, one of which is used for signing new tokens.
+type KeySet struct {
+	lk      sync.RWMutex
+	current string
+	keys    map[string]Key
+}
+
+// New creates a key set signing with current, and verifying with current and
+// all other keys which didn't expire yet.
+func New(current Key, others ...Key) *KeySet {
+	ks := &KeySet{
+		current: current.ID,
+		keys:    map[string]Key{current.ID: current},
+	}
+
+	now := time.Now()
+	for _, k := range others {
+		if k.Expired(now) {
+			continue
+		}
+		ks.keys[k.ID] = k
+	}
+
+	return ks
+}
+
+// Current returns the key used to sign new tokens.
+func (ks *KeySet) Current() Key {
+	ks.lk.RLock()
+	defer ks.lk.RUnlock()
+
+	return ks.keys[ks.current]
+}
+
+// Keys returns all keys in the set, ordered by creation time.
+func (ks *KeySet) Keys() []Key {
+	ks.lk.RLock()
+	defer ks.lk.RUnlock()
+
+	out := make([]Key, 0, len(ks.keys))
+	for _, k := range ks.keys {
+		out = append(out, k)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Created.Before(out[j].Created)
+	})
+	return out
+}
+
+// Rotate makes next the signing key. Keys which were in use until now keep
+// verifying tokens for the grace period, keys which already expired are
+// dropped from the set.
+func (ks *KeySet) Rotate(next Key, grace time.Duration) error {
+	ks.lk.Lock()
+	defer ks.lk.Unlock()
+
+	if _, ok := ks.keys[next.ID]; ok {
+		return xerrors.Errorf("key %q already in the set", next.ID)
+	}
+
+	now := time.Now()
+	expires := now.Add(grace)
+	for id, k := range ks.keys {
+		switch {
+		case k.Expired(now):
+			delete(ks.keys, id)
+		case k.Expires.IsZero() || k.Expires.After(expires):
+			k.Expires = expires
+			ks.keys[id] = k
+		}
+	}
+
+	ks.keys[next.ID] = next
+	ks.current = next.ID
+	return nil
+}
+
+// Sign signs the payload with the current key.
+func (ks *KeySet) Sign(payload interface{}) ([]byte, error) {
+	k := ks.Current()
+
+	var opts []jwt.SignOption
+	if k.ID != "" {
+		opts = append(opts, jwt.KeyID(k.ID))
+	}
+
+	return jwt.Sign(payload, jwt.NewHS256(k.Secret), opts...)
+}
+
+// Verify verifies the token with the key it was signed with, and decodes its
+// payload.
+func (ks *KeySet) Verify(token []byte, payload interface{}) error {
+	hd, err := decodeHeader(token)
+	if err != nil {
+		return err
+	}
+
+	ks.lk.RLock()
+	k, ok := ks.keys[hd.KeyID]
+	ks.lk.RUnlock()
+
+	if !ok {
+		return xerrors.Errorf("unknown signing key %q", hd.KeyID)
+	}
+	if k.Expired(time.Now()) {
+		return xerrors.Errorf("signing key %q expired at %s", hd.KeyID, k.Expires)
+	}
+
+	_, err = jwt.Verify(token, jwt.NewHS256(k.Secret), payload)
+	return err
+}
+
+func decodeHeader(token []byte) (jwt.Header, error) {
+	var hd jwt.Header
+
+	sep := bytes.IndexByte(token, '.')
+	if sep < 0 {
+		return hd, jwt.ErrMalformed
+	}
+
+	hb, err := base64.RawURLEncoding.DecodeString(string(token[:sep]))
+	if err != nil {
+		return hd, xerrors.Errorf("decoding token header: %w", err)
+	}
+
+	if err := json.Unmarshal(hb, &hd); err != nil {
+		return hd, xerrors.Errorf("decoding token header: %w", err)
+	}
+	return hd, nil
+}
@@ -0,0 +1,130 @@
+package ratelimit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+type holderKey struct{}
+
+// holder passes the error of a throttled call from the API proxy back to the
+// HTTP handler.
+type holder struct {
+	lk  sync.Mutex
+	err *Error
+}
+
+func (h *holder) set(err *Error) {
+	h.lk.Lock()
+	defer h.lk.Unlock()
+	h.err = err
+}
+
+func (h *holder) get() *Error {
+	h.lk.Lock()
+	defer h.lk.Unlock()
+	return h.err
+}
+
+func holderFrom(ctx context.Context) *holder {
+	h, _ := ctx.Value(holderKey{}).(*holder)
+	return h
+}
+
+// ErrorData is sent in the 'data' member of the JSON-RPC error of throttled
+// calls.
+type ErrorData struct {
+	Reason string  `json:"reason"`
+	Limit  float64 `json:"limit"`
+	// RetryAfter is in milliseconds
+	RetryAfter int64 `json:"retryAfter,omitempty"`
+}
+
+type rpcError struct {
+	Code    int       `json:"code"`
+	Message string    `json:"message"`
+	Data    ErrorData `json:"data"`
+}
+
+// Handler returns structured JSON-RPC errors, along with a 429 status, for
+// HTTP requests rejected by the limiter. Websocket connections are passed
+// through unchanged, calls made over them fail with a plain RPC error.
+func Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h := &holder{}
+		bw := &bufferedWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(bw, r.WithContext(context.WithValue(r.Context(), holderKey{}, h)))
+
+		terr := h.get()
+		if terr == nil {
+			bw.flush()
+			return
+		}
+
+		var resp map[string]json.RawMessage
+		if err := json.Unmarshal(bw.buf.Bytes(), &resp); err != nil {
+			bw.flush()
+			return
+		}
+
+		re := rpcError{
+			Code:    ErrCodeThrottled,
+			Message: terr.Error(),
+			Data: ErrorData{
+				Reason:     terr.Reason,
+				Limit:      terr.Limit,
+				RetryAfter: terr.RetryAfter.Milliseconds(),
+			},
+		}
+		eb, err := json.Marshal(&re)
+		if err != nil {
+			bw.flush()
+			return
+		}
+		resp["error"] = eb
+		delete(resp, "result")
+
+		out, err := json.Marshal(resp)
+		if err != nil {
+			bw.flush()
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if terr.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(terr.RetryAfter.Seconds()))))
+		}
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write(out)
+	})
+}
+
+type bufferedWriter struct {
+	http.ResponseWriter
+
+	status int
+	buf    bytes.Buffer
+}
+
+func (w *bufferedWriter) WriteHeader(status int) {
+	w.status = status
+}
+
+func (w *bufferedWriter) Write(b []byte) (int, error) {
+	return w.buf.Write(b)
+}
+
+func (w *bufferedWriter) flush() {
+	w.ResponseWriter.WriteHeader(w.status)
+	_, _ = w.ResponseWriter.Write(w.buf.Bytes())
+}
@@ -0,0 +1,82 @@
+package ratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+
+	"github.com/lyswifter/dbridge/api"
+	"github.com/lyswifter/dbridge/metrics"
+)
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// FullAPI applies the limiter to all calls to the API.
+func FullAPI(a api.FullNode, l *Limiter) api.FullNode {
+	var out api.FullNodeStruct
+	proxy(a, &out, l)
+	return &out
+}
+
+func proxy(in interface{}, outstr interface{}, l *Limiter) {
+	outs := api.GetInternalStructs(outstr)
+	for _, out := range outs {
+		rint := reflect.ValueOf(out).Elem()
+		ra := reflect.ValueOf(in)
+
+		for f := 0; f < rint.NumField(); f++ {
+			field := rint.Type().Field(f)
+			fn := ra.MethodByName(field.Name)
+
+			rint.Field(f).Set(reflect.MakeFunc(field.Type, func(args []reflect.Value) (results []reflect.Value) {
+				ctx := args[0].Interface().(context.Context)
+
+				release, limit, err := l.Acquire(ctx)
+				if err != nil {
+					return throttled(ctx, field.Name, field.Type, err.(*Error))
+				}
+				defer release()
+
+				results = fn.Call(args)
+
+				if limit.MaxResponseSize > 0 && len(results) > 1 && results[0].Kind() != reflect.Chan {
+					// the response is encoded once more by the RPC server, which
+					// is fine as limited responses are expected to be small
+					b, err := json.Marshal(results[0].Interface())
+					if err == nil && int64(len(b)) > limit.MaxResponseSize {
+						return throttled(ctx, field.Name, field.Type, &Error{
+							Reason: ReasonResponseSize,
+							Limit:  float64(limit.MaxResponseSize),
+						})
+					}
+				}
+
+				return results
+			}))
+		}
+	}
+}
+
+func throttled(ctx context.Context, method string, ft reflect.Type, err *Error) []reflect.Value {
+	ctx, _ = tag.New(ctx,
+		tag.Upsert(metrics.Endpoint, method),
+		tag.Upsert(metrics.ThrottleReason, err.Reason),
+	)
+	stats.Record(ctx, metrics.APIThrottled.M(1))
+
+	if h := holderFrom(ctx); h != nil {
+		h.set(err)
+	}
+
+	out := make([]reflect.Value, ft.NumOut())
+	for i := range out {
+		out[i] = reflect.Zero(ft.Out(i))
+	}
+	if last := len(out) - 1; last >= 0 && ft.Out(last) == errorType {
+		out[last] = reflect.ValueOf(error(err))
+	}
+	return out
+}
@@ -0,0 +1,239 @@
+// Package ratelimit limits the rate, concurrency and response size of API
+// calls made with each API token.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/filecoin-project/go-jsonrpc/auth"
+	"golang.org/x/xerrors"
+
+	"github.com/lyswifter/dbridge/api"
+	"github.com/lyswifter/dbridge/lib/caller"
+)
+
+// ErrCodeThrottled is the JSON-RPC error code of calls rejected by the
+// limiter. It lies in the range reserved for implementation-defined server
+// errors.
+const ErrCodeThrottled = -32029
+
+const (
+	ReasonRate         = "rate"
+	ReasonConcurrency  = "concurrency"
+	ReasonResponseSize = "response-size"
+)
+
+// Limit configures the limits applied to the calls made with a single token.
+// Zero values disable the respective limit.
+type Limit struct {
+	RequestsPerSecond float64
+	Burst             int
+	MaxConcurrent     int
+	MaxResponseSize   int64
+}
+
+// Error is returned for calls rejected by the limiter.
+type Error struct {
+	Reason string
+	// Limit is the value of the limit which was exceeded.
+	Limit float64
+	// RetryAfter is set for rate limited calls, and is the time after which
+	// the call is expected to succeed.
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("api %s limit exceeded (limit: %g)", e.Reason, e.Limit)
+	if e.RetryAfter > 0 {
+		msg += fmt.Sprintf(", retry after %s", e.RetryAfter.Round(time.Millisecond))
+	}
+	return msg
+}
+
+// Limiter tracks the calls made by each token. Tokens are limited by the
+// limits configured for their role, or for the highest permission level they
+// carry when there are none for the role.
+type Limiter struct {
+	limits map[string]Limit
+
+	lk        sync.Mutex
+	callers   map[string]*callerState
+	lastPrune time.Time
+}
+
+// pruneInterval is how often callers which are idle are forgotten, so that
+// tokens and certificates which were used once don't stay tracked forever.
+const pruneInterval = time.Minute
+
+// callerState is what the limiter tracks for each caller.
+type callerState struct {
+	limit Limit
+
+	// token bucket
+	tokens float64
+	last   time.Time
+
+	running int
+}
+
+func New(limits map[string]Limit) (*Limiter, error) {
+	if err := checkLimits(limits); err != nil {
+		return nil, err
+	}
+
+	return &Limiter{
+		limits:  limits,
+		callers: map[string]*callerState{},
+	}, nil
+}
+
+func checkLimits(limits map[string]Limit) error {
+	for class, l := range limits {
+		if l.RequestsPerSecond < 0 || l.Burst < 0 || l.MaxConcurrent < 0 || l.MaxResponseSize < 0 {
+			return xerrors.Errorf("rate limit '%s': limits can't be negative", class)
+		}
+	}
+	return nil
+}
+
+// SetLimits replaces the limits. Calls which are running keep counting
+// towards the concurrency limit of their caller.
+func (l *Limiter) SetLimits(limits map[string]Limit) error {
+	if err := checkLimits(limits); err != nil {
+		return err
+	}
+
+	l.lk.Lock()
+	defer l.lk.Unlock()
+
+	l.limits = limits
+
+	// callers are re-created with the new limits on their next call, unless
+	// they have calls running which still have to be released
+	for key, cl := range l.callers {
+		class := strings.SplitN(key, "/", 2)[0]
+		lim, ok := limits[class]
+		if !ok && cl.running == 0 {
+			delete(l.callers, key)
+			continue
+		}
+
+		cl.limit = lim
+		cl.tokens = math.Min(cl.tokens, burst(lim))
+	}
+
+	return nil
+}
+
+// class returns the key of the limits which apply to the caller, must be
+// called with the lock held.
+func (l *Limiter) class(ctx context.Context, c caller.Caller) (string, bool) {
+	if c.Role != "" {
+		if _, ok := l.limits[c.Role]; ok {
+			return c.Role, true
+		}
+	}
+
+	for i := len(api.AllPermissions) - 1; i >= 0; i-- {
+		p := api.AllPermissions[i]
+		if !auth.HasPerm(ctx, nil, p) {
+			continue
+		}
+		_, ok := l.limits[string(p)]
+		return string(p), ok
+	}
+
+	return "", false
+}
+
+// Acquire checks whether the caller in ctx may make another call. The
+// returned function must be called once the call is done.
+func (l *Limiter) Acquire(ctx context.Context) (release func(), limit Limit, err error) {
+	c := caller.FromContext(ctx)
+
+	l.lk.Lock()
+	defer l.lk.Unlock()
+
+	if now := time.Now(); now.Sub(l.lastPrune) >= pruneInterval {
+		l.prune(now)
+	}
+
+	class, ok := l.class(ctx, c)
+	if !ok {
+		return func() {}, Limit{}, nil
+	}
+
+	// tokens issued outside of the API, e.g. the CLI token, have no ID and
+	// share limits with other such callers of the same class
+	key := class + "/" + c.TokenID
+	if c.TokenID == "" && c.CertName != "" {
+		key = class + "/cert:" + c.CertName
+	}
+
+	cl, ok := l.callers[key]
+	if !ok {
+		lim := l.limits[class]
+		cl = &callerState{
+			limit:  lim,
+			tokens: burst(lim),
+			last:   time.Now(),
+		}
+		l.callers[key] = cl
+	}
+
+	if max := cl.limit.MaxConcurrent; max > 0 && cl.running >= max {
+		return nil, cl.limit, &Error{Reason: ReasonConcurrency, Limit: float64(max)}
+	}
+
+	if rps := cl.limit.RequestsPerSecond; rps > 0 {
+		now := time.Now()
+		cl.tokens = math.Min(burst(cl.limit), cl.tokens+now.Sub(cl.last).Seconds()*rps)
+		cl.last = now
+
+		if cl.tokens < 1 {
+			wait := time.Duration((1 - cl.tokens) / rps * float64(time.Second))
+			return nil, cl.limit, &Error{Reason: ReasonRate, Limit: rps, RetryAfter: wait}
+		}
+		cl.tokens--
+	}
+
+	cl.running++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.lk.Lock()
+			cl.running--
+			l.lk.Unlock()
+		})
+	}, cl.limit, nil
+}
+
+// prune forgets callers with no calls running and a full token bucket, which
+// are in the same state as callers which never made a call. Must be called
+// with the lock held.
+func (l *Limiter) prune(now time.Time) {
+	l.lastPrune = now
+
+	for key, cl := range l.callers {
+		if cl.running > 0 {
+			continue
+		}
+		if rps := cl.limit.RequestsPerSecond; rps > 0 && cl.tokens+now.Sub(cl.last).Seconds()*rps < burst(cl.limit) {
+			continue
+		}
+		delete(l.callers, key)
+	}
+}
+
+func burst(l Limit) float64 {
+	if l.Burst > 0 {
+		return float64(l.Burst)
+	}
+	return math.Max(1, l.RequestsPerSecond)
+}
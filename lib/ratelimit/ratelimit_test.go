@@ -0,0 +1,198 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/go-jsonrpc/auth"
+	"github.com/stretchr/testify/require"
+
+	"github.com/lyswifter/dbridge/api"
+	"github.com/lyswifter/dbridge/lib/caller"
+)
+
+func callerCtx(tokenID, role string, perms ...auth.Permission) context.Context {
+	ctx := auth.WithPerm(context.Background(), perms)
+	return caller.WithCaller(ctx, caller.Caller{TokenID: tokenID, Role: role})
+}
+
+var readPerms = []auth.Permission{api.PermRead}
+
+func TestAcquire(t *testing.T) {
+	tests := []struct {
+		name   string
+		limits map[string]Limit
+		ctx    context.Context
+		calls  int
+		// release calls once they are acquired
+		release bool
+
+		allowed int
+		reason  string
+	}{
+		{
+			name:    "no limits",
+			limits:  map[string]Limit{},
+			ctx:     callerCtx("a", "", readPerms...),
+			calls:   10,
+			allowed: 10,
+		},
+		{
+			name:    "burst",
+			limits:  map[string]Limit{"read": {RequestsPerSecond: 0.001, Burst: 3}},
+			ctx:     callerCtx("a", "", readPerms...),
+			calls:   5,
+			release: true,
+			allowed: 3,
+			reason:  ReasonRate,
+		},
+		{
+			name:    "concurrency",
+			limits:  map[string]Limit{"read": {MaxConcurrent: 2}},
+			ctx:     callerCtx("a", "", readPerms...),
+			calls:   4,
+			allowed: 2,
+			reason:  ReasonConcurrency,
+		},
+		{
+			name:    "concurrency released",
+			limits:  map[string]Limit{"read": {MaxConcurrent: 1}},
+			ctx:     callerCtx("a", "", readPerms...),
+			calls:   4,
+			release: true,
+			allowed: 4,
+		},
+		{
+			name: "role over permission",
+			limits: map[string]Limit{
+				"read":   {MaxConcurrent: 5},
+				"backup": {MaxConcurrent: 1},
+			},
+			ctx:     callerCtx("a", "backup", readPerms...),
+			calls:   3,
+			allowed: 1,
+			reason:  ReasonConcurrency,
+		},
+		{
+			name:    "highest permission",
+			limits:  map[string]Limit{"read": {MaxConcurrent: 1}, "admin": {MaxConcurrent: 3}},
+			ctx:     callerCtx("a", "", api.AllPermissions...),
+			calls:   3,
+			allowed: 3,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			l, err := New(tc.limits)
+			require.NoError(t, err)
+
+			var allowed int
+			var lastErr error
+			for i := 0; i < tc.calls; i++ {
+				release, _, err := l.Acquire(tc.ctx)
+				if err != nil {
+					lastErr = err
+					continue
+				}
+				allowed++
+				if tc.release {
+					release()
+				}
+			}
+
+			require.Equal(t, tc.allowed, allowed)
+			if tc.reason == "" {
+				require.NoError(t, lastErr)
+				return
+			}
+			require.IsType(t, &Error{}, lastErr)
+			require.Equal(t, tc.reason, lastErr.(*Error).Reason)
+		})
+	}
+}
+
+func TestAcquireSeparateCallers(t *testing.T) {
+	l, err := New(map[string]Limit{"read": {MaxConcurrent: 1}})
+	require.NoError(t, err)
+
+	_, _, err = l.Acquire(callerCtx("a", "", readPerms...))
+	require.NoError(t, err)
+	_, _, err = l.Acquire(callerCtx("b", "", readPerms...))
+	require.NoError(t, err)
+	_, _, err = l.Acquire(callerCtx("a", "", readPerms...))
+	require.Error(t, err)
+}
+
+func TestRetryAfter(t *testing.T) {
+	l, err := New(map[string]Limit{"read": {RequestsPerSecond: 10, Burst: 1}})
+	require.NoError(t, err)
+
+	ctx := callerCtx("a", "", readPerms...)
+	_, _, err = l.Acquire(ctx)
+	require.NoError(t, err)
+
+	_, _, err = l.Acquire(ctx)
+	require.IsType(t, &Error{}, err)
+	wait := err.(*Error).RetryAfter
+	require.True(t, wait > 0 && wait <= 100*time.Millisecond, "retry after %s", wait)
+
+	time.Sleep(wait + 10*time.Millisecond)
+	_, _, err = l.Acquire(ctx)
+	require.NoError(t, err)
+}
+
+func TestSetLimits(t *testing.T) {
+	l, err := New(map[string]Limit{"read": {MaxConcurrent: 1}})
+	require.NoError(t, err)
+
+	ctx := callerCtx("a", "", readPerms...)
+	release, _, err := l.Acquire(ctx)
+	require.NoError(t, err)
+	_, _, err = l.Acquire(ctx)
+	require.Error(t, err)
+
+	// the running call keeps counting towards the new limit
+	require.NoError(t, l.SetLimits(map[string]Limit{"read": {MaxConcurrent: 2}}))
+	release2, _, err := l.Acquire(ctx)
+	require.NoError(t, err)
+	_, _, err = l.Acquire(ctx)
+	require.Error(t, err)
+
+	release()
+	release2()
+
+	// without limits for the class, calls aren't limited
+	require.NoError(t, l.SetLimits(map[string]Limit{}))
+	for i := 0; i < 5; i++ {
+		_, _, err = l.Acquire(ctx)
+		require.NoError(t, err)
+	}
+
+	require.Error(t, l.SetLimits(map[string]Limit{"read": {Burst: -1}}))
+}
+
+func TestPruneIdleCallers(t *testing.T) {
+	l, err := New(map[string]Limit{"read": {RequestsPerSecond: 1000, Burst: 1, MaxConcurrent: 1}})
+	require.NoError(t, err)
+
+	release, _, err := l.Acquire(callerCtx("busy", "", readPerms...))
+	require.NoError(t, err)
+	defer release()
+
+	idle, _, err := l.Acquire(callerCtx("idle", "", readPerms...))
+	require.NoError(t, err)
+	idle()
+
+	time.Sleep(5 * time.Millisecond) // refill the bucket of the idle caller
+
+	l.lk.Lock()
+	l.prune(time.Now())
+	_, busy := l.callers["read/busy"]
+	_, stale := l.callers["read/idle"]
+	l.lk.Unlock()
+
+	require.True(t, busy)
+	require.False(t, stale)
+}
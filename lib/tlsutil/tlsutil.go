@@ -0,0 +1,162 @@
+package tlsutil
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/xerrors"
+)
+
+// selfSignedValidity is how long certificates created by GenerateSelfSigned
+// stay valid.
+const selfSignedValidity = 5 * 365 * 24 * time.Hour
+
+// GenerateSelfSigned creates a self-signed ECDSA certificate valid for the
+// given hosts (DNS names or IP addresses) and writes it, along with its private
+// key, as PEM files. The certificate is marked as a CA so that clients can pin
+// it directly as their trusted root.
+func GenerateSelfSigned(certPath, keyPath string, hosts []string) error {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return xerrors.Errorf("generating key: %w", err)
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return xerrors.Errorf("generating serial number: %w", err)
+	}
+
+	now := time.Now()
+	tmpl := x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			Organization: []string{"dbridge"},
+			CommonName:   "dbridge-api",
+		},
+		NotBefore: now.Add(-time.Hour),
+		NotAfter:  now.Add(selfSignedValidity),
+
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, h)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &tmpl, &tmpl, &priv.PublicKey, priv)
+	if err != nil {
+		return xerrors.Errorf("creating certificate: %w", err)
+	}
+
+	keyDer, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return xerrors.Errorf("marshaling private key: %w", err)
+	}
+
+	if err := writePEM(keyPath, "PRIVATE KEY", keyDer, 0600); err != nil {
+		return xerrors.Errorf("writing key: %w", err)
+	}
+	if err := writePEM(certPath, "CERTIFICATE", der, 0644); err != nil {
+		return xerrors.Errorf("writing certificate: %w", err)
+	}
+
+	return nil
+}
+
+func writePEM(path, typ string, der []byte, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), mode)
+}
+
+// ServerConfig builds the TLS configuration of an API listener. When clientCA
+// is set, client certificates are requested and verified against it; with
+// requireClientCert, connections without one are refused.
+func ServerConfig(certPath, keyPath, clientCA string, requireClientCert bool) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return nil, xerrors.Errorf("loading key pair: %w", err)
+	}
+
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if clientCA != "" {
+		pool, err := loadPool(clientCA)
+		if err != nil {
+			return nil, xerrors.Errorf("loading client CA: %w", err)
+		}
+
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+		if requireClientCert {
+			cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	} else if requireClientCert {
+		return nil, xerrors.New("client certificates are required, but no client CA is configured")
+	}
+
+	return cfg, nil
+}
+
+// ClientConfig builds the TLS configuration used to dial an API listener.
+// An empty ca uses the system roots; certPath and keyPath optionally set the
+// client certificate to present.
+func ClientConfig(ca, certPath, keyPath string) (*tls.Config, error) {
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if ca != "" {
+		pool, err := loadPool(ca)
+		if err != nil {
+			return nil, xerrors.Errorf("loading CA: %w", err)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if certPath != "" || keyPath != "" {
+		cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+		if err != nil {
+			return nil, xerrors.Errorf("loading client key pair: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
+
+func loadPool(path string) (*x509.CertPool, error) {
+	pemData, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pemData) {
+		return nil, xerrors.Errorf("no certificates found in %s", path)
+	}
+	return pool, nil
+}
@@ -0,0 +1,42 @@
+package tracing
+
+import (
+	"time"
+
+	logging "github.com/ipfs/go-log/v2"
+	"go.opencensus.io/trace"
+)
+
+var log = logging.Logger("tracing")
+
+// SlowSpanLogger is a trace exporter which logs spans that took longer than a
+// threshold, which makes slow API calls visible without a tracing backend.
+type SlowSpanLogger struct {
+	Threshold time.Duration
+}
+
+func (l *SlowSpanLogger) ExportSpan(s *trace.SpanData) {
+	took := s.EndTime.Sub(s.StartTime)
+	if took < l.Threshold {
+		return
+	}
+
+	log.Warnw("slow span", "name", s.Name, "took", took, "trace", s.TraceID, "status", s.Status.Message)
+}
+
+// SetupSlowSpanLogging samples all spans and registers a SlowSpanLogger. A
+// zero threshold leaves tracing untouched.
+func SetupSlowSpanLogging(threshold time.Duration) *SlowSpanLogger {
+	if threshold <= 0 {
+		return nil
+	}
+
+	exporter := &SlowSpanLogger{Threshold: threshold}
+	trace.RegisterExporter(exporter)
+	trace.ApplyConfig(trace.Config{
+		DefaultSampler: trace.AlwaysSample(),
+	})
+
+	log.Infof("logging spans slower than %s", threshold)
+	return exporter
+}
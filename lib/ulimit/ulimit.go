@@ -0,0 +1,83 @@
+// Package ulimit manages the open file descriptor limit of the process.
+package ulimit
+
+import (
+	"errors"
+	"syscall"
+
+	"golang.org/x/xerrors"
+)
+
+// ErrUnsupported is returned when the file descriptor limit can't be managed
+// on this platform.
+var ErrUnsupported = errors.New("unsupported")
+
+var (
+	supportsFDManagement = false
+
+	// getLimit returns the soft and hard limits of file descriptors counts
+	getLimit func() (uint64, uint64, error)
+	// set limit sets the soft and hard limits of file descriptors counts
+	setLimit func(uint64, uint64) error
+)
+
+// GetLimit returns the soft and hard limits of file descriptor counts.
+func GetLimit() (uint64, uint64, error) {
+	if !supportsFDManagement {
+		return 0, 0, ErrUnsupported
+	}
+	return getLimit()
+}
+
+// ManageFdLimit raises the soft file descriptor limit of the process to
+// target. When the process isn't allowed to raise the hard limit, the soft
+// limit is raised as far as the hard limit allows. It returns whether the
+// limit was changed, and the new soft limit.
+func ManageFdLimit(target uint64) (changed bool, newLimit uint64, err error) {
+	if !supportsFDManagement {
+		return false, 0, nil
+	}
+
+	soft, hard, err := getLimit()
+	if err != nil {
+		return false, 0, err
+	}
+
+	if target <= soft {
+		return false, soft, nil
+	}
+
+	// the soft limit is the value that the kernel enforces for the
+	// corresponding resource
+	// the hard limit acts as a ceiling for the soft limit
+	// an unprivileged process may only set it's soft limit to a
+	// value in the range from 0 up to the hard limit
+	// don't lower the hard limit when it's already above the target
+	newHard := hard
+	if target > newHard {
+		newHard = target
+	}
+
+	err = setLimit(target, newHard)
+	switch err {
+	case nil:
+		return true, target, nil
+	case syscall.EPERM:
+		// lower limit if necessary.
+		if target > hard {
+			target = hard
+		}
+		if target <= soft {
+			return false, soft, nil
+		}
+
+		// the process does not have permission so we should only
+		// set the soft value
+		if err := setLimit(target, hard); err != nil {
+			return false, soft, xerrors.Errorf("setting soft fd limit to %d: %w", target, err)
+		}
+		return true, target, nil
+	default:
+		return false, soft, xerrors.Errorf("setting fd limit to %d: %w", target, err)
+	}
+}
@@ -0,0 +1,134 @@
+package metrics
+
+import (
+	libp2pmetrics "github.com/libp2p/go-libp2p-core/metrics"
+	"github.com/libp2p/go-libp2p-core/peer"
+	pubsub "github.com/libp2p/go-libp2p-pubsub"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// BandwidthCollector exports the totals and rates of a libp2p bandwidth
+// reporter, broken down by protocol and by peer.
+type BandwidthCollector struct {
+	reporter libp2pmetrics.Reporter
+
+	protoTotal *prometheus.Desc
+	protoRate  *prometheus.Desc
+	peerTotal  *prometheus.Desc
+	peerRate   *prometheus.Desc
+}
+
+func NewBandwidthCollector(reporter libp2pmetrics.Reporter) *BandwidthCollector {
+	return &BandwidthCollector{
+		reporter: reporter,
+
+		protoTotal: prometheus.NewDesc(MetricName("bandwidth_protocol_bytes_total"),
+			"Total bytes transferred per libp2p protocol", []string{"protocol", "direction"}, nil),
+		protoRate: prometheus.NewDesc(MetricName("bandwidth_protocol_bytes_per_second"),
+			"Current transfer rate per libp2p protocol", []string{"protocol", "direction"}, nil),
+		peerTotal: prometheus.NewDesc(MetricName("bandwidth_peer_bytes_total"),
+			"Total bytes transferred per peer", []string{"peer", "direction"}, nil),
+		peerRate: prometheus.NewDesc(MetricName("bandwidth_peer_bytes_per_second"),
+			"Current transfer rate per peer", []string{"peer", "direction"}, nil),
+	}
+}
+
+func (c *BandwidthCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.protoTotal
+	ch <- c.protoRate
+	ch <- c.peerTotal
+	ch <- c.peerRate
+}
+
+func (c *BandwidthCollector) Collect(ch chan<- prometheus.Metric) {
+	for p, s := range c.reporter.GetBandwidthByProtocol() {
+		c.collectStats(ch, c.protoTotal, c.protoRate, string(p), s)
+	}
+
+	for p, s := range c.reporter.GetBandwidthByPeer() {
+		c.collectStats(ch, c.peerTotal, c.peerRate, p.Pretty(), s)
+	}
+}
+
+func (c *BandwidthCollector) collectStats(ch chan<- prometheus.Metric, total, rate *prometheus.Desc, label string, s libp2pmetrics.Stats) {
+	ch <- prometheus.MustNewConstMetric(total, prometheus.CounterValue, float64(s.TotalIn), label, "in")
+	ch <- prometheus.MustNewConstMetric(total, prometheus.CounterValue, float64(s.TotalOut), label, "out")
+	ch <- prometheus.MustNewConstMetric(rate, prometheus.GaugeValue, s.RateIn, label, "in")
+	ch <- prometheus.MustNewConstMetric(rate, prometheus.GaugeValue, s.RateOut, label, "out")
+}
+
+// scoreBuckets follow the pubsub score thresholds used by the node, so it is
+// easy to tell how many peers are being graylisted, gossip-restricted etc.
+var scoreBuckets = []float64{-2500, -1000, -500, -100, -10, 0, 1, 10, 100, 1000, 2500}
+
+// ScoreCollector exports the distribution of pubsub peer scores from the
+// latest peer score snapshot.
+type ScoreCollector struct {
+	scores func() map[peer.ID]*pubsub.PeerScoreSnapshot
+
+	score *prometheus.Desc
+}
+
+func NewScoreCollector(scores func() map[peer.ID]*pubsub.PeerScoreSnapshot) *ScoreCollector {
+	return &ScoreCollector{
+		scores: scores,
+
+		score: prometheus.NewDesc(MetricName("pubsub_peer_score"),
+			"Distribution of pubsub peer scores", nil, nil),
+	}
+}
+
+func (c *ScoreCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.score
+}
+
+func (c *ScoreCollector) Collect(ch chan<- prometheus.Metric) {
+	var (
+		count   uint64
+		sum     float64
+		buckets = make(map[float64]uint64, len(scoreBuckets))
+	)
+
+	for _, snap := range c.scores() {
+		count++
+		sum += snap.Score
+		for _, b := range scoreBuckets {
+			if snap.Score <= b {
+				buckets[b]++
+			}
+		}
+	}
+
+	ch <- prometheus.MustNewConstHistogram(c.score, count, sum, buckets)
+}
+
+// PeerCountCollector exports the number of peers the libp2p host is
+// connected to.
+type PeerCountCollector struct {
+	peers func() []peer.ID
+
+	count *prometheus.Desc
+}
+
+func NewPeerCountCollector(peers func() []peer.ID) *PeerCountCollector {
+	return &PeerCountCollector{
+		peers: peers,
+
+		count: prometheus.NewDesc(MetricName("peer_count"),
+			"Current number of dbridge peers", nil, nil),
+	}
+}
+
+func (c *PeerCountCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.count
+}
+
+func (c *PeerCountCollector) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(c.count, prometheus.GaugeValue, float64(len(c.peers())))
+}
+
+var (
+	_ prometheus.Collector = (*BandwidthCollector)(nil)
+	_ prometheus.Collector = (*ScoreCollector)(nil)
+	_ prometheus.Collector = (*PeerCountCollector)(nil)
+)
@@ -0,0 +1,116 @@
+package metrics
+
+import (
+	"net/http"
+	"regexp"
+	"sync"
+
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opencensus.io/stats/view"
+)
+
+var log = logging.Logger("metrics")
+
+// Namespace prefixes all metrics exported to Prometheus.
+const Namespace = "dbridge"
+
+var registerOnce sync.Once
+
+// Exporter returns the handler serving the Prometheus metrics endpoint. It
+// exposes all registered OpenCensus views, along with every collector added
+// to the default Prometheus registry.
+func Exporter() http.Handler {
+	registerOnce.Do(func() {
+		if err := prometheus.Register(&viewCollector{}); err != nil {
+			log.Errorf("registering OpenCensus view collector: %s", err)
+		}
+	})
+
+	return promhttp.Handler()
+}
+
+// viewCollector converts OpenCensus views into Prometheus metrics on scrape.
+type viewCollector struct{}
+
+// Describe is intentionally empty, views can be registered at any time, which
+// makes this an unchecked collector.
+func (c *viewCollector) Describe(chan<- *prometheus.Desc) {}
+
+func (c *viewCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, v := range DefaultViews {
+		if view.Find(v.Name) == nil {
+			continue // not registered
+		}
+
+		rows, err := view.RetrieveData(v.Name)
+		if err != nil {
+			log.Warnf("retrieving view %s: %s", v.Name, err)
+			continue
+		}
+
+		labels := make([]string, len(v.TagKeys))
+		for i, k := range v.TagKeys {
+			labels[i] = sanitize(k.Name())
+		}
+
+		help := v.Description
+		if help == "" {
+			help = v.Measure.Description()
+		}
+
+		desc := prometheus.NewDesc(MetricName(v.Name), help, labels, nil)
+
+		for _, row := range rows {
+			values := make([]string, len(v.TagKeys))
+			for i, k := range v.TagKeys {
+				for _, t := range row.Tags {
+					if t.Key == k {
+						values[i] = t.Value
+						break
+					}
+				}
+			}
+
+			m, err := toMetric(desc, v.Aggregation.Buckets, row.Data, values)
+			if err != nil {
+				log.Warnf("converting view %s: %s", v.Name, err)
+				continue
+			}
+			ch <- m
+		}
+	}
+}
+
+func toMetric(desc *prometheus.Desc, bounds []float64, data view.AggregationData, values []string) (prometheus.Metric, error) {
+	switch d := data.(type) {
+	case *view.CountData:
+		return prometheus.NewConstMetric(desc, prometheus.CounterValue, float64(d.Value), values...)
+	case *view.SumData:
+		return prometheus.NewConstMetric(desc, prometheus.UntypedValue, d.Value, values...)
+	case *view.LastValueData:
+		return prometheus.NewConstMetric(desc, prometheus.GaugeValue, d.Value, values...)
+	case *view.DistributionData:
+		buckets := make(map[float64]uint64, len(bounds))
+		var cumulative uint64
+		for i, b := range bounds {
+			cumulative += uint64(d.CountPerBucket[i])
+			buckets[b] = cumulative
+		}
+		return prometheus.NewConstHistogram(desc, uint64(d.Count), d.Mean*float64(d.Count), buckets, values...)
+	default:
+		return prometheus.NewInvalidMetric(desc, nil), nil
+	}
+}
+
+var invalidChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+func sanitize(name string) string {
+	return invalidChars.ReplaceAllString(name, "_")
+}
+
+// MetricName returns the namespaced Prometheus metric name for name.
+func MetricName(name string) string {
+	return Namespace + "_" + sanitize(name)
+}
@@ -0,0 +1,92 @@
+package metrics
+
+import (
+	"errors"
+	"strings"
+
+	metricsi "github.com/ipfs/go-metrics-interface"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// InjectIpfsMetrics backs go-metrics-interface with Prometheus, which makes
+// metrics created through it, like the datastore operation latencies recorded
+// by go-ds-measure, available on the metrics endpoint.
+//
+// It must be called before any of the instrumented components are created.
+func InjectIpfsMetrics() error {
+	err := metricsi.InjectImpl(func(name, helptext string) metricsi.Creator {
+		return &ipfsCreator{name: MetricName(strings.TrimPrefix(name, ".")), help: helptext}
+	})
+	if errors.Is(err, metricsi.ErrImplemented) {
+		return nil
+	}
+	return err
+}
+
+type ipfsCreator struct {
+	name string
+	help string
+}
+
+func (c *ipfsCreator) Counter() metricsi.Counter {
+	m := prometheus.NewCounter(prometheus.CounterOpts{
+		Name: c.name,
+		Help: c.help,
+	})
+	if existing, ok := register(m).(prometheus.Counter); ok {
+		return existing
+	}
+	return m
+}
+
+func (c *ipfsCreator) Gauge() metricsi.Gauge {
+	m := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: c.name,
+		Help: c.help,
+	})
+	if existing, ok := register(m).(prometheus.Gauge); ok {
+		return existing
+	}
+	return m
+}
+
+func (c *ipfsCreator) Histogram(buckets []float64) metricsi.Histogram {
+	m := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    c.name,
+		Help:    c.help,
+		Buckets: buckets,
+	})
+	if existing, ok := register(m).(prometheus.Histogram); ok {
+		return existing
+	}
+	return m
+}
+
+func (c *ipfsCreator) Summary(opts metricsi.SummaryOpts) metricsi.Summary {
+	m := prometheus.NewSummary(prometheus.SummaryOpts{
+		Name:       c.name,
+		Help:       c.help,
+		Objectives: opts.Objectives,
+		MaxAge:     opts.MaxAge,
+		AgeBuckets: opts.AgeBuckets,
+		BufCap:     opts.BufCap,
+	})
+	if existing, ok := register(m).(prometheus.Summary); ok {
+		return existing
+	}
+	return m
+}
+
+// register adds the collector to the default registry. Components may create
+// the same metric more than once (e.g. when a datastore is reopened), in which
+// case the already registered collector is returned, so it keeps being fed.
+func register(c prometheus.Collector) prometheus.Collector {
+	if err := prometheus.Register(c); err != nil {
+		var are prometheus.AlreadyRegisteredError
+		if errors.As(err, &are) {
+			return are.ExistingCollector
+		}
+		log.Errorf("registering metric: %s", err)
+	}
+	return c
+}
@@ -0,0 +1,139 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+// Distribution
+var defaultMillisecondsDistribution = view.Distribution(0.01, 0.05, 0.1, 0.3, 0.6, 0.8, 1, 2, 3, 4, 5, 6, 8, 10, 13, 16, 20, 25, 30, 40, 50, 65, 80, 100, 130, 160, 200, 250, 300, 400, 500, 650, 800, 1000, 2000, 3000, 4000, 5000, 7500, 10000, 20000, 50000, 100000)
+
+// Global Tags
+var (
+	Version, _  = tag.NewKey("version")
+	Commit, _   = tag.NewKey("commit")
+	NodeType, _ = tag.NewKey("node_type")
+
+	// api
+	Endpoint, _       = tag.NewKey("endpoint")
+	APIInterface, _   = tag.NewKey("api") // to distinguish between the local and remote api listeners
+	ThrottleReason, _ = tag.NewKey("reason")
+)
+
+// Measures
+var (
+	DbridgeInfo = stats.Int64("info", "Arbitrary counter to tag dbridge info to", stats.UnitDimensionless)
+
+	// pubsub
+	PubsubPublishMessage   = stats.Int64("pubsub/published", "Counter for total published messages", stats.UnitDimensionless)
+	PubsubDeliverMessage   = stats.Int64("pubsub/delivered", "Counter for total delivered messages", stats.UnitDimensionless)
+	PubsubRejectMessage    = stats.Int64("pubsub/rejected", "Counter for total rejected messages", stats.UnitDimensionless)
+	PubsubDuplicateMessage = stats.Int64("pubsub/duplicate", "Counter for total duplicate messages", stats.UnitDimensionless)
+	PubsubRecvRPC          = stats.Int64("pubsub/recv_rpc", "Counter for total received RPCs", stats.UnitDimensionless)
+	PubsubSendRPC          = stats.Int64("pubsub/send_rpc", "Counter for total sent RPCs", stats.UnitDimensionless)
+	PubsubDropRPC          = stats.Int64("pubsub/drop_rpc", "Counter for total dropped RPCs", stats.UnitDimensionless)
+
+	// api
+	APIRequestDuration = stats.Float64("api/request_duration_ms", "Duration of API requests", stats.UnitMilliseconds)
+	APIRequests        = stats.Int64("api/requests", "Counter of API requests", stats.UnitDimensionless)
+	APIRequestErrors   = stats.Int64("api/request_errors", "Counter of API requests which returned an error", stats.UnitDimensionless)
+	APIThrottled       = stats.Int64("api/throttled", "Counter of API requests rejected by the rate limiter", stats.UnitDimensionless)
+)
+
+var (
+	InfoView = &view.View{
+		Name:        "info",
+		Description: "Dbridge node information",
+		Measure:     DbridgeInfo,
+		Aggregation: view.LastValue(),
+		TagKeys:     []tag.Key{Version, Commit, NodeType},
+	}
+
+	// pubsub
+	PubsubPublishMessageView = &view.View{
+		Measure:     PubsubPublishMessage,
+		Aggregation: view.Count(),
+	}
+	PubsubDeliverMessageView = &view.View{
+		Measure:     PubsubDeliverMessage,
+		Aggregation: view.Count(),
+	}
+	PubsubRejectMessageView = &view.View{
+		Measure:     PubsubRejectMessage,
+		Aggregation: view.Count(),
+	}
+	PubsubDuplicateMessageView = &view.View{
+		Measure:     PubsubDuplicateMessage,
+		Aggregation: view.Count(),
+	}
+	PubsubRecvRPCView = &view.View{
+		Measure:     PubsubRecvRPC,
+		Aggregation: view.Count(),
+	}
+	PubsubSendRPCView = &view.View{
+		Measure:     PubsubSendRPC,
+		Aggregation: view.Count(),
+	}
+	PubsubDropRPCView = &view.View{
+		Measure:     PubsubDropRPC,
+		Aggregation: view.Count(),
+	}
+
+	// api
+	APIRequestDurationView = &view.View{
+		Measure:     APIRequestDuration,
+		Aggregation: defaultMillisecondsDistribution,
+		TagKeys:     []tag.Key{APIInterface, Endpoint},
+	}
+	APIRequestsView = &view.View{
+		Measure:     APIRequests,
+		Aggregation: view.Count(),
+		TagKeys:     []tag.Key{APIInterface, Endpoint},
+	}
+	APIRequestErrorsView = &view.View{
+		Measure:     APIRequestErrors,
+		Aggregation: view.Count(),
+		TagKeys:     []tag.Key{APIInterface, Endpoint},
+	}
+	APIThrottledView = &view.View{
+		Measure:     APIThrottled,
+		Aggregation: view.Count(),
+		TagKeys:     []tag.Key{APIInterface, Endpoint, ThrottleReason},
+	}
+)
+
+// DefaultViews is an array of OpenCensus views for metric gathering purposes
+var DefaultViews = []*view.View{
+	InfoView,
+
+	PubsubPublishMessageView,
+	PubsubDeliverMessageView,
+	PubsubRejectMessageView,
+	PubsubDuplicateMessageView,
+	PubsubRecvRPCView,
+	PubsubSendRPCView,
+	PubsubDropRPCView,
+
+	APIRequestDurationView,
+	APIRequestsView,
+	APIRequestErrorsView,
+	APIThrottledView,
+}
+
+// SinceInMilliseconds returns the duration of time since the provide time as a float64.
+func SinceInMilliseconds(startTime time.Time) float64 {
+	return float64(time.Since(startTime).Nanoseconds()) / 1e6
+}
+
+// Timer is a function stopwatch, calling it starts the timer,
+// calling the returned function will record the duration.
+func Timer(ctx context.Context, m *stats.Float64Measure) func() {
+	start := time.Now()
+	return func() {
+		stats.Record(ctx, m.M(SinceInMilliseconds(start)))
+	}
+}
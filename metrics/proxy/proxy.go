@@ -4,9 +4,16 @@ import (
 	"context"
 	"reflect"
 
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+	"go.opencensus.io/trace"
+
 	"github.com/lyswifter/dbridge/api"
+	"github.com/lyswifter/dbridge/metrics"
 )
 
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
 func MetricedFullAPI(a api.FullNode) api.FullNode {
 	var out api.FullNodeStruct
 	proxy(a, &out)
@@ -26,12 +33,23 @@ func proxy(in interface{}, outstr interface{}) {
 			rint.Field(f).Set(reflect.MakeFunc(field.Type, func(args []reflect.Value) (results []reflect.Value) {
 				ctx := args[0].Interface().(context.Context)
 				// upsert function name into context
-				// ctx, _ = tag.New(ctx, tag.Upsert(metrics.Endpoint, field.Name))
-				// stop := metrics.Timer(ctx, metrics.APIRequestDuration)
-				// defer stop()
+				ctx, _ = tag.New(ctx, tag.Upsert(metrics.Endpoint, field.Name))
+				ctx, span := trace.StartSpan(ctx, "api."+field.Name)
+				defer span.End()
+				stop := metrics.Timer(ctx, metrics.APIRequestDuration)
+				defer stop()
+				stats.Record(ctx, metrics.APIRequests.M(1))
 				// pass tagged ctx back into function call
 				args[0] = reflect.ValueOf(ctx)
-				return fn.Call(args)
+				results = fn.Call(args)
+
+				if last := len(results) - 1; last >= 0 && field.Type.Out(last) == errorType && !results[last].IsNil() {
+					err := results[last].Interface().(error)
+					stats.Record(ctx, metrics.APIRequestErrors.M(1))
+					span.SetStatus(trace.Status{Code: trace.StatusCodeUnknown, Message: err.Error()})
+				}
+
+				return results
 			}))
 		}
 	}
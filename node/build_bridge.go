@@ -5,6 +5,7 @@ import (
 
 	"github.com/cskr/pubsub"
 	"github.com/lyswifter/dbridge/api"
+	"github.com/lyswifter/dbridge/lib/journal"
 	"github.com/lyswifter/dbridge/node/config"
 	"github.com/lyswifter/dbridge/node/impl/common"
 	"github.com/lyswifter/dbridge/node/impl/net"
@@ -41,8 +42,9 @@ func ConfigFullNode(c interface{}) Option {
 
 	enableLibp2pNode := true // always enable libp2p for full nodes
 
-	return Option(
+	return Options(
 		ConfigCommon(&cfg.Common, enableLibp2pNode),
+		Override(new(*modules.ConfigReloader), modules.NewConfigReloader(cfg)),
 	)
 }
 
@@ -56,6 +58,11 @@ func ConfigCommon(cfg *config.Common, enableLibp2pNode bool) Option {
 		Override(SetApiEndpointKey, func(lr repo.LockedRepo, e dtypes.APIEndpoint) error {
 			return lr.SetAPIEndpoint(e)
 		}),
+		Override(new(dtypes.APIRoles), modules.APIRoles(cfg.API.Roles)),
+		Override(new(journal.Journal), modules.OpenFilesystemJournal(cfg.Journal)),
+		Override(InitJournalKey, modules.InitJournal),
+		Override(InitMemoryWatchdog, modules.MemoryWatchdog(cfg.Resources)),
+		Override(CheckFDLimit, modules.CheckFdLimit(cfg.Resources)),
 		ApplyIf(func(s *Settings) bool { return s.Base }), // apply only if Base has already been applied
 		If(!enableLibp2pNode,
 			Override(new(api.Net), new(api.NetStub)),
@@ -83,6 +90,7 @@ func ConfigCommon(cfg *config.Common, enableLibp2pNode bool) Option {
 
 			If(!cfg.Libp2p.DisableNatPortMap, Override(NatPortMapKey, lp2p.NatPortMap)),
 		),
-		Override(new(dtypes.MetadataDS), modules.Datastore(cfg.Backup.DisableMetadataLog)),
+		Override(new(dtypes.MetadataDS), modules.Datastore(cfg.Backup)),
+		Override(new(*modules.Backups), modules.NewBackups(cfg.Backup)),
 	)
 }
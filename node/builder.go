@@ -17,6 +17,9 @@ import (
 	record "github.com/libp2p/go-libp2p-record"
 	"github.com/libp2p/go-libp2p/p2p/net/conngater"
 	"github.com/lyswifter/dbridge/api"
+	"github.com/lyswifter/dbridge/lib/alerting"
+	"github.com/lyswifter/dbridge/lib/journal"
+	"github.com/lyswifter/dbridge/lib/jwtkeys"
 	"github.com/lyswifter/dbridge/node/config"
 	"github.com/lyswifter/dbridge/node/impl"
 	"github.com/lyswifter/dbridge/node/modules"
@@ -61,7 +64,6 @@ const (
 	RunHelloKey
 	RunChainExchangeKey
 	RunChainGraphsync
-	RunPeerMgrKey
 
 	HandleIncomingBlocksKey
 	HandleIncomingMessagesKey
@@ -78,6 +80,8 @@ const (
 	// daemon
 	ExtractApiKey
 	HeadMetricsKey
+	NetMetricsKey
+	JournalNetEventsKey
 	SettlePaymentChannelsKey
 	RunPeerTaggerKey
 	SetupFallbackBlockstoresKey
@@ -121,6 +125,10 @@ func defaults() []Option {
 
 		Override(new(dtypes.ShutdownChan), make(chan struct{})),
 
+		// replaced with the filesystem journal once the repo is configured
+		Override(new(journal.Journal), journal.NilJournal),
+		Override(new(*alerting.Alerting), alerting.NewAlertingSystem),
+
 		// // the great context in the sky, otherwise we can't DI build genesis; there has to be a better
 		// // solution than this hack.
 		Override(new(context.Context), func(lc fx.Lifecycle, mctx helpers.MetricsCtx) context.Context {
@@ -160,6 +168,8 @@ var LibP2P = Options(
 	// Services
 	Override(BandwidthReporterKey, lp2p.BandwidthCounter),
 	Override(AutoNATSvcKey, lp2p.AutoNATService),
+	Override(NetMetricsKey, modules.NetMetrics),
+	Override(JournalNetEventsKey, modules.JournalNetEvents),
 
 	// Services (pubsub)
 	Override(new(*dtypes.ScoreKeeper), lp2p.ScoreKeeper),
@@ -207,7 +217,7 @@ func Repo(r repo.Repo) Option {
 			Override(new(peer.ID), peer.IDFromPublicKey),
 
 			Override(new(types.KeyStore), modules.KeyStore),
-			Override(new(*dtypes.APIAlg), modules.APISecret),
+			Override(new(*jwtkeys.KeySet), modules.APISecret),
 
 			ApplyIf(IsType(repo.Dbridge), ConfigFullNode(c)),
 		)(settings)
@@ -14,6 +14,26 @@ func defCommon() Common {
 		API: API{
 			ListenAddress: "/ip4/127.0.0.1/tcp/1234/http",
 			Timeout:       Duration(30 * time.Second),
+
+			TLSCertFile: "tls/api.crt",
+			TLSKeyFile:  "tls/api.key",
+		},
+		Backup: Backup{
+			Dir:    "backups",
+			Retain: 7,
+
+			MetadataLogFlushInterval: Duration(10 * time.Millisecond),
+			MetadataLogMaxSize:       64 << 20,
+			MetadataLogMaxAge:        Duration(7 * 24 * time.Hour),
+			MetadataLogKeep:          1,
+		},
+		Audit: Audit{
+			MaxFileSize: 64 << 20,
+			MaxFiles:    16,
+		},
+		Journal: Journal{
+			MaxFileSize: 64 << 20,
+			MaxFiles:    16,
 		},
 		Libp2p: Libp2p{
 			ListenAddresses: []string{
@@ -31,6 +51,12 @@ func defCommon() Common {
 			Bootstrapper: false,
 			DirectPeers:  nil,
 		},
+		Resources: Resources{
+			FDLimit:    16 << 10,
+			MinFDLimit: 2048,
+
+			ShedThreshold: 0.9,
+		},
 	}
 
 }
@@ -0,0 +1,58 @@
+package config
+
+import (
+	"reflect"
+)
+
+// Diff returns the dotted paths of the fields whose values differ between the
+// configs a and b, which must be of the same type, e.g. "Libp2p.ConnMgrLow".
+// Struct fields are compared recursively, other values as a whole; empty and
+// nil slices and maps are considered equal.
+func Diff(a, b interface{}) []string {
+	var out []string
+	diffValue(reflect.ValueOf(a), reflect.ValueOf(b), "", &out)
+	return out
+}
+
+func diffValue(a, b reflect.Value, path string, out *[]string) {
+	for a.Kind() == reflect.Ptr || a.Kind() == reflect.Interface {
+		if a.IsNil() || b.IsNil() {
+			if a.IsNil() != b.IsNil() {
+				*out = append(*out, path)
+			}
+			return
+		}
+		a, b = a.Elem(), b.Elem()
+	}
+
+	switch a.Kind() {
+	case reflect.Struct:
+		t := a.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" {
+				continue // unexported
+			}
+
+			p := f.Name
+			if f.Anonymous {
+				// embedded sections, like Common, don't add to the path
+				p = path
+			} else if path != "" {
+				p = path + "." + f.Name
+			}
+			diffValue(a.Field(i), b.Field(i), p, out)
+		}
+	case reflect.Slice, reflect.Map:
+		if a.Len() == 0 && b.Len() == 0 {
+			return
+		}
+		if !reflect.DeepEqual(a.Interface(), b.Interface()) {
+			*out = append(*out, path)
+		}
+	default:
+		if !reflect.DeepEqual(a.Interface(), b.Interface()) {
+			*out = append(*out, path)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(c *BdridgeNode)
+		fields []string
+	}{
+		{
+			name:   "unchanged",
+			change: func(c *BdridgeNode) {},
+		},
+		{
+			name: "nested field",
+			change: func(c *BdridgeNode) {
+				c.Libp2p.ConnMgrLow++
+			},
+			fields: []string{"Libp2p.ConnMgrLow"},
+		},
+		{
+			name: "embedded section",
+			change: func(c *BdridgeNode) {
+				c.API.ListenAddress = "/ip4/127.0.0.1/tcp/4321/http"
+			},
+			fields: []string{"API.ListenAddress"},
+		},
+		{
+			name: "empty slice",
+			change: func(c *BdridgeNode) {
+				c.Pubsub.DirectPeers = []string{}
+			},
+		},
+		{
+			name: "slice",
+			change: func(c *BdridgeNode) {
+				c.Pubsub.DirectPeers = []string{"/ip4/1.2.3.4/tcp/1347/p2p/12D3KooWGzxzKZYveHXtpG6AsrUJBcWxHBFS2HsEoGTxrMLvKXtf"}
+			},
+			fields: []string{"Pubsub.DirectPeers"},
+		},
+		{
+			name: "several fields",
+			change: func(c *BdridgeNode) {
+				c.Libp2p.ConnMgrHigh++
+				c.Libp2p.ConnMgrLow++
+			},
+			fields: []string{"Libp2p.ConnMgrLow", "Libp2p.ConnMgrHigh"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			a := DefaultDbridgeNode()
+			b := DefaultDbridgeNode()
+			tc.change(b)
+
+			require.ElementsMatch(t, tc.fields, Diff(a, b))
+		})
+	}
+}
+
+func TestDiffValues(t *testing.T) {
+	type inner struct {
+		M map[string]int
+	}
+	type cfg struct {
+		P *inner
+		I interface{}
+	}
+
+	require.Empty(t, Diff(cfg{}, cfg{}))
+	require.Equal(t, []string{"P"}, Diff(cfg{}, cfg{P: &inner{}}))
+	require.Empty(t, Diff(cfg{P: &inner{}}, cfg{P: &inner{M: map[string]int{}}}))
+	require.Equal(t, []string{"P.M"}, Diff(cfg{P: &inner{}}, cfg{P: &inner{M: map[string]int{"a": 1}}}))
+	require.Equal(t, []string{"I"}, Diff(cfg{I: 1}, cfg{I: 2}))
+}
@@ -0,0 +1,421 @@
+// Code generated by github.com/lyswifter/dbridge/gen/config. DO NOT EDIT.
+
+package config
+
+type DocField struct {
+	Name    string
+	Type    string
+	Comment string
+}
+
+var Doc = map[string][]DocField{
+	"API": {
+		{
+			Name: "ListenAddress",
+			Type: "string",
+
+			Comment: `Binding address for the Lotus API
+Format: multiaddress, e.g. /ip4/127.0.0.1/tcp/1234/http, or
+/unix/path/to/api.sock to serve the API on a unix socket which only the
+node's user can connect to, without needing an API token.`,
+		},
+		{
+			Name: "RemoteListenAddress",
+			Type: "string",
+
+			Comment: `Binding address for the remote API, which is always served over TLS.
+Leave empty to disable the remote listener.
+Format: multiaddress, e.g. /ip4/0.0.0.0/tcp/1235/https`,
+		},
+		{
+			Name: "Timeout",
+			Type: "Duration",
+
+			Comment: ``,
+		},
+		{
+			Name: "TLSCertFile",
+			Type: "string",
+
+			Comment: `Certificate and private key presented by the remote API listener.
+Relative paths are resolved against the repo directory; a self-signed
+pair is generated there by 'dbridge init'.`,
+		},
+		{
+			Name: "TLSKeyFile",
+			Type: "string",
+
+			Comment: ``,
+		},
+		{
+			Name: "TLSClientCAFile",
+			Type: "string",
+
+			Comment: `PEM bundle of certificate authorities trusted to sign client
+certificates. When set, the remote listener asks clients for a
+certificate and verifies it against these authorities.`,
+		},
+		{
+			Name: "RequireClientCert",
+			Type: "bool",
+
+			Comment: `When set, remote connections without a valid client certificate are
+rejected during the TLS handshake.`,
+		},
+		{
+			Name: "ClientCertPerms",
+			Type: "map[string]string",
+
+			Comment: `ClientCertPerms maps the common name of a verified client certificate
+to the permission level (read, write, sign or admin) granted to
+requests which don't carry an API token.`,
+		},
+		{
+			Name: "Roles",
+			Type: "map[string][]string",
+
+			Comment: `Roles maps a role name to the API methods tokens issued for the role
+can call. Entries are method names, or prefixes ending with '*'.
+Example: monitoring = ["ID", "NetPeers", "NetBandwidth*"]`,
+		},
+		{
+			Name: "RateLimits",
+			Type: "map[string]RateLimit",
+
+			Comment: `RateLimits limits the calls made with each API token. Entries are keyed
+by role name, or by permission level (read, write, sign or admin) for
+tokens without a role or whose role has no entry; tokens are limited
+by the entry of their highest permission level. Tokens without an
+entry are not limited.`,
+		},
+	},
+	"Audit": {
+		{
+			Name: "Disable",
+			Type: "bool",
+
+			Comment: `When set to true, calls to API methods which need more than read
+permission are not recorded in the audit log (.lotus/audit).`,
+		},
+		{
+			Name: "MaxFileSize",
+			Type: "int64",
+
+			Comment: `Size in bytes after which a new audit log file is started.`,
+		},
+		{
+			Name: "MaxFiles",
+			Type: "int",
+
+			Comment: `Number of audit log files to keep, the oldest are removed on rotation.
+0 keeps all files.`,
+		},
+	},
+	"Backup": {
+		{
+			Name: "DisableMetadataLog",
+			Type: "bool",
+
+			Comment: `When set to true disables metadata log (.lotus/kvlog). This can save disk
+space by reducing metadata redundancy.
+
+Note that in case of metadata corruption it might be much harder to recover
+your node if metadata log is disabled`,
+		},
+		{
+			Name: "Dir",
+			Type: "string",
+
+			Comment: `Directory metadata backups are written to, relative to the repo unless
+absolute. Backups created through the API can only be written here.`,
+		},
+		{
+			Name: "Interval",
+			Type: "Duration",
+
+			Comment: `Interval between scheduled backups of the metadata datastore, e.g. "24h".
+0 disables scheduled backups.`,
+		},
+		{
+			Name: "Retain",
+			Type: "int",
+
+			Comment: `Number of scheduled backups to keep, older ones are removed. Backups
+created through the API or CLI are never removed. 0 keeps all backups.`,
+		},
+		{
+			Name: "MetadataLogFlushInterval",
+			Type: "Duration",
+
+			Comment: `How long metadata log entries may be buffered before they're synced to
+disk. Concurrent writes are synced together. 0 syncs every write.`,
+		},
+		{
+			Name: "MetadataLogMaxSize",
+			Type: "int64",
+
+			Comment: `Size in bytes above which the metadata log is compacted into a new log,
+starting from a fresh backup of the metadata. 0 disables the limit.`,
+		},
+		{
+			Name: "MetadataLogMaxAge",
+			Type: "Duration",
+
+			Comment: `Age after which the metadata log is compacted into a new log. 0 disables
+the limit.`,
+		},
+		{
+			Name: "MetadataLogKeep",
+			Type: "int",
+
+			Comment: `Number of previous metadata logs kept after compaction, older ones are
+removed.`,
+		},
+		{
+			Name: "Encryption",
+			Type: "string",
+
+			Comment: `Encryption of backups and the metadata log: "" for none, "keystore" for
+a key generated into the keystore, or "passphrase" for a key derived from
+the DBRIDGE_BACKUP_PASSPHRASE environment variable. Existing logs are
+re-encrypted when the node starts.`,
+		},
+	},
+	"Common": {
+		{
+			Name: "API",
+			Type: "API",
+
+			Comment: ``,
+		},
+		{
+			Name: "Audit",
+			Type: "Audit",
+
+			Comment: ``,
+		},
+		{
+			Name: "Backup",
+			Type: "Backup",
+
+			Comment: ``,
+		},
+		{
+			Name: "Journal",
+			Type: "Journal",
+
+			Comment: ``,
+		},
+		{
+			Name: "Libp2p",
+			Type: "Libp2p",
+
+			Comment: ``,
+		},
+		{
+			Name: "Pubsub",
+			Type: "Pubsub",
+
+			Comment: ``,
+		},
+		{
+			Name: "Resources",
+			Type: "Resources",
+
+			Comment: ``,
+		},
+	},
+	"FullNode": {},
+	"Journal": {
+		{
+			Name: "Disable",
+			Type: "bool",
+
+			Comment: `When set to true, no system events are recorded in the journal
+(.lotus/journal).`,
+		},
+		{
+			Name: "DisabledEvents",
+			Type: "[]string",
+
+			Comment: `Event types which aren't recorded, in the "system:event" format, e.g.
+"net:peer_connected". A bare system name disables all of its events.`,
+		},
+		{
+			Name: "MaxFileSize",
+			Type: "int64",
+
+			Comment: `Size in bytes after which a new journal file is started.`,
+		},
+		{
+			Name: "MaxFiles",
+			Type: "int",
+
+			Comment: `Number of journal files to keep, the oldest are removed on rotation.
+0 keeps all files.`,
+		},
+	},
+	"Libp2p": {
+		{
+			Name: "ListenAddresses",
+			Type: "[]string",
+
+			Comment: `Binding address for the libp2p host - 0 means random port.
+Format: multiaddress; see https://multiformats.io/multiaddr/`,
+		},
+		{
+			Name: "AnnounceAddresses",
+			Type: "[]string",
+
+			Comment: `Addresses to explicitally announce to other peers. If not specified,
+all interface addresses are announced
+Format: multiaddress`,
+		},
+		{
+			Name: "NoAnnounceAddresses",
+			Type: "[]string",
+
+			Comment: `Addresses to not announce
+Format: multiaddress`,
+		},
+		{
+			Name: "BootstrapPeers",
+			Type: "[]string",
+
+			Comment: ``,
+		},
+		{
+			Name: "ProtectedPeers",
+			Type: "[]string",
+
+			Comment: ``,
+		},
+		{
+			Name: "DisableNatPortMap",
+			Type: "bool",
+
+			Comment: `When not disabled (default), lotus asks NAT devices (e.g., routers), to
+open up an external port and forward it to the port lotus is running on.
+When this works (i.e., when your router supports NAT port forwarding),
+it makes the local lotus node accessible from the public internet`,
+		},
+		{
+			Name: "ConnMgrLow",
+			Type: "uint",
+
+			Comment: `ConnMgrLow is the number of connections that the basic connection manager
+will trim down to.`,
+		},
+		{
+			Name: "ConnMgrHigh",
+			Type: "uint",
+
+			Comment: `ConnMgrHigh is the number of connections that, when exceeded, will trigger
+a connection GC operation. Note: protected/recently formed connections don't
+count towards this limit.`,
+		},
+		{
+			Name: "ConnMgrGrace",
+			Type: "Duration",
+
+			Comment: `ConnMgrGrace is a time duration that new connections are immune from being
+closed by the connection manager.`,
+		},
+	},
+	"Pubsub": {
+		{
+			Name: "Bootstrapper",
+			Type: "bool",
+
+			Comment: `Run the node in bootstrap-node mode`,
+		},
+		{
+			Name: "DirectPeers",
+			Type: "[]string",
+
+			Comment: `DirectPeers specifies peers with direct peering agreements. These peers are
+connected outside of the mesh, with all (valid) message unconditionally
+forwarded to them. The router will maintain open connections to these peers.
+Note that the peering agreement should be reciprocal with direct peers
+symmetrically configured at both ends.
+Type: Array of multiaddress peerinfo strings, must include peerid (/p2p/12D3K...`,
+		},
+		{
+			Name: "IPColocationWhitelist",
+			Type: "[]string",
+
+			Comment: ``,
+		},
+		{
+			Name: "RemoteTracer",
+			Type: "string",
+
+			Comment: ``,
+		},
+	},
+	"RateLimit": {
+		{
+			Name: "RequestsPerSecond",
+			Type: "float64",
+
+			Comment: `Sustained rate of calls per second`,
+		},
+		{
+			Name: "Burst",
+			Type: "int",
+
+			Comment: `Number of calls which can be made at once above the sustained rate,
+defaults to RequestsPerSecond`,
+		},
+		{
+			Name: "MaxConcurrent",
+			Type: "int",
+
+			Comment: `Number of calls which can be in flight at the same time`,
+		},
+		{
+			Name: "MaxResponseSize",
+			Type: "int64",
+
+			Comment: `Maximum size of a JSON encoded call result, in bytes`,
+		},
+	},
+	"Resources": {
+		{
+			Name: "FDLimit",
+			Type: "uint64",
+
+			Comment: `Soft limit on open file descriptors which the node raises its limit to
+at startup. The limit is never raised past the hard limit.`,
+		},
+		{
+			Name: "MinFDLimit",
+			Type: "uint64",
+
+			Comment: `The node refuses to start when the soft limit on open file descriptors
+can't be raised to at least this value.`,
+		},
+		{
+			Name: "DisableMemoryWatchdog",
+			Type: "bool",
+
+			Comment: `When set to true, the memory watchdog isn't started.`,
+		},
+		{
+			Name: "MaxHeap",
+			Type: "string",
+
+			Comment: `Maximum heap size, e.g. "8GiB". When set, the memory watchdog forces GC
+as the heap approaches this size. Otherwise it watches the cgroup memory
+limit, or the system memory when not running in a cgroup.`,
+		},
+		{
+			Name: "ShedThreshold",
+			Type: "float64",
+
+			Comment: `Fraction of the memory limit at which the node trims its peer
+connections down to ConnMgrLow after a forced GC, to shed load. 0
+disables trimming.`,
+		},
+	},
+}
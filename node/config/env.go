@@ -0,0 +1,163 @@
+package config
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/BurntSushi/toml"
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/kelseyhightower/envconfig"
+	"golang.org/x/xerrors"
+)
+
+var log = logging.Logger("config")
+
+// Config values are taken from, in order of precedence:
+//
+//  1. command line flags, e.g. 'dbridge run --api'
+//  2. environment variables, e.g. DBRIDGE_LIBP2P_CONNMGRLOW
+//  3. the config file in the repo
+//  4. the defaults
+//
+// Environment variables are named after the field path, see EnvVar. The
+// LOTUS_ prefixed variables read by earlier versions are still honoured when
+// the DBRIDGE_ variable isn't set, with a deprecation warning, unless
+// DBRIDGE_LEGACY_ENV=0.
+const (
+	// envPrefix is the prefix of the environment variables overriding config
+	// fields.
+	envPrefix = "DBRIDGE"
+	// legacyEnvPrefix is the deprecated prefix of config environment variables
+	legacyEnvPrefix = "LOTUS"
+	// LegacyEnvToggle disables LOTUS_ environment variables when set to 0, for
+	// hosts which also run Lotus
+	LegacyEnvToggle = "DBRIDGE_LEGACY_ENV"
+)
+
+// Origin is where the effective value of a config field came from.
+type Origin string
+
+const (
+	OriginDefault Origin = "default"
+	OriginFile    Origin = "file"
+	OriginEnv     Origin = "env"
+	OriginFlag    Origin = "flag"
+)
+
+// Source records where the effective value of a config field came from.
+type Source struct {
+	Origin Origin
+	// Name is the environment variable or flag which set the value
+	Name string `json:",omitempty"`
+	// Deprecated is set for values from LOTUS_ environment variables
+	Deprecated bool `json:",omitempty"`
+}
+
+// Sources maps the dotted path of each config field, e.g.
+// "Libp2p.ConnMgrLow", to where its value came from.
+type Sources map[string]Source
+
+// EnvVar returns the name of the environment variable overriding the field
+// name in the dotted config section, e.g. "Libp2p".
+func EnvVar(section, name string) string {
+	return envKey(envPrefix, section, name)
+}
+
+func envKey(prefix, section, name string) string {
+	if section == "" {
+		return prefix + "_" + strings.ToUpper(name)
+	}
+	return prefix + "_" + strings.ToUpper(strings.ReplaceAll(section, ".", "_")) + "_" + strings.ToUpper(name)
+}
+
+func legacyEnvEnabled() bool {
+	return os.Getenv(LegacyEnvToggle) != "0"
+}
+
+// warnedLegacy holds the LOTUS_ variables already warned about, the config is
+// read more than once by a running node
+var warnedLegacy sync.Map
+
+// applyEnv overrides fields of cfg from the environment, and records where
+// the value of each field came from, given the metadata of the decoded
+// config file.
+func applyEnv(cfg interface{}, md toml.MetaData) (Sources, error) {
+	legacy := legacyEnvEnabled()
+	if legacy {
+		if err := envconfig.Process(legacyEnvPrefix, cfg); err != nil {
+			return nil, xerrors.Errorf("processing %s_ env var overrides: %w", legacyEnvPrefix, err)
+		}
+	}
+	if err := envconfig.Process(envPrefix, cfg); err != nil {
+		return nil, xerrors.Errorf("processing %s_ env var overrides: %w", envPrefix, err)
+	}
+
+	sources := Sources{}
+	for _, path := range fieldPaths(cfg) {
+		section, name := splitPath(path)
+		key := envKey(envPrefix, section, name)
+		legacyKey := envKey(legacyEnvPrefix, section, name)
+
+		if _, ok := os.LookupEnv(key); ok {
+			sources[path] = Source{Origin: OriginEnv, Name: key}
+			continue
+		}
+		if _, ok := os.LookupEnv(legacyKey); ok && legacy {
+			if _, warned := warnedLegacy.LoadOrStore(legacyKey, struct{}{}); !warned {
+				log.Warnf("%s is deprecated and will be ignored in a future release, use %s instead", legacyKey, key)
+			}
+			sources[path] = Source{Origin: OriginEnv, Name: legacyKey, Deprecated: true}
+			continue
+		}
+		if md.IsDefined(strings.Split(path, ".")...) {
+			sources[path] = Source{Origin: OriginFile}
+			continue
+		}
+		sources[path] = Source{Origin: OriginDefault}
+	}
+
+	return sources, nil
+}
+
+func splitPath(path string) (section, name string) {
+	i := strings.LastIndex(path, ".")
+	if i < 0 {
+		return "", path
+	}
+	return path[:i], path[i+1:]
+}
+
+// fieldPaths returns the dotted paths of the config fields in cfg, in the
+// same form as Diff.
+func fieldPaths(cfg interface{}) []string {
+	var out []string
+	var walk func(t reflect.Type, path string)
+	walk = func(t reflect.Type, path string) {
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct {
+			out = append(out, path)
+			return
+		}
+
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" {
+				continue // unexported
+			}
+
+			p := f.Name
+			if f.Anonymous {
+				p = path
+			} else if path != "" {
+				p = path + "." + f.Name
+			}
+			walk(f.Type, p)
+		}
+	}
+	walk(reflect.TypeOf(cfg), "")
+	return out
+}
@@ -0,0 +1,104 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnvPrecedence(t *testing.T) {
+	const file = `
+[Libp2p]
+  ConnMgrLow = 100
+`
+
+	tests := []struct {
+		name string
+		env  map[string]string
+
+		low    uint
+		source Source
+	}{
+		{
+			name:   "file",
+			low:    100,
+			source: Source{Origin: OriginFile},
+		},
+		{
+			name:   "env over file",
+			env:    map[string]string{"DBRIDGE_LIBP2P_CONNMGRLOW": "20"},
+			low:    20,
+			source: Source{Origin: OriginEnv, Name: "DBRIDGE_LIBP2P_CONNMGRLOW"},
+		},
+		{
+			name:   "legacy env over file",
+			env:    map[string]string{"LOTUS_LIBP2P_CONNMGRLOW": "30"},
+			low:    30,
+			source: Source{Origin: OriginEnv, Name: "LOTUS_LIBP2P_CONNMGRLOW", Deprecated: true},
+		},
+		{
+			name: "env over legacy env",
+			env: map[string]string{
+				"DBRIDGE_LIBP2P_CONNMGRLOW": "20",
+				"LOTUS_LIBP2P_CONNMGRLOW":   "30",
+			},
+			low:    20,
+			source: Source{Origin: OriginEnv, Name: "DBRIDGE_LIBP2P_CONNMGRLOW"},
+		},
+		{
+			name: "legacy env disabled",
+			env: map[string]string{
+				LegacyEnvToggle:           "0",
+				"LOTUS_LIBP2P_CONNMGRLOW": "30",
+			},
+			low:    100,
+			source: Source{Origin: OriginFile},
+		},
+		{
+			name: "env with legacy env disabled",
+			env: map[string]string{
+				LegacyEnvToggle:             "0",
+				"DBRIDGE_LIBP2P_CONNMGRLOW": "20",
+			},
+			low:    20,
+			source: Source{Origin: OriginEnv, Name: "DBRIDGE_LIBP2P_CONNMGRLOW"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			for k, v := range tc.env {
+				t.Setenv(k, v)
+			}
+
+			c, sources, err := fromReader(strings.NewReader(file), DefaultDbridgeNode())
+			require.NoError(t, err)
+
+			cfg := c.(*BdridgeNode)
+			require.Equal(t, tc.low, cfg.Libp2p.ConnMgrLow)
+			require.Equal(t, tc.source, sources["Libp2p.ConnMgrLow"])
+
+			// fields which are set nowhere keep their default
+			require.Equal(t, DefaultDbridgeNode().Libp2p.ConnMgrHigh, cfg.Libp2p.ConnMgrHigh)
+			require.Equal(t, Source{Origin: OriginDefault}, sources["Libp2p.ConnMgrHigh"])
+		})
+	}
+}
+
+func TestSourcesCoverFields(t *testing.T) {
+	_, sources, err := fromReader(strings.NewReader(""), DefaultDbridgeNode())
+	require.NoError(t, err)
+
+	var paths []string
+	for p := range sources {
+		paths = append(paths, p)
+	}
+	require.ElementsMatch(t, fieldPaths(DefaultDbridgeNode()), paths)
+	require.Contains(t, paths, "API.ListenAddress")
+}
+
+func TestEnvVar(t *testing.T) {
+	require.Equal(t, "DBRIDGE_LIBP2P_CONNMGRLOW", EnvVar("Libp2p", "ConnMgrLow"))
+	require.Equal(t, "DBRIDGE_API_RATELIMITS", EnvVar("API", "RateLimits"))
+}
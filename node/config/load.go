@@ -2,59 +2,72 @@ package config
 
 import (
 	"bytes"
-	"fmt"
 	"io"
 	"os"
 	"reflect"
+	"regexp"
 	"strings"
+	"unicode"
 
 	"github.com/BurntSushi/toml"
-	"github.com/kelseyhightower/envconfig"
 	"golang.org/x/xerrors"
 )
 
 // FromFile loads config from a specified file overriding defaults specified in
 // the def parameter. If file does not exist or is empty defaults are assumed.
+// Environment variable overrides are applied in either case.
 func FromFile(path string, def interface{}) (interface{}, error) {
+	cfg, _, err := FromFileWithSources(path, def)
+	return cfg, err
+}
+
+// FromFileWithSources is like FromFile, and also reports where the value of
+// each config field came from.
+func FromFileWithSources(path string, def interface{}) (interface{}, Sources, error) {
 	file, err := os.Open(path)
 	switch {
 	case os.IsNotExist(err):
-		return def, nil
+		return fromReader(strings.NewReader(""), def)
 	case err != nil:
-		return nil, err
+		return nil, nil, err
 	}
 
 	defer file.Close() //nolint:errcheck // The file is RO
-	return FromReader(file, def)
+	return fromReader(file, def)
 }
 
 // FromReader loads config from a reader instance.
 func FromReader(reader io.Reader, def interface{}) (interface{}, error) {
+	cfg, _, err := fromReader(reader, def)
+	return cfg, err
+}
+
+func fromReader(reader io.Reader, def interface{}) (interface{}, Sources, error) {
 	cfg := def
-	_, err := toml.DecodeReader(reader, cfg)
+	md, err := toml.DecodeReader(reader, cfg)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	err = envconfig.Process("LOTUS", cfg)
+	sources, err := applyEnv(cfg, md)
 	if err != nil {
-		return nil, fmt.Errorf("processing env vars overrides: %s", err)
+		return nil, nil, err
 	}
 
-	return cfg, nil
+	return cfg, sources, nil
 }
 
 func ConfigUpdate(cfgCur, cfgDef interface{}, comment bool) ([]byte, error) {
-	var nodeStr, _ string
-	// if cfgDef != nil {
-	// 	buf := new(bytes.Buffer)
-	// 	e := toml.NewEncoder(buf)
-	// 	if err := e.Encode(cfgDef); err != nil {
-	// 		return nil, xerrors.Errorf("encoding default config: %w", err)
-	// 	}
+	var nodeStr, defStr string
+	if cfgDef != nil {
+		buf := new(bytes.Buffer)
+		e := toml.NewEncoder(buf)
+		if err := e.Encode(cfgDef); err != nil {
+			return nil, xerrors.Errorf("encoding default config: %w", err)
+		}
 
-	// 	defStr = buf.String()
-	// }
+		defStr = buf.String()
+	}
 
 	{
 		buf := new(bytes.Buffer)
@@ -66,84 +79,79 @@ func ConfigUpdate(cfgCur, cfgDef interface{}, comment bool) ([]byte, error) {
 		nodeStr = buf.String()
 	}
 
-	/*
-
-		if comment {
-			// create a map of default lines so we can comment those out later
-			defLines := strings.Split(defStr, "\n")
-			defaults := map[string]struct{}{}
-			for i := range defLines {
-				l := strings.TrimSpace(defLines[i])
-				if len(l) == 0 {
-					continue
-				}
-				if l[0] == '#' || l[0] == '[' {
-					continue
-				}
-				defaults[l] = struct{}{}
+	if comment {
+		// create a map of default lines so we can comment those out later
+		defLines := strings.Split(defStr, "\n")
+		defaults := map[string]struct{}{}
+		for i := range defLines {
+			l := strings.TrimSpace(defLines[i])
+			if len(l) == 0 {
+				continue
 			}
+			if l[0] == '#' || l[0] == '[' {
+				continue
+			}
+			defaults[l] = struct{}{}
+		}
 
-			nodeLines := strings.Split(nodeStr, "\n")
-			var outLines []string
-
-			sectionRx := regexp.MustCompile(`\[(.+)]`)
-			var section string
+		nodeLines := strings.Split(nodeStr, "\n")
+		var outLines []string
 
-			for i, line := range nodeLines {
-				// if this is a section, track it
-				trimmed := strings.TrimSpace(line)
-				if len(trimmed) > 0 {
-					if trimmed[0] == '[' {
-						m := sectionRx.FindSubmatch([]byte(trimmed))
-						if len(m) != 2 {
-							return nil, xerrors.Errorf("section didn't match (line %d)", i)
-						}
-						section = string(m[1])
+		sectionRx := regexp.MustCompile(`\[(.+)]`)
+		var section string
 
-						// never comment sections
-						outLines = append(outLines, line)
-						continue
+		for i, line := range nodeLines {
+			// if this is a section, track it
+			trimmed := strings.TrimSpace(line)
+			if len(trimmed) > 0 {
+				if trimmed[0] == '[' {
+					m := sectionRx.FindSubmatch([]byte(trimmed))
+					if len(m) != 2 {
+						return nil, xerrors.Errorf("section didn't match (line %d)", i)
 					}
+					section = string(m[1])
+
+					// never comment sections
+					outLines = append(outLines, line)
+					continue
 				}
+			}
 
-				pad := strings.Repeat(" ", len(line)-len(strings.TrimLeftFunc(line, unicode.IsSpace)))
-
-				// see if we have docs for this field
-				{
-					lf := strings.Fields(line)
-					if len(lf) > 1 {
-						doc := findDoc(cfgCur, section, lf[0])
-
-						if doc != nil {
-							// found docfield, emit doc comment
-							if len(doc.Comment) > 0 {
-								for _, docLine := range strings.Split(doc.Comment, "\n") {
-									outLines = append(outLines, pad+"# "+docLine)
-								}
-								outLines = append(outLines, pad+"#")
-							}
+			pad := strings.Repeat(" ", len(line)-len(strings.TrimLeftFunc(line, unicode.IsSpace)))
+
+			// see if we have docs for this field
+			{
+				lf := strings.Fields(line)
+				if len(lf) > 1 {
+					doc := findDoc(cfgCur, section, lf[0])
 
-							outLines = append(outLines, pad+"# type: "+doc.Type)
+					if doc != nil {
+						// found docfield, emit doc comment
+						if len(doc.Comment) > 0 {
+							for _, docLine := range strings.Split(doc.Comment, "\n") {
+								outLines = append(outLines, pad+"# "+docLine)
+							}
+							outLines = append(outLines, pad+"#")
 						}
 
-						outLines = append(outLines, pad+"# env var: LOTUS_"+strings.ToUpper(strings.ReplaceAll(section, ".", "_"))+"_"+strings.ToUpper(lf[0]))
+						outLines = append(outLines, pad+"# type: "+doc.Type)
+						outLines = append(outLines, pad+"# env var: "+EnvVar(section, lf[0]))
 					}
 				}
-
-				// if there is the same line in the default config, comment it out it output
-				if _, found := defaults[strings.TrimSpace(nodeLines[i])]; (cfgDef == nil || found) && len(line) > 0 {
-					line = pad + "#" + line[len(pad):]
-				}
-				outLines = append(outLines, line)
-				if len(line) > 0 {
-					outLines = append(outLines, "")
-				}
 			}
 
-			nodeStr = strings.Join(outLines, "\n")
+			// if there is the same line in the default config, comment it out it output
+			if _, found := defaults[strings.TrimSpace(nodeLines[i])]; (cfgDef == nil || found) && len(line) > 0 {
+				line = pad + "#" + line[len(pad):]
+			}
+			outLines = append(outLines, line)
+			if len(line) > 0 {
+				outLines = append(outLines, "")
+			}
 		}
 
-	*/
+		nodeStr = strings.Join(outLines, "\n")
+	}
 
 	// sanity-check that the updated config parses the same way as the current one
 	if cfgDef != nil {
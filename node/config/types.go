@@ -3,9 +3,58 @@ package config
 // API contains configs for API endpoint
 type API struct {
 	// Binding address for the Lotus API
-	ListenAddress       string
+	// Format: multiaddress, e.g. /ip4/127.0.0.1/tcp/1234/http, or
+	// /unix/path/to/api.sock to serve the API on a unix socket which only the
+	// node's user can connect to, without needing an API token.
+	ListenAddress string
+	// Binding address for the remote API, which is always served over TLS.
+	// Leave empty to disable the remote listener.
+	// Format: multiaddress, e.g. /ip4/0.0.0.0/tcp/1235/https
 	RemoteListenAddress string
 	Timeout             Duration
+
+	// Certificate and private key presented by the remote API listener.
+	// Relative paths are resolved against the repo directory; a self-signed
+	// pair is generated there by 'dbridge init'.
+	TLSCertFile string
+	TLSKeyFile  string
+	// PEM bundle of certificate authorities trusted to sign client
+	// certificates. When set, the remote listener asks clients for a
+	// certificate and verifies it against these authorities.
+	TLSClientCAFile string
+	// When set, remote connections without a valid client certificate are
+	// rejected during the TLS handshake.
+	RequireClientCert bool
+	// ClientCertPerms maps the common name of a verified client certificate
+	// to the permission level (read, write, sign or admin) granted to
+	// requests which don't carry an API token.
+	ClientCertPerms map[string]string
+
+	// Roles maps a role name to the API methods tokens issued for the role
+	// can call. Entries are method names, or prefixes ending with '*'.
+	// Example: monitoring = ["ID", "NetPeers", "NetBandwidth*"]
+	Roles map[string][]string
+
+	// RateLimits limits the calls made with each API token. Entries are keyed
+	// by role name, or by permission level (read, write, sign or admin) for
+	// tokens without a role or whose role has no entry; tokens are limited
+	// by the entry of their highest permission level. Tokens without an
+	// entry are not limited.
+	RateLimits map[string]RateLimit
+}
+
+// RateLimit configures the limits applied to each API token, zero values
+// disable the respective limit.
+type RateLimit struct {
+	// Sustained rate of calls per second
+	RequestsPerSecond float64
+	// Number of calls which can be made at once above the sustained rate,
+	// defaults to RequestsPerSecond
+	Burst int
+	// Number of calls which can be in flight at the same time
+	MaxConcurrent int
+	// Maximum size of a JSON encoded call result, in bytes
+	MaxResponseSize int64
 }
 
 // Libp2p contains configs for libp2p
@@ -57,10 +106,13 @@ type Pubsub struct {
 
 // Common is common config between full node and miner
 type Common struct {
-	API    API
-	Backup Backup
-	Libp2p Libp2p
-	Pubsub Pubsub
+	API       API
+	Audit     Audit
+	Backup    Backup
+	Journal   Journal
+	Libp2p    Libp2p
+	Pubsub    Pubsub
+	Resources Resources
 }
 
 // FullNode is a full node config
@@ -68,6 +120,51 @@ type FullNode struct {
 	Common
 }
 
+type Audit struct {
+	// When set to true, calls to API methods which need more than read
+	// permission are not recorded in the audit log (.lotus/audit).
+	Disable bool
+	// Size in bytes after which a new audit log file is started.
+	MaxFileSize int64
+	// Number of audit log files to keep, the oldest are removed on rotation.
+	// 0 keeps all files.
+	MaxFiles int
+}
+
+type Journal struct {
+	// When set to true, no system events are recorded in the journal
+	// (.lotus/journal).
+	Disable bool
+	// Event types which aren't recorded, in the "system:event" format, e.g.
+	// "net:peer_connected". A bare system name disables all of its events.
+	DisabledEvents []string
+	// Size in bytes after which a new journal file is started.
+	MaxFileSize int64
+	// Number of journal files to keep, the oldest are removed on rotation.
+	// 0 keeps all files.
+	MaxFiles int
+}
+
+type Resources struct {
+	// Soft limit on open file descriptors which the node raises its limit to
+	// at startup. The limit is never raised past the hard limit.
+	FDLimit uint64
+	// The node refuses to start when the soft limit on open file descriptors
+	// can't be raised to at least this value.
+	MinFDLimit uint64
+
+	// When set to true, the memory watchdog isn't started.
+	DisableMemoryWatchdog bool
+	// Maximum heap size, e.g. "8GiB". When set, the memory watchdog forces GC
+	// as the heap approaches this size. Otherwise it watches the cgroup memory
+	// limit, or the system memory when not running in a cgroup.
+	MaxHeap string
+	// Fraction of the memory limit at which the node trims its peer
+	// connections down to ConnMgrLow after a forced GC, to shed load. 0
+	// disables trimming.
+	ShedThreshold float64
+}
+
 type Backup struct {
 	// When set to true disables metadata log (.lotus/kvlog). This can save disk
 	// space by reducing metadata redundancy.
@@ -75,4 +172,38 @@ type Backup struct {
 	// Note that in case of metadata corruption it might be much harder to recover
 	// your node if metadata log is disabled
 	DisableMetadataLog bool
+	// Directory metadata backups are written to, relative to the repo unless
+	// absolute. Backups created through the API can only be written here.
+	Dir string
+	// Interval between scheduled backups of the metadata datastore, e.g. "24h".
+	// 0 disables scheduled backups.
+	Interval Duration
+	// Number of scheduled backups to keep, older ones are removed. Backups
+	// created through the API or CLI are never removed. 0 keeps all backups.
+	Retain int
+
+	// How long metadata log entries may be buffered before they're synced to
+	// disk. Concurrent writes are synced together. 0 syncs every write.
+	MetadataLogFlushInterval Duration
+	// Size in bytes above which the metadata log is compacted into a new log,
+	// starting from a fresh backup of the metadata. 0 disables the limit.
+	MetadataLogMaxSize int64
+	// Age after which the metadata log is compacted into a new log. 0 disables
+	// the limit.
+	MetadataLogMaxAge Duration
+	// Number of previous metadata logs kept after compaction, older ones are
+	// removed.
+	MetadataLogKeep int
+
+	// Encryption of backups and the metadata log: "" for none, "keystore" for
+	// a key generated into the keystore, or "passphrase" for a key derived from
+	// the DBRIDGE_BACKUP_PASSPHRASE environment variable. Existing logs are
+	// re-encrypted when the node starts.
+	Encryption string
 }
+
+const (
+	BackupEncryptionNone       = ""
+	BackupEncryptionKeystore   = "keystore"
+	BackupEncryptionPassphrase = "passphrase"
+)
@@ -0,0 +1,140 @@
+package config
+
+import (
+	"net"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/multiformats/go-multiaddr"
+	"go.uber.org/multierr"
+	"golang.org/x/xerrors"
+
+	"github.com/lyswifter/dbridge/lib/journal"
+)
+
+// Validate checks the values which decoding the config doesn't check, like
+// multiaddresses, peer IDs, subnets and limits, so that mistakes are reported
+// before the node starts. All problems found are returned.
+func Validate(cfg *BdridgeNode) error {
+	v := &validator{}
+
+	v.multiaddr("API.ListenAddress", cfg.API.ListenAddress)
+	if cfg.API.RemoteListenAddress != "" {
+		v.multiaddr("API.RemoteListenAddress", cfg.API.RemoteListenAddress)
+	}
+	v.nonNegative("API.Timeout", int64(cfg.API.Timeout))
+	for class, l := range cfg.API.RateLimits {
+		if l.RequestsPerSecond < 0 || l.Burst < 0 || l.MaxConcurrent < 0 || l.MaxResponseSize < 0 {
+			v.errorf("API.RateLimits.%s: limits can't be negative", class)
+		}
+	}
+
+	v.nonNegative("Audit.MaxFileSize", cfg.Audit.MaxFileSize)
+	v.nonNegative("Audit.MaxFiles", int64(cfg.Audit.MaxFiles))
+
+	if cfg.Backup.Dir == "" {
+		v.errorf("Backup.Dir: directory is empty")
+	}
+	v.nonNegative("Backup.Interval", int64(cfg.Backup.Interval))
+	v.nonNegative("Backup.Retain", int64(cfg.Backup.Retain))
+	v.nonNegative("Backup.MetadataLogFlushInterval", int64(cfg.Backup.MetadataLogFlushInterval))
+	v.nonNegative("Backup.MetadataLogMaxSize", cfg.Backup.MetadataLogMaxSize)
+	v.nonNegative("Backup.MetadataLogMaxAge", int64(cfg.Backup.MetadataLogMaxAge))
+	v.nonNegative("Backup.MetadataLogKeep", int64(cfg.Backup.MetadataLogKeep))
+	switch cfg.Backup.Encryption {
+	case BackupEncryptionNone, BackupEncryptionKeystore, BackupEncryptionPassphrase:
+	default:
+		v.errorf("Backup.Encryption: unknown encryption %q, expected %q or %q", cfg.Backup.Encryption, BackupEncryptionKeystore, BackupEncryptionPassphrase)
+	}
+
+	if _, err := journal.ParseDisabledEvents(cfg.Journal.DisabledEvents); err != nil {
+		v.errorf("Journal.DisabledEvents: %s", err)
+	}
+	v.nonNegative("Journal.MaxFileSize", cfg.Journal.MaxFileSize)
+	v.nonNegative("Journal.MaxFiles", int64(cfg.Journal.MaxFiles))
+
+	for _, a := range cfg.Libp2p.ListenAddresses {
+		v.multiaddr("Libp2p.ListenAddresses", a)
+	}
+	for _, a := range cfg.Libp2p.AnnounceAddresses {
+		v.multiaddr("Libp2p.AnnounceAddresses", a)
+	}
+	for _, a := range cfg.Libp2p.NoAnnounceAddresses {
+		v.multiaddr("Libp2p.NoAnnounceAddresses", a)
+	}
+	for _, a := range cfg.Libp2p.BootstrapPeers {
+		v.peerAddr("Libp2p.BootstrapPeers", a)
+	}
+	for _, p := range cfg.Libp2p.ProtectedPeers {
+		if _, err := peer.IDFromString(p); err != nil {
+			v.errorf("Libp2p.ProtectedPeers: invalid peer ID %q: %s", p, err)
+		}
+	}
+	if cfg.Libp2p.ConnMgrLow > cfg.Libp2p.ConnMgrHigh {
+		v.errorf("Libp2p.ConnMgrLow (%d) is above Libp2p.ConnMgrHigh (%d)", cfg.Libp2p.ConnMgrLow, cfg.Libp2p.ConnMgrHigh)
+	}
+	v.nonNegative("Libp2p.ConnMgrGrace", int64(cfg.Libp2p.ConnMgrGrace))
+
+	for _, a := range cfg.Pubsub.DirectPeers {
+		v.peerAddr("Pubsub.DirectPeers", a)
+	}
+	for _, s := range cfg.Pubsub.IPColocationWhitelist {
+		if _, _, err := net.ParseCIDR(s); err != nil {
+			v.errorf("Pubsub.IPColocationWhitelist: invalid subnet %q: %s", s, err)
+		}
+	}
+	if cfg.Pubsub.RemoteTracer != "" {
+		v.peerAddr("Pubsub.RemoteTracer", cfg.Pubsub.RemoteTracer)
+	}
+
+	if cfg.Resources.MinFDLimit > cfg.Resources.FDLimit {
+		v.errorf("Resources.MinFDLimit (%d) is above Resources.FDLimit (%d)", cfg.Resources.MinFDLimit, cfg.Resources.FDLimit)
+	}
+	if cfg.Resources.MaxHeap != "" {
+		if _, err := humanize.ParseBytes(cfg.Resources.MaxHeap); err != nil {
+			v.errorf("Resources.MaxHeap: invalid size %q: %s", cfg.Resources.MaxHeap, err)
+		}
+	}
+	if t := cfg.Resources.ShedThreshold; t < 0 || t > 1 {
+		v.errorf("Resources.ShedThreshold must be between 0 and 1, got %g", t)
+	}
+
+	return v.err
+}
+
+type validator struct {
+	err error
+}
+
+func (v *validator) errorf(format string, args ...interface{}) {
+	v.err = multierr.Append(v.err, xerrors.Errorf(format, args...))
+}
+
+func (v *validator) multiaddr(field, s string) {
+	if strings.TrimSpace(s) == "" {
+		v.errorf("%s: address is empty", field)
+		return
+	}
+	if _, err := multiaddr.NewMultiaddr(s); err != nil {
+		v.errorf("%s: invalid multiaddress %q: %s", field, s, err)
+	}
+}
+
+// peerAddr checks that s is a multiaddress which includes a peer ID.
+func (v *validator) peerAddr(field, s string) {
+	a, err := multiaddr.NewMultiaddr(s)
+	if err != nil {
+		v.errorf("%s: invalid multiaddress %q: %s", field, s, err)
+		return
+	}
+	if _, err := peer.AddrInfoFromP2pAddr(a); err != nil {
+		v.errorf("%s: address %q must include a peer ID (/p2p/...): %s", field, s, err)
+	}
+}
+
+func (v *validator) nonNegative(field string, n int64) {
+	if n < 0 {
+		v.errorf("%s can't be negative", field)
+	}
+}
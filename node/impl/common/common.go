@@ -1,44 +1,414 @@
 package common
 
 import (
+	"bufio"
 	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
 
 	"github.com/filecoin-project/go-jsonrpc/auth"
 	"github.com/gbrlsnchs/jwt/v3"
 	"github.com/google/uuid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/ipfs/go-datastore/query"
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/lyswifter/dbridge/api"
+	"github.com/lyswifter/dbridge/lib/alerting"
+	"github.com/lyswifter/dbridge/lib/journal"
+	"github.com/lyswifter/dbridge/lib/jwtkeys"
+	"github.com/lyswifter/dbridge/node/modules"
 	"github.com/lyswifter/dbridge/node/modules/dtypes"
+	"github.com/lyswifter/dbridge/node/repo"
+	"github.com/lyswifter/dbridge/types"
 	"go.uber.org/fx"
 	"golang.org/x/xerrors"
 )
 
 var session = uuid.New()
 
+// TokenIssuer is the issuer set on tokens created by the node.
+const TokenIssuer = "dbridge"
+
+// tokensKey is the metadata datastore prefix under which issued tokens, and
+// whether they were revoked, are recorded.
+var tokensKey = datastore.NewKey("/auth/tokens")
+
 type CommonAPI struct {
 	fx.In
 
-	APISecret    *dtypes.APIAlg
+	APIKeys      *jwtkeys.KeySet
+	KeyStore     types.KeyStore
+	Repo         repo.LockedRepo
 	ShutdownChan dtypes.ShutdownChan
+	DS           dtypes.MetadataDS
+	Roles        dtypes.APIRoles `optional:"true"`
+	Alerting     *alerting.Alerting
+	Journal      journal.Journal
+	Reloader     *modules.ConfigReloader
+	Backups      *modules.Backups
 }
 
 type jwtPayload struct {
+	jwt.Payload
+
 	Allow []auth.Permission
+	Label string `json:",omitempty"`
+	Role  string `json:",omitempty"`
+}
+
+func (a *CommonAPI) tokens() datastore.Batching {
+	return namespace.Wrap(a.DS, tokensKey)
 }
 
 func (a *CommonAPI) AuthVerify(ctx context.Context, token string) ([]auth.Permission, error) {
 	var payload jwtPayload
-	if _, err := jwt.Verify([]byte(token), (*jwt.HMACSHA)(a.APISecret), &payload); err != nil {
+	if err := a.APIKeys.Verify([]byte(token), &payload); err != nil {
 		return nil, xerrors.Errorf("JWT Verification failed: %w", err)
 	}
 
+	if payload.ExpirationTime != nil && time.Now().After(payload.ExpirationTime.Time) {
+		return nil, xerrors.Errorf("JWT Verification failed: token expired at %s", payload.ExpirationTime.Time)
+	}
+
+	// tokens without an ID predate revocation support, or were issued outside
+	// of the API (e.g. the CLI token), and can't be revoked
+	if payload.JWTID != "" {
+		ti, err := a.getToken(ctx, payload.JWTID)
+		switch {
+		case xerrors.Is(err, datastore.ErrNotFound):
+			// not issued through this node's API, trust the signature
+		case err != nil:
+			return nil, xerrors.Errorf("checking token revocation: %w", err)
+		case ti.Revoked:
+			return nil, xerrors.Errorf("JWT Verification failed: token %s was revoked", payload.JWTID)
+		}
+	}
+
+	if payload.Role != "" {
+		// resolve the role when verifying, so that changes to the role
+		// configuration apply to already issued tokens
+		perms, ok := a.Roles[payload.Role]
+		if !ok {
+			return nil, xerrors.Errorf("JWT Verification failed: unknown role '%s'", payload.Role)
+		}
+		return perms, nil
+	}
+
 	return payload.Allow, nil
 }
 
 func (a *CommonAPI) AuthNew(ctx context.Context, perms []auth.Permission) ([]byte, error) {
+	return a.AuthNewToken(ctx, perms, "", 0)
+}
+
+func (a *CommonAPI) AuthNewToken(ctx context.Context, perms []auth.Permission, label string, ttl time.Duration) ([]byte, error) {
+	return a.newToken(ctx, perms, "", label, ttl)
+}
+
+func (a *CommonAPI) AuthNewRoleToken(ctx context.Context, role string, label string, ttl time.Duration) ([]byte, error) {
+	perms, ok := a.Roles[role]
+	if !ok {
+		return nil, xerrors.Errorf("unknown role '%s'", role)
+	}
+
+	return a.newToken(ctx, perms, role, label, ttl)
+}
+
+func (a *CommonAPI) newToken(ctx context.Context, perms []auth.Permission, role, label string, ttl time.Duration) ([]byte, error) {
+	if ttl < 0 {
+		return nil, xerrors.Errorf("negative token ttl: %s", ttl)
+	}
+
+	now := time.Now()
+	ti := api.TokenInfo{
+		ID:     uuid.New().String(),
+		Label:  label,
+		Issuer: TokenIssuer,
+		Role:   role,
+		Allow:  perms, // TODO: consider checking validity
+		Issued: now,
+	}
+
 	p := jwtPayload{
-		Allow: perms, // TODO: consider checking validity
+		Payload: jwt.Payload{
+			Issuer:   ti.Issuer,
+			IssuedAt: jwt.NumericDate(now),
+			JWTID:    ti.ID,
+		},
+		Allow: ti.Allow,
+		Label: ti.Label,
+		Role:  ti.Role,
+	}
+
+	if ttl > 0 {
+		ti.Expires = now.Add(ttl)
+		p.ExpirationTime = jwt.NumericDate(ti.Expires)
+	}
+
+	token, err := a.APIKeys.Sign(&p)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := a.putToken(ctx, ti); err != nil {
+		return nil, xerrors.Errorf("recording token: %w", err)
+	}
+
+	return token, nil
+}
+
+func (a *CommonAPI) AuthList(ctx context.Context) ([]api.TokenInfo, error) {
+	res, err := a.tokens().Query(ctx, query.Query{})
+	if err != nil {
+		return nil, xerrors.Errorf("querying tokens: %w", err)
+	}
+	defer res.Close() //nolint:errcheck
+
+	var out []api.TokenInfo
+	for r := range res.Next() {
+		if r.Error != nil {
+			return nil, xerrors.Errorf("iterating tokens: %w", r.Error)
+		}
+
+		var ti api.TokenInfo
+		if err := json.Unmarshal(r.Value, &ti); err != nil {
+			return nil, xerrors.Errorf("decoding token %s: %w", r.Key, err)
+		}
+		out = append(out, ti)
+	}
+
+	return out, nil
+}
+
+func (a *CommonAPI) AuthRevoke(ctx context.Context, id string) error {
+	ti, err := a.getToken(ctx, id)
+	if err != nil {
+		if xerrors.Is(err, datastore.ErrNotFound) {
+			return xerrors.Errorf("token %s not found", id)
+		}
+		return err
+	}
+
+	ti.Revoked = true
+	return a.putToken(ctx, ti)
+}
+
+func (a *CommonAPI) AuthRotateSecret(ctx context.Context, grace time.Duration) (string, error) {
+	key, err := modules.RotateAPISecret(a.KeyStore, a.Repo, a.DS, a.APIKeys, grace)
+	if err != nil {
+		return "", err
+	}
+	return key.ID, nil
+}
+
+func (a *CommonAPI) getToken(ctx context.Context, id string) (api.TokenInfo, error) {
+	var ti api.TokenInfo
+
+	b, err := a.tokens().Get(ctx, datastore.NewKey(id))
+	if err != nil {
+		return ti, xerrors.Errorf("getting token %s: %w", id, err)
+	}
+
+	if err := json.Unmarshal(b, &ti); err != nil {
+		return ti, xerrors.Errorf("decoding token %s: %w", id, err)
+	}
+	return ti, nil
+}
+
+func (a *CommonAPI) putToken(ctx context.Context, ti api.TokenInfo) error {
+	b, err := json.Marshal(ti)
+	if err != nil {
+		return err
+	}
+	return a.tokens().Put(ctx, datastore.NewKey(ti.ID), b)
+}
+
+func (a *CommonAPI) LogList(context.Context) ([]string, error) {
+	subs := logging.GetSubsystems()
+	sort.Strings(subs)
+	return subs, nil
+}
+
+func (a *CommonAPI) LogSetLevel(ctx context.Context, subsystem, level string) error {
+	return logging.SetLogLevel(subsystem, level)
+}
+
+func (a *CommonAPI) LogAlerts(ctx context.Context) ([]alerting.Alert, error) {
+	return a.Alerting.GetAlerts(), nil
+}
+
+func (a *CommonAPI) ConfigReload(ctx context.Context) ([]api.ConfigChange, error) {
+	return a.Reloader.Reload(ctx)
+}
+
+func (a *CommonAPI) Backup(ctx context.Context, path string) (api.BackupInfo, error) {
+	return a.Backups.Create(ctx, path)
+}
+
+func (a *CommonAPI) BackupList(ctx context.Context) ([]api.BackupInfo, error) {
+	return a.Backups.List()
+}
+
+func (a *CommonAPI) KeyList(ctx context.Context) ([]api.KeyEntry, error) {
+	return modules.NewKeys(a.KeyStore).KeyList(ctx)
+}
+
+func (a *CommonAPI) KeyExport(ctx context.Context, name string, passphrase []byte) ([]byte, error) {
+	return modules.NewKeys(a.KeyStore).KeyExport(ctx, name, passphrase)
+}
+
+func (a *CommonAPI) KeyImport(ctx context.Context, name string, exported []byte, passphrase []byte) (string, error) {
+	return modules.NewKeys(a.KeyStore).KeyImport(ctx, name, exported, passphrase)
+}
+
+func (a *CommonAPI) KeyDelete(ctx context.Context, name string, force bool) error {
+	return modules.NewKeys(a.KeyStore).KeyDelete(ctx, name, force)
+}
+
+func (a *CommonAPI) KeyRotateLibp2p(ctx context.Context) (peer.ID, error) {
+	return modules.NewKeys(a.KeyStore).KeyRotateLibp2p(ctx)
+}
+
+func (a *CommonAPI) JournalRecent(ctx context.Context, limit int, eventTypes []string) ([]journal.Event, error) {
+	if limit < 0 {
+		return nil, xerrors.Errorf("limit must not be negative")
+	}
+
+	filter := map[string]struct{}{}
+	for _, et := range eventTypes {
+		filter[et] = struct{}{}
+	}
+
+	out := []journal.Event{}
+	for _, evt := range a.Journal.Recent(0) {
+		if len(filter) > 0 {
+			_, sysOk := filter[evt.System]
+			_, evtOk := filter[evt.EventType.String()]
+			if !sysOk && !evtOk {
+				continue
+			}
+		}
+		out = append(out, evt)
+	}
+
+	if limit > 0 && len(out) > limit {
+		out = out[len(out)-limit:]
+	}
+	return out, nil
+}
+
+// logStreamBuffer is the number of log messages buffered for a LogStream
+// client, before messages are dropped.
+const logStreamBuffer = 256
+
+func (a *CommonAPI) LogStream(ctx context.Context, minLevel string, subsystems []string) (<-chan api.LogEntry, error) {
+	if minLevel == "" {
+		minLevel = "debug"
+	}
+	lvl, err := logging.LevelFromString(minLevel)
+	if err != nil {
+		return nil, err
+	}
+
+	systems := map[string]bool{}
+	for _, s := range subsystems {
+		systems[s] = true
+	}
+
+	// the pipe is written synchronously by the loggers, so it's drained
+	// right away and messages are dropped when the client is too slow
+	pr := logging.NewPipeReader(logging.PipeFormat(logging.JSONOutput), logging.PipeLevel(lvl))
+	out := make(chan api.LogEntry, logStreamBuffer)
+
+	go func() {
+		<-ctx.Done()
+		_ = pr.Close()
+	}()
+
+	// nothing may be logged from here, as logging blocks until the pipe is
+	// read
+	go func() {
+		// the pipe must be removed from the loggers once it's not read
+		// anymore, e.g. after a line over the scanner limit
+		defer pr.Close() //nolint:errcheck
+		defer close(out)
+
+		var dropped int
+		sc := bufio.NewScanner(pr)
+		sc.Buffer(make([]byte, 0, 64<<10), 1<<20)
+		for sc.Scan() {
+			ent, err := parseLogEntry(sc.Bytes())
+			if err != nil {
+				continue
+			}
+			if len(systems) > 0 && !systems[ent.System] {
+				continue
+			}
+
+			if dropped > 0 {
+				select {
+				case out <- api.LogEntry{
+					Time:    ent.Time,
+					Level:   "warn",
+					System:  "logstream",
+					Message: fmt.Sprintf("client too slow, dropped %d messages", dropped),
+				}:
+					dropped = 0
+				default:
+				}
+			}
+
+			select {
+			case out <- ent:
+			default:
+				dropped++
+			}
+		}
+
+		if err := sc.Err(); err != nil {
+			select {
+			case out <- api.LogEntry{
+				Time:    time.Now(),
+				Level:   "error",
+				System:  "logstream",
+				Message: fmt.Sprintf("log stream ended: %s", err),
+			}:
+			default:
+			}
+		}
+	}()
+
+	return out, nil
+}
+
+func parseLogEntry(line []byte) (api.LogEntry, error) {
+	var fields map[string]interface{}
+	if err := json.Unmarshal(line, &fields); err != nil {
+		return api.LogEntry{}, err
+	}
+
+	str := func(key string) string {
+		v, _ := fields[key].(string)
+		delete(fields, key)
+		return v
+	}
+
+	ent := api.LogEntry{
+		Level:   str("level"),
+		System:  str("logger"),
+		Caller:  str("caller"),
+		Message: str("msg"),
+	}
+	ent.Time, _ = time.Parse("2006-01-02T15:04:05.000Z0700", str("ts"))
+	if len(fields) > 0 {
+		ent.Fields = fields
 	}
 
-	return jwt.Sign(&p, (*jwt.HMACSHA)(a.APISecret))
+	return ent, nil
 }
 
 func (a *CommonAPI) Shutdown(ctx context.Context) error {
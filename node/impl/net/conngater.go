@@ -86,6 +86,7 @@ func (a *NetAPI) NetBlockAdd(ctx context.Context, acl api.NetBlockList) error {
 		}
 	}
 
+	a.recordBlockEvent("block_add", acl)
 	return nil
 }
 
@@ -121,9 +122,17 @@ func (a *NetAPI) NetBlockRemove(ctx context.Context, acl api.NetBlockList) error
 		}
 	}
 
+	a.recordBlockEvent("block_remove", acl)
 	return nil
 }
 
+// recordBlockEvent records a change to the connection gater in the journal.
+func (a *NetAPI) recordBlockEvent(event string, acl api.NetBlockList) {
+	a.Journal.RecordEvent(a.Journal.RegisterEventType("net", event), func() interface{} {
+		return acl
+	})
+}
+
 func (a *NetAPI) NetBlockList(ctx context.Context) (result api.NetBlockList, err error) {
 	result.Peers = a.ConnGater.ListBlockedPeers()
 	for _, ip := range a.ConnGater.ListBlockedAddrs() {
@@ -18,6 +18,7 @@ import (
 	ma "github.com/multiformats/go-multiaddr"
 
 	"github.com/lyswifter/dbridge/api"
+	"github.com/lyswifter/dbridge/lib/journal"
 	"github.com/lyswifter/dbridge/node/modules/dtypes"
 	"github.com/lyswifter/dbridge/node/modules/lp2p"
 )
@@ -31,6 +32,7 @@ type NetAPI struct {
 	ConnGater *conngater.BasicConnectionGater
 	Reporter  metrics.Reporter
 	Sk        *dtypes.ScoreKeeper
+	Journal   journal.Journal
 }
 
 func (a *NetAPI) ID(context.Context) (peer.ID, error) {
@@ -0,0 +1,282 @@
+package modules
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/fx"
+	"golang.org/x/xerrors"
+
+	"github.com/lyswifter/dbridge/api"
+	"github.com/lyswifter/dbridge/lib/backupds"
+	"github.com/lyswifter/dbridge/lib/journal"
+	"github.com/lyswifter/dbridge/node/config"
+	"github.com/lyswifter/dbridge/node/modules/dtypes"
+	"github.com/lyswifter/dbridge/node/repo"
+)
+
+// scheduledBackupPrefix is the file name prefix of scheduled backups, which
+// are the only backups removed by retention
+const scheduledBackupPrefix = "scheduled-"
+
+// Backups writes backups of the metadata datastore into the backup directory,
+// on request and on a schedule.
+type Backups struct {
+	dir    string
+	retain int
+	ds     *backupds.Datastore
+
+	j         journal.Journal
+	evtBackup journal.EventType
+
+	// lk serialises backups, so that scheduled and requested backups don't
+	// pick the same name, and retention doesn't race with a new backup
+	lk sync.Mutex
+}
+
+type BackupsParams struct {
+	fx.In
+
+	Lc      fx.Lifecycle
+	Repo    repo.LockedRepo
+	DS      dtypes.MetadataDS
+	Journal journal.Journal
+}
+
+type BackupEvt struct {
+	Path      string
+	Size      int64
+	Scheduled bool
+	Error     string `json:",omitempty"`
+}
+
+func NewBackups(cfg config.Backup) func(BackupsParams) (*Backups, error) {
+	return func(p BackupsParams) (*Backups, error) {
+		bds, ok := p.DS.(*backupds.Datastore)
+		if !ok {
+			return nil, xerrors.Errorf("expected a backup datastore, got %T", p.DS)
+		}
+
+		dir := cfg.Dir
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(p.Repo.Path(), dir)
+		}
+
+		b := &Backups{
+			dir:       filepath.Clean(dir),
+			retain:    cfg.Retain,
+			ds:        bds,
+			j:         p.Journal,
+			evtBackup: p.Journal.RegisterEventType("backup", "created"),
+		}
+
+		if cfg.Interval <= 0 {
+			return b, nil
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		p.Lc.Append(fx.Hook{
+			OnStart: func(context.Context) error {
+				go b.runSchedule(ctx, time.Duration(cfg.Interval), done)
+				return nil
+			},
+			OnStop: func(context.Context) error {
+				cancel()
+				<-done
+				return nil
+			},
+		})
+
+		return b, nil
+	}
+}
+
+func (b *Backups) runSchedule(ctx context.Context, interval time.Duration, done chan struct{}) {
+	defer close(done)
+
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+			name := scheduledBackupPrefix + time.Now().UTC().Format("20060102T150405Z") + ".cbor"
+			bi, err := b.create(ctx, name, true)
+			if err != nil {
+				log.Errorf("scheduled metadata backup: %s", err)
+				continue
+			}
+			log.Infow("scheduled metadata backup done", "path", bi.Path, "size", bi.Size)
+
+			if err := b.prune(); err != nil {
+				log.Errorf("removing old scheduled backups: %s", err)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Create writes a backup of the metadata datastore to path, which must be in
+// the backup directory; relative paths are resolved against it. An empty path
+// picks a name from the current time.
+func (b *Backups) Create(ctx context.Context, path string) (api.BackupInfo, error) {
+	if path == "" {
+		path = "backup-" + time.Now().UTC().Format("20060102T150405Z") + ".cbor"
+	}
+	return b.create(ctx, path, false)
+}
+
+func (b *Backups) create(ctx context.Context, path string, scheduled bool) (api.BackupInfo, error) {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(b.dir, path)
+	}
+	path = filepath.Clean(path)
+
+	// don't let the API write anywhere the node's user can
+	if filepath.Dir(path) != b.dir {
+		return api.BackupInfo{}, xerrors.Errorf("backups can only be written to the backup directory %s", b.dir)
+	}
+	if strings.HasSuffix(path, ".tmp") {
+		return api.BackupInfo{}, xerrors.Errorf("backup names can't end in .tmp")
+	}
+
+	b.lk.Lock()
+	defer b.lk.Unlock()
+
+	if err := os.MkdirAll(b.dir, 0700); err != nil {
+		return api.BackupInfo{}, xerrors.Errorf("creating backup directory: %w", err)
+	}
+
+	if _, err := os.Stat(path); err == nil {
+		return api.BackupInfo{}, xerrors.Errorf("backup %s already exists", path)
+	}
+
+	size, err := b.write(ctx, path)
+	b.j.RecordEvent(b.evtBackup, func() interface{} {
+		evt := BackupEvt{Path: path, Size: size, Scheduled: scheduled}
+		if err != nil {
+			evt.Error = err.Error()
+		}
+		return evt
+	})
+	if err != nil {
+		return api.BackupInfo{}, err
+	}
+
+	return api.BackupInfo{
+		Name:      filepath.Base(path),
+		Path:      path,
+		Size:      size,
+		Time:      time.Now(),
+		Scheduled: scheduled,
+	}, nil
+}
+
+// write writes the backup into a temporary file, which is renamed into place
+// once complete, so that an interrupted backup doesn't look like a good one.
+func (b *Backups) write(ctx context.Context, path string) (int64, error) {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return 0, xerrors.Errorf("creating backup file: %w", err)
+	}
+
+	if err := b.ds.Backup(ctx, f); err != nil {
+		_ = f.Close()
+		_ = os.Remove(tmp)
+		return 0, xerrors.Errorf("backing up metadata: %w", err)
+	}
+
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		_ = os.Remove(tmp)
+		return 0, xerrors.Errorf("syncing backup file: %w", err)
+	}
+
+	st, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		_ = os.Remove(tmp)
+		return 0, err
+	}
+
+	if err := f.Close(); err != nil {
+		_ = os.Remove(tmp)
+		return 0, xerrors.Errorf("closing backup file: %w", err)
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		return 0, xerrors.Errorf("moving backup into place: %w", err)
+	}
+	return st.Size(), nil
+}
+
+// List returns the backups in the backup directory, oldest first.
+func (b *Backups) List() ([]api.BackupInfo, error) {
+	ents, err := ioutil.ReadDir(b.dir)
+	if os.IsNotExist(err) {
+		return []api.BackupInfo{}, nil
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("reading backup directory: %w", err)
+	}
+
+	out := []api.BackupInfo{}
+	for _, e := range ents {
+		if e.IsDir() || strings.HasSuffix(e.Name(), ".tmp") {
+			continue
+		}
+		out = append(out, api.BackupInfo{
+			Name:      e.Name(),
+			Path:      filepath.Join(b.dir, e.Name()),
+			Size:      e.Size(),
+			Time:      e.ModTime(),
+			Scheduled: strings.HasPrefix(e.Name(), scheduledBackupPrefix),
+		})
+	}
+
+	// entries are read in name order, which breaks ties between backups
+	// written within the same second
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].Time.Before(out[j].Time)
+	})
+	return out, nil
+}
+
+// prune removes the oldest scheduled backups beyond the number retained.
+func (b *Backups) prune() error {
+	if b.retain <= 0 {
+		return nil
+	}
+
+	b.lk.Lock()
+	defer b.lk.Unlock()
+
+	all, err := b.List()
+	if err != nil {
+		return err
+	}
+
+	var scheduled []api.BackupInfo
+	for _, bi := range all {
+		if bi.Scheduled {
+			scheduled = append(scheduled, bi)
+		}
+	}
+
+	for len(scheduled) > b.retain {
+		if err := os.Remove(scheduled[0].Path); err != nil {
+			return xerrors.Errorf("removing %s: %w", scheduled[0].Path, err)
+		}
+		scheduled = scheduled[1:]
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package modules
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/stretchr/testify/require"
+
+	"github.com/lyswifter/dbridge/lib/backupds"
+	"github.com/lyswifter/dbridge/lib/journal"
+)
+
+func newTestBackups(t *testing.T, retain int) *Backups {
+	bds, err := backupds.Wrap(datastore.NewMapDatastore(), backupds.NoLogdir)
+	require.NoError(t, err)
+	require.NoError(t, bds.Put(context.Background(), datastore.NewKey("/a"), []byte("value")))
+
+	return &Backups{
+		dir:    filepath.Join(t.TempDir(), "backups"),
+		retain: retain,
+		ds:     bds,
+		j:      journal.NilJournal(),
+	}
+}
+
+func TestBackupCreatePath(t *testing.T) {
+	b := newTestBackups(t, 0)
+
+	tests := []struct {
+		name string
+		path string
+
+		ok bool
+	}{
+		{name: "relative", path: "backup.cbor", ok: true},
+		{name: "in backup dir", path: filepath.Join(b.dir, "abs.cbor"), ok: true},
+		{name: "cleaned into backup dir", path: "sub/../clean.cbor", ok: true},
+		{name: "parent dir", path: "../escape.cbor"},
+		{name: "nested parent dir", path: "a/../../escape.cbor"},
+		{name: "subdirectory", path: "sub/nested.cbor"},
+		{name: "absolute elsewhere", path: filepath.Join(t.TempDir(), "elsewhere.cbor")},
+		{name: "absolute backup dir", path: b.dir},
+		{name: "tmp suffix", path: "backup.cbor.tmp"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			bi, err := b.Create(context.Background(), tc.path)
+			if !tc.ok {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, b.dir, filepath.Dir(bi.Path))
+
+			st, err := os.Stat(bi.Path)
+			require.NoError(t, err)
+			require.Equal(t, st.Size(), bi.Size)
+		})
+	}
+
+	// nothing was written outside of the backup directory
+	_, err := os.Stat(filepath.Join(filepath.Dir(b.dir), "escape.cbor"))
+	require.True(t, os.IsNotExist(err))
+
+	_, err = b.Create(context.Background(), "backup.cbor")
+	require.Error(t, err, "existing backups are not overwritten")
+}
+
+func TestBackupPrune(t *testing.T) {
+	tests := []struct {
+		retain    int
+		scheduled int
+	}{
+		{retain: 0, scheduled: 4},
+		{retain: 1, scheduled: 4},
+		{retain: 3, scheduled: 4},
+		{retain: 4, scheduled: 4},
+		{retain: 5, scheduled: 4},
+	}
+
+	for _, tc := range tests {
+		t.Run(fmt.Sprintf("retain %d", tc.retain), func(t *testing.T) {
+			b := newTestBackups(t, tc.retain)
+			ctx := context.Background()
+
+			var names []string
+			for i := 0; i < tc.scheduled; i++ {
+				bi, err := b.create(ctx, fmt.Sprintf("%s%02d.cbor", scheduledBackupPrefix, i), true)
+				require.NoError(t, err)
+				names = append(names, bi.Name)
+			}
+			// backups made on request are never pruned
+			_, err := b.Create(ctx, "manual.cbor")
+			require.NoError(t, err)
+
+			require.NoError(t, b.prune())
+
+			expect := names
+			if tc.retain > 0 && tc.retain < len(names) {
+				expect = names[len(names)-tc.retain:]
+			}
+
+			all, err := b.List()
+			require.NoError(t, err)
+
+			var scheduled []string
+			var manual int
+			for _, bi := range all {
+				if bi.Scheduled {
+					scheduled = append(scheduled, bi.Name)
+				} else {
+					manual++
+				}
+			}
+			require.Equal(t, expect, scheduled)
+			require.Equal(t, 1, manual)
+		})
+	}
+}
@@ -3,18 +3,23 @@ package modules
 import (
 	"context"
 	"crypto/rand"
+	"encoding/json"
 	"errors"
 	"io"
 	"io/ioutil"
+	"sync"
+	"time"
 
 	"github.com/filecoin-project/go-jsonrpc/auth"
-	"github.com/gbrlsnchs/jwt/v3"
+	"github.com/google/uuid"
+	"github.com/ipfs/go-datastore"
 	logging "github.com/ipfs/go-log/v2"
 	"github.com/libp2p/go-libp2p-core/peerstore"
 	record "github.com/libp2p/go-libp2p-record"
 	"github.com/lyswifter/dbridge/api"
 	"github.com/lyswifter/dbridge/build"
 	"github.com/lyswifter/dbridge/lib/addrutil"
+	"github.com/lyswifter/dbridge/lib/jwtkeys"
 	"github.com/lyswifter/dbridge/node/modules/dtypes"
 	"github.com/lyswifter/dbridge/node/repo"
 	"github.com/lyswifter/dbridge/types"
@@ -41,7 +46,75 @@ type JwtPayload struct {
 	Allow []auth.Permission
 }
 
-func APISecret(keystore types.KeyStore, lr repo.LockedRepo) (*dtypes.APIAlg, error) {
+// apiKeysKey is the metadata datastore key under which the API signing key
+// ring is recorded. The secrets themselves are kept in the keystore.
+var apiKeysKey = datastore.NewKey("/auth/keys")
+
+type apiKeyRing struct {
+	Current string
+	Keys    []jwtkeys.Key
+}
+
+// apiKeysLk serializes key rotations
+var apiKeysLk sync.Mutex
+
+func jwtSecretName(id string) string {
+	if id == "" {
+		return JWTSecretName
+	}
+	return JWTSecretName + "-" + id
+}
+
+func APISecret(keystore types.KeyStore, lr repo.LockedRepo, ds dtypes.MetadataDS) (*jwtkeys.KeySet, error) {
+	ctx := context.TODO()
+
+	rb, err := ds.Get(ctx, apiKeysKey)
+	if errors.Is(err, datastore.ErrNotFound) {
+		// the secret was never rotated, only the original key exists
+		return legacyAPISecret(keystore, lr)
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("getting API key ring: %w", err)
+	}
+
+	var ring apiKeyRing
+	if err := json.Unmarshal(rb, &ring); err != nil {
+		return nil, xerrors.Errorf("decoding API key ring: %w", err)
+	}
+
+	var current *jwtkeys.Key
+	var others []jwtkeys.Key
+	now := time.Now()
+	for _, k := range ring.Keys {
+		if k.Expired(now) {
+			if err := keystore.Delete(jwtSecretName(k.ID)); err != nil && !errors.Is(err, types.ErrKeyInfoNotFound) {
+				log.Warnf("removing expired API secret %q: %s", k.ID, err)
+			}
+			continue
+		}
+
+		ki, err := keystore.Get(jwtSecretName(k.ID))
+		if err != nil {
+			return nil, xerrors.Errorf("getting API secret %q: %w", k.ID, err)
+		}
+		k.Secret = ki.PrivateKey
+
+		if k.ID == ring.Current {
+			k := k
+			current = &k
+			continue
+		}
+		others = append(others, k)
+	}
+
+	if current == nil {
+		return nil, xerrors.Errorf("current API secret %q not found in key ring", ring.Current)
+	}
+
+	return jwtkeys.New(*current, others...), nil
+}
+
+func legacyAPISecret(keystore types.KeyStore, lr repo.LockedRepo) (*jwtkeys.KeySet, error) {
 	key, err := keystore.Get(JWTSecretName)
 
 	if errors.Is(err, types.ErrKeyInfoNotFound) {
@@ -61,24 +134,103 @@ func APISecret(keystore types.KeyStore, lr repo.LockedRepo) (*dtypes.APIAlg, err
 			return nil, xerrors.Errorf("writing API secret: %w", err)
 		}
 
-		// TODO: make this configurable
-		p := JwtPayload{
-			Allow: api.AllPermissions,
-		}
-
-		cliToken, err := jwt.Sign(&p, jwt.NewHS256(key.PrivateKey))
-		if err != nil {
+		keys := jwtkeys.New(jwtkeys.Key{Secret: key.PrivateKey})
+		if err := issueCLIToken(lr, keys); err != nil {
 			return nil, err
 		}
 
-		if err := lr.SetAPIToken(cliToken); err != nil {
-			return nil, err
-		}
+		return keys, nil
 	} else if err != nil {
 		return nil, xerrors.Errorf("could not get JWT Token: %w", err)
 	}
 
-	return (*dtypes.APIAlg)(jwt.NewHS256(key.PrivateKey)), nil
+	return jwtkeys.New(jwtkeys.Key{Secret: key.PrivateKey}), nil
+}
+
+// RotateAPISecret creates a new API secret which is used to sign tokens from
+// now on. Tokens signed with previous secrets keep working for the grace
+// period. The token used by the local CLI is re-issued with the new secret.
+func RotateAPISecret(keystore types.KeyStore, lr repo.LockedRepo, ds dtypes.MetadataDS, keys *jwtkeys.KeySet, grace time.Duration) (jwtkeys.Key, error) {
+	apiKeysLk.Lock()
+	defer apiKeysLk.Unlock()
+
+	if grace < 0 {
+		return jwtkeys.Key{}, xerrors.Errorf("negative grace period: %s", grace)
+	}
+
+	sk, err := ioutil.ReadAll(io.LimitReader(rand.Reader, 32))
+	if err != nil {
+		return jwtkeys.Key{}, err
+	}
+
+	next := jwtkeys.Key{
+		ID:      uuid.New().String(),
+		Created: time.Now(),
+		Secret:  sk,
+	}
+
+	if err := keystore.Put(jwtSecretName(next.ID), types.KeyInfo{
+		Type:       KTJwtHmacSecret,
+		PrivateKey: sk,
+	}); err != nil {
+		return jwtkeys.Key{}, xerrors.Errorf("writing API secret: %w", err)
+	}
+
+	if err := keys.Rotate(next, grace); err != nil {
+		return jwtkeys.Key{}, err
+	}
+
+	ring := apiKeyRing{
+		Current: next.ID,
+		Keys:    keys.Keys(),
+	}
+	rb, err := json.Marshal(&ring)
+	if err != nil {
+		return jwtkeys.Key{}, err
+	}
+	if err := ds.Put(context.TODO(), apiKeysKey, rb); err != nil {
+		return jwtkeys.Key{}, xerrors.Errorf("writing API key ring: %w", err)
+	}
+
+	if err := issueCLIToken(lr, keys); err != nil {
+		return jwtkeys.Key{}, xerrors.Errorf("re-issuing CLI token: %w", err)
+	}
+
+	log.Infow("rotated API secret", "key", next.ID, "grace", grace)
+	return next, nil
+}
+
+func issueCLIToken(lr repo.LockedRepo, keys *jwtkeys.KeySet) error {
+	// TODO: make this configurable
+	p := JwtPayload{
+		Allow: api.AllPermissions,
+	}
+
+	cliToken, err := keys.Sign(&p)
+	if err != nil {
+		return err
+	}
+
+	return lr.SetAPIToken(cliToken)
+}
+
+// APIRoles resolves the method allowlists of the configured API roles.
+func APIRoles(roles map[string][]string) func() (dtypes.APIRoles, error) {
+	return func() (dtypes.APIRoles, error) {
+		out := dtypes.APIRoles{}
+		for role, allow := range roles {
+			methods, err := api.RoleMethods(allow)
+			if err != nil {
+				return nil, xerrors.Errorf("api role '%s': %w", role, err)
+			}
+
+			out[role], err = api.RolePermissions(methods)
+			if err != nil {
+				return nil, xerrors.Errorf("api role '%s': %w", role, err)
+			}
+		}
+		return out, nil
+	}
 }
 
 func ConfigBootstrap(peers []string) func() (dtypes.BootstrapPeers, error) {
@@ -1,10 +1,12 @@
 package dtypes
 
 import (
-	"github.com/gbrlsnchs/jwt/v3"
+	"github.com/filecoin-project/go-jsonrpc/auth"
 	"github.com/multiformats/go-multiaddr"
 )
 
-type APIAlg jwt.HMACSHA
-
 type APIEndpoint multiaddr.Multiaddr
+
+// APIRoles maps role names to the permissions granted to tokens issued for
+// the role.
+type APIRoles map[string][]auth.Permission
@@ -0,0 +1,5 @@
+package dtypes
+
+// KeyStorePassphrase returns the passphrase an encrypted keystore is unlocked
+// with, e.g. by prompting for it. It's only called for encrypted keystores.
+type KeyStorePassphrase func() ([]byte, error)
@@ -0,0 +1,118 @@
+package modules
+
+import (
+	"context"
+	"path/filepath"
+
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+	"go.uber.org/fx"
+	"golang.org/x/xerrors"
+
+	"github.com/lyswifter/dbridge/build"
+	"github.com/lyswifter/dbridge/lib/journal"
+	"github.com/lyswifter/dbridge/node/config"
+	"github.com/lyswifter/dbridge/node/repo"
+)
+
+// OpenFilesystemJournal opens the journal in the repo, or returns a journal
+// discarding all events when it's disabled in the config.
+func OpenFilesystemJournal(cfg config.Journal) func(lr repo.LockedRepo, lc fx.Lifecycle) (journal.Journal, error) {
+	return func(lr repo.LockedRepo, lc fx.Lifecycle) (journal.Journal, error) {
+		if cfg.Disable {
+			return journal.NilJournal(), nil
+		}
+
+		disabled, err := journal.ParseDisabledEvents(cfg.DisabledEvents)
+		if err != nil {
+			return nil, xerrors.Errorf("parsing disabled journal events: %w", err)
+		}
+
+		jrnl, err := journal.OpenFSJournal(filepath.Join(lr.Path(), "journal"), cfg.MaxFileSize, cfg.MaxFiles, disabled)
+		if err != nil {
+			return nil, err
+		}
+
+		lc.Append(fx.Hook{
+			OnStop: func(_ context.Context) error { return jrnl.Close() },
+		})
+
+		return jrnl, nil
+	}
+}
+
+type NodeEvt struct {
+	Version string
+}
+
+// InitJournal records the node starting and shutting down. It's invoked
+// first, so that the shutdown event is recorded after all other components
+// have stopped.
+func InitJournal(lc fx.Lifecycle, j journal.Journal) {
+	var (
+		evtStarted  = j.RegisterEventType("node", "started")
+		evtShutdown = j.RegisterEventType("node", "shutdown")
+	)
+
+	lc.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			j.RecordEvent(evtStarted, func() interface{} {
+				return NodeEvt{Version: build.UserVersion()}
+			})
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			j.RecordEvent(evtShutdown, func() interface{} {
+				return NodeEvt{Version: build.UserVersion()}
+			})
+			return nil
+		},
+	})
+}
+
+type PeerConnEvt struct {
+	Peer      peer.ID
+	Addr      ma.Multiaddr
+	Direction string
+}
+
+// JournalNetEvents records peers connecting to and disconnecting from the
+// node.
+func JournalNetEvents(lc fx.Lifecycle, h host.Host, j journal.Journal) {
+	var (
+		evtConnected    = j.RegisterEventType("net", "peer_connected")
+		evtDisconnected = j.RegisterEventType("net", "peer_disconnected")
+	)
+
+	record := func(et journal.EventType, c network.Conn) {
+		j.RecordEvent(et, func() interface{} {
+			return PeerConnEvt{
+				Peer:      c.RemotePeer(),
+				Addr:      c.RemoteMultiaddr(),
+				Direction: c.Stat().Direction.String(),
+			}
+		})
+	}
+
+	nb := &network.NotifyBundle{
+		ConnectedF: func(_ network.Network, c network.Conn) {
+			record(evtConnected, c)
+		},
+		DisconnectedF: func(_ network.Network, c network.Conn) {
+			record(evtDisconnected, c)
+		},
+	}
+
+	lc.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			h.Network().Notify(nb)
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			h.Network().StopNotify(nb)
+			return nil
+		},
+	})
+}
@@ -0,0 +1,117 @@
+package modules
+
+import (
+	"context"
+	"strings"
+
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"golang.org/x/xerrors"
+
+	"github.com/lyswifter/dbridge/api"
+	"github.com/lyswifter/dbridge/node/modules/lp2p"
+	"github.com/lyswifter/dbridge/node/repo"
+	"github.com/lyswifter/dbridge/types"
+)
+
+// Keys manages the keys in a keystore, for the key API, and for the key
+// commands when the node isn't running.
+type Keys struct {
+	ks types.KeyStore
+}
+
+func NewKeys(ks types.KeyStore) *Keys {
+	return &Keys{ks: ks}
+}
+
+// nodeKeyTypes are the types of the keys the node uses itself
+var nodeKeyTypes = map[types.KeyType]struct{}{
+	lp2p.KTLibp2pHost: {},
+	KTJwtHmacSecret:   {},
+	repo.KTBackupKey:  {},
+}
+
+func (k *Keys) KeyList(ctx context.Context) ([]api.KeyEntry, error) {
+	names, err := k.ks.List()
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]api.KeyEntry, 0, len(names))
+	for _, name := range names {
+		ki, err := k.ks.Get(name)
+		if err != nil {
+			return nil, err
+		}
+
+		ent := api.KeyEntry{Name: name, Type: ki.Type}
+		if ki.Type == lp2p.KTLibp2pHost {
+			if ent.PeerID, err = libp2pPeerID(ki); err != nil {
+				return nil, xerrors.Errorf("key '%s': %w", name, err)
+			}
+		}
+		out = append(out, ent)
+	}
+	return out, nil
+}
+
+func (k *Keys) KeyExport(ctx context.Context, name string, passphrase []byte) ([]byte, error) {
+	ki, err := k.ks.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	return repo.ExportKey(name, ki, passphrase)
+}
+
+func (k *Keys) KeyImport(ctx context.Context, name string, exported []byte, passphrase []byte) (string, error) {
+	exportedName, ki, err := repo.ImportKey(exported, passphrase)
+	if err != nil {
+		return "", err
+	}
+	if name == "" {
+		name = exportedName
+	}
+
+	if name == "" {
+		return "", xerrors.New("key name is empty")
+	}
+	if strings.HasPrefix(name, repo.KTrashPrefix) {
+		return "", xerrors.Errorf("key names starting with %q are reserved for removed keys", repo.KTrashPrefix)
+	}
+	if ki.Type == lp2p.KTLibp2pHost {
+		if _, err := libp2pPeerID(ki); err != nil {
+			return "", xerrors.Errorf("invalid libp2p key: %w", err)
+		}
+	}
+
+	return name, k.ks.Put(name, ki)
+}
+
+func (k *Keys) KeyDelete(ctx context.Context, name string, force bool) error {
+	ki, err := k.ks.Get(name)
+	if err != nil {
+		return err
+	}
+
+	if _, used := nodeKeyTypes[ki.Type]; used && !force {
+		return xerrors.Errorf("key '%s' of type %s is used by the node, removing it needs force", name, ki.Type)
+	}
+
+	return k.ks.Delete(name)
+}
+
+func (k *Keys) KeyRotateLibp2p(ctx context.Context) (peer.ID, error) {
+	pk, err := lp2p.RotatePrivKey(k.ks)
+	if err != nil {
+		return "", err
+	}
+	return peer.IDFromPrivateKey(pk)
+}
+
+func libp2pPeerID(ki types.KeyInfo) (peer.ID, error) {
+	pk, err := crypto.UnmarshalPrivateKey(ki.PrivateKey)
+	if err != nil {
+		return "", err
+	}
+	return peer.IDFromPrivateKey(pk)
+}
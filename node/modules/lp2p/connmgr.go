@@ -0,0 +1,173 @@
+package lp2p
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	basicconnmgr "github.com/libp2p/go-libp2p-connmgr"
+	"github.com/libp2p/go-libp2p-core/connmgr"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	ma "github.com/multiformats/go-multiaddr"
+)
+
+// ConnMgr is a connection manager whose watermarks can be changed while the
+// node is running. It delegates to a basic connection manager, which is
+// replaced when the limits change.
+type ConnMgr struct {
+	lk sync.RWMutex
+	cm *basicconnmgr.BasicConnMgr
+
+	// protections are tracked here, so that they carry over to the new
+	// connection manager when the limits change
+	protected map[peer.ID]map[string]struct{}
+}
+
+var _ connmgr.ConnManager = (*ConnMgr)(nil)
+
+func NewConnMgr(low, high int, grace time.Duration) (*ConnMgr, error) {
+	cm, err := basicconnmgr.NewConnManager(low, high, basicconnmgr.WithGracePeriod(grace))
+	if err != nil {
+		return nil, err
+	}
+
+	return &ConnMgr{
+		cm:        cm,
+		protected: map[peer.ID]map[string]struct{}{},
+	}, nil
+}
+
+// SetLimits replaces the watermarks and grace period. Connections open on n
+// are handed over to the new limits along with their tags, and start a new
+// grace period. Connection notifications wait for the swap, so that none are
+// only seen by the old connection manager.
+func (m *ConnMgr) SetLimits(n network.Network, low, high int, grace time.Duration) error {
+	ncm, err := basicconnmgr.NewConnManager(low, high, basicconnmgr.WithGracePeriod(grace))
+	if err != nil {
+		return err
+	}
+
+	m.lk.Lock()
+	old := m.cm
+
+	for p, tags := range m.protected {
+		for tag := range tags {
+			ncm.Protect(p, tag)
+		}
+	}
+
+	nn := ncm.Notifee()
+	for _, c := range n.Conns() {
+		nn.Connected(n, c)
+	}
+
+	for _, p := range n.Peers() {
+		ti := old.GetTagInfo(p)
+		if ti == nil {
+			continue
+		}
+		for tag, v := range ti.Tags {
+			ncm.TagPeer(p, tag, v)
+		}
+	}
+
+	m.cm = ncm
+	m.lk.Unlock()
+
+	return old.Close()
+}
+
+// GetInfo returns the configuration and status of the current connection
+// manager.
+func (m *ConnMgr) GetInfo() basicconnmgr.CMInfo {
+	return m.current().GetInfo()
+}
+
+func (m *ConnMgr) current() *basicconnmgr.BasicConnMgr {
+	m.lk.RLock()
+	defer m.lk.RUnlock()
+	return m.cm
+}
+
+func (m *ConnMgr) TagPeer(p peer.ID, tag string, val int) {
+	m.current().TagPeer(p, tag, val)
+}
+
+func (m *ConnMgr) UntagPeer(p peer.ID, tag string) {
+	m.current().UntagPeer(p, tag)
+}
+
+func (m *ConnMgr) UpsertTag(p peer.ID, tag string, upsert func(int) int) {
+	m.current().UpsertTag(p, tag, upsert)
+}
+
+func (m *ConnMgr) GetTagInfo(p peer.ID) *connmgr.TagInfo {
+	return m.current().GetTagInfo(p)
+}
+
+func (m *ConnMgr) TrimOpenConns(ctx context.Context) {
+	m.current().TrimOpenConns(ctx)
+}
+
+func (m *ConnMgr) Notifee() network.Notifiee {
+	return (*cmNotifee)(m)
+}
+
+func (m *ConnMgr) Protect(id peer.ID, tag string) {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	tags, ok := m.protected[id]
+	if !ok {
+		tags = map[string]struct{}{}
+		m.protected[id] = tags
+	}
+	tags[tag] = struct{}{}
+
+	m.cm.Protect(id, tag)
+}
+
+func (m *ConnMgr) Unprotect(id peer.ID, tag string) (protected bool) {
+	m.lk.Lock()
+	defer m.lk.Unlock()
+
+	if tags, ok := m.protected[id]; ok {
+		delete(tags, tag)
+		if len(tags) == 0 {
+			delete(m.protected, id)
+		}
+	}
+
+	return m.cm.Unprotect(id, tag)
+}
+
+func (m *ConnMgr) IsProtected(id peer.ID, tag string) (protected bool) {
+	return m.current().IsProtected(id, tag)
+}
+
+func (m *ConnMgr) Close() error {
+	return m.current().Close()
+}
+
+// cmNotifee forwards connection notifications to the current connection
+// manager. The lock is held while forwarding, as SetLimits hands over the open
+// connections under it.
+type cmNotifee ConnMgr
+
+func (nn *cmNotifee) Connected(n network.Network, c network.Conn) {
+	nn.lk.RLock()
+	defer nn.lk.RUnlock()
+	nn.cm.Notifee().Connected(n, c)
+}
+
+func (nn *cmNotifee) Disconnected(n network.Network, c network.Conn) {
+	nn.lk.RLock()
+	defer nn.lk.RUnlock()
+	nn.cm.Notifee().Disconnected(n, c)
+}
+
+func (nn *cmNotifee) Listen(n network.Network, addr ma.Multiaddr)      {}
+func (nn *cmNotifee) ListenClose(n network.Network, addr ma.Multiaddr) {}
+func (nn *cmNotifee) OpenedStream(network.Network, network.Stream)     {}
+func (nn *cmNotifee) ClosedStream(network.Network, network.Stream)     {}
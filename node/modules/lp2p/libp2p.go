@@ -5,12 +5,12 @@ import (
 	"time"
 
 	"github.com/lyswifter/dbridge/build"
+	"github.com/lyswifter/dbridge/node/repo"
 	"github.com/lyswifter/dbridge/types"
 	"golang.org/x/xerrors"
 
 	logging "github.com/ipfs/go-log/v2"
 	"github.com/libp2p/go-libp2p"
-	connmgr "github.com/libp2p/go-libp2p-connmgr"
 	"github.com/libp2p/go-libp2p-core/crypto"
 	"github.com/libp2p/go-libp2p-core/peer"
 	"github.com/libp2p/go-libp2p-core/peerstore"
@@ -57,6 +57,41 @@ func PrivKey(ks types.KeyStore) (crypto.PrivKey, error) {
 	return pk, nil
 }
 
+// RotatePrivKey replaces the libp2p host key with a new one, which PrivKey
+// returns from then on. The old key is kept under a trash- prefixed name.
+func RotatePrivKey(ks types.KeyStore) (crypto.PrivKey, error) {
+	pk, err := genLibp2pKey()
+	if err != nil {
+		return nil, err
+	}
+	kbytes, err := crypto.MarshalPrivateKey(pk)
+	if err != nil {
+		return nil, err
+	}
+
+	old, err := ks.Get(KLibp2pHost)
+	switch {
+	case err == nil:
+		if err := ks.Put(repo.KTrashPrefix+KLibp2pHost, old); err != nil {
+			return nil, xerrors.Errorf("keeping old libp2p key: %w", err)
+		}
+		if err := ks.Delete(KLibp2pHost); err != nil {
+			return nil, xerrors.Errorf("removing old libp2p key: %w", err)
+		}
+	case !xerrors.Is(err, types.ErrKeyInfoNotFound):
+		return nil, err
+	}
+
+	if err := ks.Put(KLibp2pHost, types.KeyInfo{
+		Type:       KTLibp2pHost,
+		PrivateKey: kbytes,
+	}); err != nil {
+		return nil, xerrors.Errorf("writing new libp2p key: %w", err)
+	}
+
+	return pk, nil
+}
+
 func genLibp2pKey() (crypto.PrivKey, error) {
 	pk, _, err := crypto.GenerateEd25519Key(rand.Reader)
 	if err != nil {
@@ -69,7 +104,7 @@ func genLibp2pKey() (crypto.PrivKey, error) {
 
 func ConnectionManager(low, high uint, grace time.Duration, protected []string) func() (opts Libp2pOpts, err error) {
 	return func() (Libp2pOpts, error) {
-		cm, err := connmgr.NewConnManager(int(low), int(high), connmgr.WithGracePeriod(grace))
+		cm, err := NewConnMgr(int(low), int(high), grace)
 		if err != nil {
 			return Libp2pOpts{}, err
 		}
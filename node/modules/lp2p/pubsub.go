@@ -1,6 +1,7 @@
 package lp2p
 
 import (
+	"context"
 	"encoding/json"
 	"net"
 	"time"
@@ -11,10 +12,13 @@ import (
 	pubsub_pb "github.com/libp2p/go-libp2p-pubsub/pb"
 	blake2b "github.com/minio/blake2b-simd"
 	ma "github.com/multiformats/go-multiaddr"
+	"go.opencensus.io/stats"
 	"go.uber.org/fx"
 	"golang.org/x/xerrors"
 
 	"github.com/lyswifter/dbridge/build"
+	"github.com/lyswifter/dbridge/lib/journal"
+	"github.com/lyswifter/dbridge/metrics"
 	"github.com/lyswifter/dbridge/node/config"
 	"github.com/lyswifter/dbridge/node/modules/dtypes"
 	"github.com/lyswifter/dbridge/node/modules/helpers"
@@ -56,6 +60,7 @@ type GossipIn struct {
 	Db   dtypes.DrandBootstrap
 	Cfg  *config.Pubsub
 	Sk   *dtypes.ScoreKeeper
+	J    journal.Journal
 }
 
 func getDrandTopic(chainInfoJSON string) (string, error) {
@@ -341,29 +346,29 @@ func GossipSub(in GossipIn) (service *pubsub.PubSub, err error) {
 				100)))
 
 	// tracer
-	// if in.Cfg.RemoteTracer != "" {
-	// 	a, err := ma.NewMultiaddr(in.Cfg.RemoteTracer)
-	// 	if err != nil {
-	// 		return nil, err
-	// 	}
+	if in.Cfg.RemoteTracer != "" {
+		a, err := ma.NewMultiaddr(in.Cfg.RemoteTracer)
+		if err != nil {
+			return nil, err
+		}
 
-	// 	pi, err := peer.AddrInfoFromP2pAddr(a)
-	// 	if err != nil {
-	// 		return nil, err
-	// 	}
+		pi, err := peer.AddrInfoFromP2pAddr(a)
+		if err != nil {
+			return nil, err
+		}
 
-	// 	tr, err := pubsub.NewRemoteTracer(context.TODO(), in.Host, *pi)
-	// 	if err != nil {
-	// 		return nil, err
-	// 	}
+		tr, err := pubsub.NewRemoteTracer(context.TODO(), in.Host, *pi)
+		if err != nil {
+			return nil, err
+		}
 
-	// 	trw := newTracerWrapper(tr, build.BlocksTopic(in.Nn))
-	// 	options = append(options, pubsub.WithEventTracer(trw))
-	// } else {
-	// 	// still instantiate a tracer for collecting metrics
-	// 	trw := newTracerWrapper(nil)
-	// 	options = append(options, pubsub.WithEventTracer(trw))
-	// }
+		trw := newTracerWrapper(tr, in.J, build.BlocksTopic(in.Nn))
+		options = append(options, pubsub.WithEventTracer(trw))
+	} else {
+		// still instantiate a tracer for collecting metrics
+		trw := newTracerWrapper(nil, in.J)
+		options = append(options, pubsub.WithEventTracer(trw))
+	}
 
 	return pubsub.NewGossipSub(helpers.LifecycleCtx(in.Mctx, in.Lc), in.Host, options...)
 }
@@ -373,71 +378,93 @@ func HashMsgId(m *pubsub_pb.Message) string {
 	return string(hash[:])
 }
 
-// func newTracerWrapper(tr pubsub.EventTracer, topics ...string) pubsub.EventTracer {
-// 	var topicsMap map[string]struct{}
-// 	if len(topics) > 0 {
-// 		topicsMap = make(map[string]struct{})
-// 		for _, topic := range topics {
-// 			topicsMap[topic] = struct{}{}
-// 		}
-// 	}
-
-// 	return &tracerWrapper{tr: tr, topics: topicsMap}
-// }
-
-// type tracerWrapper struct {
-// 	tr     pubsub.EventTracer
-// 	topics map[string]struct{}
-// }
-
-// func (trw *tracerWrapper) traceMessage(topic string) bool {
-// 	_, ok := trw.topics[topic]
-// 	return ok
-// }
-
-// func (trw *tracerWrapper) Trace(evt *pubsub_pb.TraceEvent) {
-// 	// this filters the trace events reported to the remote tracer to include only
-// 	// JOIN/LEAVE/GRAFT/PRUNE/PUBLISH/DELIVER. This significantly reduces bandwidth usage and still
-// 	// collects enough data to recover the state of the mesh and compute message delivery latency
-// 	// distributions.
-// 	// Furthermore, we only trace message publication and deliveries for specified topics
-// 	// (here just the blocks topic).
-// 	switch evt.GetType() {
-// 	case pubsub_pb.TraceEvent_PUBLISH_MESSAGE:
-// 		stats.Record(context.TODO(), metrics.PubsubPublishMessage.M(1))
-// 		if trw.tr != nil && trw.traceMessage(evt.GetPublishMessage().GetTopic()) {
-// 			trw.tr.Trace(evt)
-// 		}
-// 	case pubsub_pb.TraceEvent_DELIVER_MESSAGE:
-// 		stats.Record(context.TODO(), metrics.PubsubDeliverMessage.M(1))
-// 		if trw.tr != nil && trw.traceMessage(evt.GetDeliverMessage().GetTopic()) {
-// 			trw.tr.Trace(evt)
-// 		}
-// 	case pubsub_pb.TraceEvent_REJECT_MESSAGE:
-// 		stats.Record(context.TODO(), metrics.PubsubRejectMessage.M(1))
-// 	case pubsub_pb.TraceEvent_DUPLICATE_MESSAGE:
-// 		stats.Record(context.TODO(), metrics.PubsubDuplicateMessage.M(1))
-// 	case pubsub_pb.TraceEvent_JOIN:
-// 		if trw.tr != nil {
-// 			trw.tr.Trace(evt)
-// 		}
-// 	case pubsub_pb.TraceEvent_LEAVE:
-// 		if trw.tr != nil {
-// 			trw.tr.Trace(evt)
-// 		}
-// 	case pubsub_pb.TraceEvent_GRAFT:
-// 		if trw.tr != nil {
-// 			trw.tr.Trace(evt)
-// 		}
-// 	case pubsub_pb.TraceEvent_PRUNE:
-// 		if trw.tr != nil {
-// 			trw.tr.Trace(evt)
-// 		}
-// 	case pubsub_pb.TraceEvent_RECV_RPC:
-// 		stats.Record(context.TODO(), metrics.PubsubRecvRPC.M(1))
-// 	case pubsub_pb.TraceEvent_SEND_RPC:
-// 		stats.Record(context.TODO(), metrics.PubsubSendRPC.M(1))
-// 	case pubsub_pb.TraceEvent_DROP_RPC:
-// 		stats.Record(context.TODO(), metrics.PubsubDropRPC.M(1))
-// 	}
-// }
+func newTracerWrapper(tr pubsub.EventTracer, j journal.Journal, topics ...string) pubsub.EventTracer {
+	var topicsMap map[string]struct{}
+	if len(topics) > 0 {
+		topicsMap = make(map[string]struct{})
+		for _, topic := range topics {
+			topicsMap[topic] = struct{}{}
+		}
+	}
+
+	return &tracerWrapper{
+		tr:        tr,
+		topics:    topicsMap,
+		j:         j,
+		evtReject: j.RegisterEventType("pubsub", "reject"),
+	}
+}
+
+type tracerWrapper struct {
+	tr     pubsub.EventTracer
+	topics map[string]struct{}
+
+	j         journal.Journal
+	evtReject journal.EventType
+}
+
+type PubsubRejectEvt struct {
+	Topic  string
+	From   peer.ID
+	Reason string
+}
+
+func (trw *tracerWrapper) traceMessage(topic string) bool {
+	_, ok := trw.topics[topic]
+	return ok
+}
+
+func (trw *tracerWrapper) Trace(evt *pubsub_pb.TraceEvent) {
+	// this filters the trace events reported to the remote tracer to include only
+	// JOIN/LEAVE/GRAFT/PRUNE/PUBLISH/DELIVER. This significantly reduces bandwidth usage and still
+	// collects enough data to recover the state of the mesh and compute message delivery latency
+	// distributions.
+	// Furthermore, we only trace message publication and deliveries for specified topics
+	// (here just the blocks topic).
+	switch evt.GetType() {
+	case pubsub_pb.TraceEvent_PUBLISH_MESSAGE:
+		stats.Record(context.TODO(), metrics.PubsubPublishMessage.M(1))
+		if trw.tr != nil && trw.traceMessage(evt.GetPublishMessage().GetTopic()) {
+			trw.tr.Trace(evt)
+		}
+	case pubsub_pb.TraceEvent_DELIVER_MESSAGE:
+		stats.Record(context.TODO(), metrics.PubsubDeliverMessage.M(1))
+		if trw.tr != nil && trw.traceMessage(evt.GetDeliverMessage().GetTopic()) {
+			trw.tr.Trace(evt)
+		}
+	case pubsub_pb.TraceEvent_REJECT_MESSAGE:
+		stats.Record(context.TODO(), metrics.PubsubRejectMessage.M(1))
+		trw.j.RecordEvent(trw.evtReject, func() interface{} {
+			rej := evt.GetRejectMessage()
+			return PubsubRejectEvt{
+				Topic:  rej.GetTopic(),
+				From:   peer.ID(rej.GetReceivedFrom()),
+				Reason: rej.GetReason(),
+			}
+		})
+	case pubsub_pb.TraceEvent_DUPLICATE_MESSAGE:
+		stats.Record(context.TODO(), metrics.PubsubDuplicateMessage.M(1))
+	case pubsub_pb.TraceEvent_JOIN:
+		if trw.tr != nil {
+			trw.tr.Trace(evt)
+		}
+	case pubsub_pb.TraceEvent_LEAVE:
+		if trw.tr != nil {
+			trw.tr.Trace(evt)
+		}
+	case pubsub_pb.TraceEvent_GRAFT:
+		if trw.tr != nil {
+			trw.tr.Trace(evt)
+		}
+	case pubsub_pb.TraceEvent_PRUNE:
+		if trw.tr != nil {
+			trw.tr.Trace(evt)
+		}
+	case pubsub_pb.TraceEvent_RECV_RPC:
+		stats.Record(context.TODO(), metrics.PubsubRecvRPC.M(1))
+	case pubsub_pb.TraceEvent_SEND_RPC:
+		stats.Record(context.TODO(), metrics.PubsubSendRPC.M(1))
+	case pubsub_pb.TraceEvent_DROP_RPC:
+		stats.Record(context.TODO(), metrics.PubsubDropRPC.M(1))
+	}
+}
@@ -0,0 +1,338 @@
+package modules
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"go.uber.org/fx"
+	"golang.org/x/xerrors"
+
+	"github.com/lyswifter/dbridge/api"
+	"github.com/lyswifter/dbridge/lib/addrutil"
+	"github.com/lyswifter/dbridge/lib/journal"
+	"github.com/lyswifter/dbridge/lib/ratelimit"
+	"github.com/lyswifter/dbridge/node/config"
+	"github.com/lyswifter/dbridge/node/modules/lp2p"
+	"github.com/lyswifter/dbridge/node/repo"
+)
+
+const (
+	// protectedPeersTag is the connection manager tag of Libp2p.ProtectedPeers
+	protectedPeersTag = "config-prot"
+	// directPeersTag is the connection manager tag of Pubsub.DirectPeers
+	// added by config reloads
+	directPeersTag = "pubsub-direct"
+)
+
+// ConfigReloader re-reads the config file and applies the settings which can
+// be changed while the node is running. Reloads are triggered by SIGHUP and
+// through the ConfigReload API.
+type ConfigReloader struct {
+	lr      repo.LockedRepo
+	host    host.Host
+	limiter *ratelimit.Limiter
+
+	j         journal.Journal
+	evtReload journal.EventType
+
+	lk sync.Mutex
+	// cur holds the config the node is running with; fields which need a
+	// restart keep their value from startup
+	cur *config.BdridgeNode
+	// directPeers are the direct peers whose connections are protected, which
+	// follow the config file while direct peering keeps its startup value
+	directPeers []string
+}
+
+type ConfigReloaderParams struct {
+	fx.In
+
+	Lc      fx.Lifecycle
+	Repo    repo.LockedRepo
+	Journal journal.Journal
+	Host    host.Host          `optional:"true"`
+	Limiter *ratelimit.Limiter `optional:"true"`
+}
+
+type ConfigReloadEvt struct {
+	Changes []api.ConfigChange
+}
+
+func NewConfigReloader(cfg *config.BdridgeNode) func(ConfigReloaderParams) *ConfigReloader {
+	return func(p ConfigReloaderParams) *ConfigReloader {
+		cur := *cfg
+		r := &ConfigReloader{
+			lr:        p.Repo,
+			host:      p.Host,
+			limiter:   p.Limiter,
+			j:         p.Journal,
+			evtReload: p.Journal.RegisterEventType("config", "reload"),
+			cur:       &cur,
+
+			directPeers: cfg.Pubsub.DirectPeers,
+		}
+
+		sigCh := make(chan os.Signal, 1)
+		stop := make(chan struct{})
+		p.Lc.Append(fx.Hook{
+			OnStart: func(context.Context) error {
+				signal.Notify(sigCh, syscall.SIGHUP)
+				go r.handleSignals(sigCh, stop)
+				return nil
+			},
+			OnStop: func(context.Context) error {
+				signal.Stop(sigCh)
+				close(stop)
+				return nil
+			},
+		})
+
+		return r
+	}
+}
+
+func (r *ConfigReloader) handleSignals(sigCh <-chan os.Signal, stop <-chan struct{}) {
+	for {
+		select {
+		case <-sigCh:
+			log.Info("received SIGHUP, reloading config")
+
+			changes, err := r.Reload(context.TODO())
+			if err != nil {
+				log.Errorf("reloading config: %s", err)
+				continue
+			}
+			if len(changes) == 0 {
+				log.Info("config unchanged")
+			}
+			for _, c := range changes {
+				if c.Applied {
+					log.Infow("config change applied", "field", c.Field, "note", c.Note)
+				} else {
+					log.Warnw("config change needs a restart", "field", c.Field, "note", c.Note)
+				}
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Reload re-reads the config file, applies the changes which can be applied
+// live, and reports all fields which differ from the running config.
+func (r *ConfigReloader) Reload(ctx context.Context) ([]api.ConfigChange, error) {
+	c, err := r.lr.Config()
+	if err != nil {
+		return nil, xerrors.Errorf("reading config: %w", err)
+	}
+	next, ok := c.(*config.BdridgeNode)
+	if !ok {
+		return nil, xerrors.Errorf("invalid config from repo, got: %T", c)
+	}
+
+	r.lk.Lock()
+	defer r.lk.Unlock()
+
+	// gossipsub sets up direct peering when it starts, so a change needs a
+	// restart, but connections to the new direct peers are protected now, also
+	// when the file goes back to the startup value
+	var directErr error
+	if len(config.Diff(r.directPeers, next.Pubsub.DirectPeers)) > 0 {
+		directErr = r.applyDirectPeers(ctx, r.directPeers, next.Pubsub.DirectPeers)
+		if directErr == nil {
+			r.directPeers = next.Pubsub.DirectPeers
+		}
+	}
+
+	fields := config.Diff(r.cur, next)
+	if len(fields) == 0 {
+		return []api.ConfigChange{}, nil
+	}
+
+	results := map[string]api.ConfigChange{}
+	set := func(err error, note string, fields ...string) {
+		for _, f := range fields {
+			ch := api.ConfigChange{Field: f, Applied: err == nil, Note: note}
+			if err != nil {
+				ch.Note = err.Error()
+			}
+			results[f] = ch
+		}
+	}
+
+	changed := map[string]bool{}
+	for _, f := range fields {
+		changed[f] = true
+	}
+
+	if changed["Libp2p.ConnMgrLow"] || changed["Libp2p.ConnMgrHigh"] || changed["Libp2p.ConnMgrGrace"] {
+		err := r.applyConnMgrLimits(next.Libp2p)
+		if err == nil {
+			r.cur.Libp2p.ConnMgrLow = next.Libp2p.ConnMgrLow
+			r.cur.Libp2p.ConnMgrHigh = next.Libp2p.ConnMgrHigh
+			r.cur.Libp2p.ConnMgrGrace = next.Libp2p.ConnMgrGrace
+		}
+		set(err, "", "Libp2p.ConnMgrLow", "Libp2p.ConnMgrHigh", "Libp2p.ConnMgrGrace")
+	}
+
+	if changed["Libp2p.ProtectedPeers"] {
+		err := r.applyProtectedPeers(r.cur.Libp2p.ProtectedPeers, next.Libp2p.ProtectedPeers)
+		if err == nil {
+			r.cur.Libp2p.ProtectedPeers = next.Libp2p.ProtectedPeers
+		}
+		set(err, "", "Libp2p.ProtectedPeers")
+	}
+
+	if changed["Pubsub.DirectPeers"] {
+		ch := api.ConfigChange{
+			Field: "Pubsub.DirectPeers",
+			Note:  "requires a restart, connections to the direct peers are kept open meanwhile",
+		}
+		if directErr != nil {
+			ch.Note = "requires a restart, protecting connections to the direct peers failed: " + directErr.Error()
+		}
+		results[ch.Field] = ch
+	}
+
+	if changed["API.RateLimits"] {
+		err := r.applyRateLimits(next.API.RateLimits)
+		if err == nil {
+			r.cur.API.RateLimits = next.API.RateLimits
+		}
+		set(err, "", "API.RateLimits")
+	}
+
+	out := make([]api.ConfigChange, 0, len(fields))
+	for _, f := range fields {
+		ch, ok := results[f]
+		if !ok {
+			ch = api.ConfigChange{Field: f, Note: "requires a restart"}
+		}
+		out = append(out, ch)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Field < out[j].Field
+	})
+
+	r.j.RecordEvent(r.evtReload, func() interface{} {
+		return ConfigReloadEvt{Changes: out}
+	})
+
+	return out, nil
+}
+
+func (r *ConfigReloader) connMgr() (*lp2p.ConnMgr, error) {
+	if r.host == nil {
+		return nil, xerrors.New("libp2p host not running")
+	}
+	cm, ok := r.host.ConnManager().(*lp2p.ConnMgr)
+	if !ok {
+		return nil, xerrors.Errorf("connection manager %T can't be reconfigured", r.host.ConnManager())
+	}
+	return cm, nil
+}
+
+func (r *ConfigReloader) applyConnMgrLimits(cfg config.Libp2p) error {
+	cm, err := r.connMgr()
+	if err != nil {
+		return err
+	}
+
+	if cfg.ConnMgrLow > cfg.ConnMgrHigh {
+		return xerrors.Errorf("ConnMgrLow (%d) is above ConnMgrHigh (%d)", cfg.ConnMgrLow, cfg.ConnMgrHigh)
+	}
+
+	return cm.SetLimits(r.host.Network(), int(cfg.ConnMgrLow), int(cfg.ConnMgrHigh), time.Duration(cfg.ConnMgrGrace))
+}
+
+func (r *ConfigReloader) applyProtectedPeers(prev, next []string) error {
+	cm, err := r.connMgr()
+	if err != nil {
+		return err
+	}
+
+	parse := func(ps []string) (map[peer.ID]struct{}, error) {
+		out := map[peer.ID]struct{}{}
+		for _, p := range ps {
+			pid, err := peer.IDFromString(p)
+			if err != nil {
+				return nil, xerrors.Errorf("failed to parse peer ID in protected peers array: %w", err)
+			}
+			out[pid] = struct{}{}
+		}
+		return out, nil
+	}
+
+	// the previous value was accepted at startup, or by an earlier reload
+	prevIDs, _ := parse(prev)
+	nextIDs, err := parse(next)
+	if err != nil {
+		return err
+	}
+
+	for pid := range prevIDs {
+		if _, ok := nextIDs[pid]; !ok {
+			cm.Unprotect(pid, protectedPeersTag)
+		}
+	}
+	for pid := range nextIDs {
+		cm.Protect(pid, protectedPeersTag)
+	}
+	return nil
+}
+
+func (r *ConfigReloader) applyDirectPeers(ctx context.Context, prev, next []string) error {
+	cm, err := r.connMgr()
+	if err != nil {
+		return err
+	}
+
+	nextInfos, err := addrutil.ParseAddresses(ctx, next)
+	if err != nil {
+		return xerrors.Errorf("parsing direct peers: %w", err)
+	}
+	prevInfos, _ := addrutil.ParseAddresses(ctx, prev)
+
+	keep := map[peer.ID]struct{}{}
+	for _, pi := range nextInfos {
+		keep[pi.ID] = struct{}{}
+	}
+	for _, pi := range prevInfos {
+		if _, ok := keep[pi.ID]; !ok {
+			cm.Unprotect(pi.ID, directPeersTag)
+		}
+	}
+
+	for _, pi := range nextInfos {
+		cm.Protect(pi.ID, directPeersTag)
+
+		go func(pi peer.AddrInfo) {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+
+			if err := r.host.Connect(ctx, pi); err != nil {
+				log.Warnf("connecting to direct peer %s: %s", pi.ID, err)
+			}
+		}(pi)
+	}
+	return nil
+}
+
+func (r *ConfigReloader) applyRateLimits(cfg map[string]config.RateLimit) error {
+	if r.limiter == nil {
+		return xerrors.New("rate limiting was disabled at startup, enabling it requires a restart")
+	}
+
+	limits := map[string]ratelimit.Limit{}
+	for class, l := range cfg {
+		limits[class] = ratelimit.Limit(l)
+	}
+	return r.limiter.SetLimits(limits)
+}
@@ -3,8 +3,10 @@ package modules
 import (
 	"context"
 	"path/filepath"
+	"time"
 
 	"github.com/lyswifter/dbridge/lib/backupds"
+	"github.com/lyswifter/dbridge/node/config"
 	"github.com/lyswifter/dbridge/node/modules/dtypes"
 	"github.com/lyswifter/dbridge/node/modules/helpers"
 	"github.com/lyswifter/dbridge/node/repo"
@@ -25,12 +27,40 @@ func LockedRepo(lr repo.LockedRepo) func(lc fx.Lifecycle) repo.LockedRepo {
 	}
 }
 
-func KeyStore(lr repo.LockedRepo) (types.KeyStore, error) {
-	return lr.KeyStore()
+type KeyStoreParams struct {
+	fx.In
+
+	Repo       repo.LockedRepo
+	Passphrase dtypes.KeyStorePassphrase `optional:"true"`
 }
 
-func Datastore(disableLog bool) func(lc fx.Lifecycle, mctx helpers.MetricsCtx, r repo.LockedRepo) (dtypes.MetadataDS, error) {
-	return func(lc fx.Lifecycle, mctx helpers.MetricsCtx, r repo.LockedRepo) (dtypes.MetadataDS, error) {
+// KeyStore returns the keystore of the repo, unlocking it first if it's
+// encrypted.
+func KeyStore(p KeyStoreParams) (types.KeyStore, error) {
+	locked, err := p.Repo.KeyStoreLocked()
+	if err != nil {
+		return nil, err
+	}
+	if locked {
+		if p.Passphrase == nil {
+			return nil, xerrors.Errorf("keystore is encrypted, but no passphrase to unlock it was given")
+		}
+
+		pass, err := p.Passphrase()
+		if err != nil {
+			return nil, xerrors.Errorf("getting keystore passphrase: %w", err)
+		}
+		if err := p.Repo.UnlockKeyStore(pass); err != nil {
+			return nil, err
+		}
+		log.Info("keystore unlocked")
+	}
+
+	return p.Repo.KeyStore()
+}
+
+func Datastore(cfg config.Backup) func(lc fx.Lifecycle, mctx helpers.MetricsCtx, r repo.LockedRepo, ks types.KeyStore) (dtypes.MetadataDS, error) {
+	return func(lc fx.Lifecycle, mctx helpers.MetricsCtx, r repo.LockedRepo, ks types.KeyStore) (dtypes.MetadataDS, error) {
 		ctx := helpers.LifecycleCtx(mctx, lc)
 		mds, err := r.Datastore(ctx, "/metadata")
 		if err != nil {
@@ -38,11 +68,23 @@ func Datastore(disableLog bool) func(lc fx.Lifecycle, mctx helpers.MetricsCtx, r
 		}
 
 		var logdir string
-		if !disableLog {
+		if !cfg.DisableMetadataLog {
 			logdir = filepath.Join(r.Path(), "kvlog/metadata")
 		}
 
-		bds, err := backupds.Wrap(mds, logdir)
+		key, keys, err := repo.BackupKeys(ks, cfg.Encryption)
+		if err != nil {
+			return nil, xerrors.Errorf("loading backup keys: %w", err)
+		}
+
+		bds, err := backupds.Wrap(mds, logdir,
+			backupds.WithEncryption(key),
+			backupds.WithKeyring(keys),
+			backupds.WithFlushInterval(time.Duration(cfg.MetadataLogFlushInterval)),
+			backupds.WithMaxLogSize(cfg.MetadataLogMaxSize),
+			backupds.WithMaxLogAge(time.Duration(cfg.MetadataLogMaxAge)),
+			backupds.WithKeepLogs(cfg.MetadataLogKeep),
+		)
 		if err != nil {
 			return nil, xerrors.Errorf("opening backupds: %w", err)
 		}
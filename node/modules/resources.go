@@ -0,0 +1,249 @@
+package modules
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/raulk/go-watchdog"
+	"go.uber.org/fx"
+	"golang.org/x/xerrors"
+
+	"github.com/lyswifter/dbridge/lib/alerting"
+	"github.com/lyswifter/dbridge/lib/ulimit"
+	"github.com/lyswifter/dbridge/node/config"
+	"github.com/lyswifter/dbridge/node/repo"
+)
+
+var logWatchdog = logging.Logger("watchdog")
+
+// CheckFdLimit raises the soft limit on open file descriptors to the
+// configured limit. It fails when the limit stays below the configured
+// minimum, and raises an alert when it stays below the configured limit.
+func CheckFdLimit(cfg config.Resources) func(al *alerting.Alerting) error {
+	return func(al *alerting.Alerting) error {
+		alert := al.AddAlertType("process", "fd-limit")
+
+		changed, _, err := ulimit.ManageFdLimit(cfg.FDLimit)
+		if err != nil {
+			log.Warnf("raising fd limit: %s", err)
+		}
+
+		soft, hard, err := ulimit.GetLimit()
+		if errors.Is(err, ulimit.ErrUnsupported) {
+			log.Warn("FD limit monitoring not available")
+			return nil
+		}
+		if err != nil {
+			al.Raise(alert, map[string]string{
+				"message": "failed to get FD limit",
+				"error":   err.Error(),
+			})
+			return nil
+		}
+
+		if changed {
+			log.Infow("raised fd limit", "soft", soft, "hard", hard)
+		}
+
+		if soft < cfg.MinFDLimit {
+			return xerrors.Errorf("soft limit on open file descriptors is %d, below the required minimum of %d (Resources.MinFDLimit); "+
+				"raise the hard limit (currently %d) with 'ulimit -Hn', LimitNOFILE in the systemd unit or /etc/security/limits.conf",
+				soft, cfg.MinFDLimit, hard)
+		}
+
+		if soft < cfg.FDLimit {
+			al.Raise(alert, map[string]interface{}{
+				"message":         "soft FD limit is low",
+				"soft_limit":      soft,
+				"hard_limit":      hard,
+				"recommended_min": cfg.FDLimit,
+			})
+		}
+
+		return nil
+	}
+}
+
+type MemoryWatchdogParams struct {
+	fx.In
+
+	Lc       fx.Lifecycle
+	Repo     repo.LockedRepo
+	Alerting *alerting.Alerting
+	Host     host.Host `optional:"true"`
+}
+
+// MemoryWatchdog starts a watchdog which forces GC as memory use approaches
+// the limit. Past the shed threshold the node trims its peer connections, and
+// raises an alert until memory use drops below the threshold again.
+func MemoryWatchdog(cfg config.Resources) func(MemoryWatchdogParams) error {
+	return func(p MemoryWatchdogParams) error {
+		if cfg.DisableMemoryWatchdog {
+			logWatchdog.Info("memory watchdog is disabled in the config")
+			return nil
+		}
+
+		var maxHeap uint64
+		if cfg.MaxHeap != "" {
+			var err error
+			maxHeap, err = humanize.ParseBytes(cfg.MaxHeap)
+			if err != nil {
+				return xerrors.Errorf("parsing Resources.MaxHeap: %w", err)
+			}
+		}
+
+		// configure heap profile capture so that one is captured per episode where
+		// utilization climbs over 90% of the limit. A maximum of 10 heapdumps
+		// will be captured during life of this process.
+		watchdog.HeapProfileDir = filepath.Join(p.Repo.Path(), "heapprof")
+		watchdog.HeapProfileMaxCaptures = 10
+		watchdog.HeapProfileThreshold = 0.9
+		watchdog.Logger = logWatchdog
+
+		shed := &loadShedder{
+			threshold: cfg.ShedThreshold,
+			host:      p.Host,
+			al:        p.Alerting,
+			alert:     p.Alerting.AddAlertType("process", "memory"),
+		}
+		policy := shed.policy(watchdog.NewWatermarkPolicy(0.50, 0.60, 0.70, 0.85, 0.90, 0.925, 0.95))
+
+		addStopHook := func(stopFn func()) {
+			p.Lc.Append(fx.Hook{
+				OnStop: func(ctx context.Context) error {
+					stopFn()
+					return nil
+				},
+			})
+		}
+
+		// Try to initialize a watchdog in the following order of precedence:
+		// 1. If a max heap limit has been provided, initialize a heap-driven watchdog.
+		// 2. Else, try to initialize a cgroup-driven watchdog.
+		// 3. Else, try to initialize a system-driven watchdog.
+		// 4. Else, log a warning that the system is flying solo, and return.
+
+		if maxHeap != 0 {
+			const minGOGC = 25
+			err, stopFn := watchdog.HeapDriven(maxHeap, minGOGC, policy)
+			if err == nil {
+				logWatchdog.Infof("initialized heap-driven watchdog; max heap: %d bytes", maxHeap)
+				addStopHook(stopFn)
+				return nil
+			}
+			logWatchdog.Warnf("failed to initialize heap-driven watchdog; err: %s", err)
+			logWatchdog.Warnf("trying a cgroup-driven watchdog")
+		}
+
+		err, stopFn := watchdog.CgroupDriven(5*time.Second, policy)
+		if err == nil {
+			logWatchdog.Infof("initialized cgroup-driven watchdog")
+			addStopHook(stopFn)
+			return nil
+		}
+		logWatchdog.Warnf("failed to initialize cgroup-driven watchdog; err: %s", err)
+		logWatchdog.Warnf("trying a system-driven watchdog")
+
+		err, stopFn = watchdog.SystemDriven(0, 5*time.Second, policy) // 0 calculates the limit automatically.
+		if err == nil {
+			logWatchdog.Infof("initialized system-driven watchdog")
+			addStopHook(stopFn)
+			return nil
+		}
+
+		logWatchdog.Warnf("failed to initialize system-driven watchdog; err: %s", err)
+		logWatchdog.Warnf("system running without a memory watchdog")
+		return nil
+	}
+}
+
+// shedInterval is the minimum time between connection trims.
+const shedInterval = time.Minute
+
+// loadShedder wraps a watchdog policy, and trims peer connections when the
+// memory use it's evaluated with is above the threshold.
+type loadShedder struct {
+	threshold float64
+	host      host.Host
+
+	al    *alerting.Alerting
+	alert alerting.AlertType
+
+	lastShed int64 // unix nanos, accessed atomically
+	raised   int32 // accessed atomically
+}
+
+type shedPolicy struct {
+	watchdog.Policy
+
+	s     *loadShedder
+	limit uint64
+}
+
+func (s *loadShedder) policy(ctor watchdog.PolicyCtor) watchdog.PolicyCtor {
+	return func(limit uint64) (watchdog.Policy, error) {
+		p, err := ctor(limit)
+		if err != nil {
+			return nil, err
+		}
+		return &shedPolicy{Policy: p, s: s, limit: limit}, nil
+	}
+}
+
+// Evaluate is called by the watchdog after every GC with the current memory
+// use.
+func (p *shedPolicy) Evaluate(scope watchdog.UtilizationType, used uint64) uint64 {
+	p.s.check(used, p.limit)
+	return p.Policy.Evaluate(scope, used)
+}
+
+func (s *loadShedder) check(used, limit uint64) {
+	if s.threshold <= 0 || limit == 0 {
+		return
+	}
+
+	utilization := float64(used) / float64(limit)
+	if utilization < s.threshold {
+		if atomic.CompareAndSwapInt32(&s.raised, 1, 0) {
+			s.al.Resolve(s.alert, map[string]interface{}{
+				"message": "memory use is back below the shed threshold",
+				"used":    used,
+				"limit":   limit,
+			})
+		}
+		return
+	}
+
+	if atomic.CompareAndSwapInt32(&s.raised, 0, 1) {
+		s.al.Raise(s.alert, map[string]interface{}{
+			"message":   "memory use is above the shed threshold",
+			"used":      used,
+			"limit":     limit,
+			"threshold": s.threshold,
+		})
+	}
+
+	if s.host == nil {
+		return
+	}
+
+	now := time.Now().UnixNano()
+	last := atomic.LoadInt64(&s.lastShed)
+	if now-last < int64(shedInterval) || !atomic.CompareAndSwapInt64(&s.lastShed, last, now) {
+		return
+	}
+
+	// the watchdog calls the policy from its own goroutine, don't block it
+	go func() {
+		before := len(s.host.Network().Conns())
+		s.host.ConnManager().TrimOpenConns(context.Background())
+		logWatchdog.Warnw("memory use above shed threshold, trimmed peer connections",
+			"used", used, "limit", limit, "connsBefore", before, "connsAfter", len(s.host.Network().Conns()))
+	}()
+}
@@ -0,0 +1,45 @@
+package modules
+
+import (
+	"context"
+
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/fx"
+	"go.uber.org/multierr"
+	"golang.org/x/xerrors"
+
+	dmetrics "github.com/lyswifter/dbridge/metrics"
+	"github.com/lyswifter/dbridge/node/modules/dtypes"
+)
+
+// NetMetrics registers the peer count, bandwidth and pubsub score collectors
+// with the metrics endpoint for the lifetime of the node.
+func NetMetrics(lc fx.Lifecycle, h host.Host, reporter metrics.Reporter, sk *dtypes.ScoreKeeper) {
+	collectors := []prometheus.Collector{
+		dmetrics.NewPeerCountCollector(h.Network().Peers),
+		dmetrics.NewBandwidthCollector(reporter),
+		dmetrics.NewScoreCollector(sk.Get),
+	}
+
+	lc.Append(fx.Hook{
+		OnStart: func(context.Context) error {
+			for _, c := range collectors {
+				if err := prometheus.Register(c); err != nil {
+					return xerrors.Errorf("registering net metrics: %w", err)
+				}
+			}
+			return nil
+		},
+		OnStop: func(context.Context) error {
+			var err error
+			for _, c := range collectors {
+				if !prometheus.Unregister(c) {
+					err = multierr.Append(err, xerrors.Errorf("net metrics collector %T was not registered", c))
+				}
+			}
+			return err
+		},
+	})
+}
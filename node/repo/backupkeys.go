@@ -0,0 +1,126 @@
+package repo
+
+import (
+	"crypto/rand"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"golang.org/x/xerrors"
+
+	"github.com/lyswifter/dbridge/lib/backupds"
+	"github.com/lyswifter/dbridge/node/config"
+	"github.com/lyswifter/dbridge/types"
+)
+
+const (
+	KTBackupKey types.KeyType = "backup-aes-gcm"
+
+	// BackupKeyName is the keystore key backups are encrypted with when
+	// Backup.Encryption is "keystore"
+	BackupKeyName = "backup-key"
+)
+
+// BackupKeys returns the key backups and the metadata log are encrypted with,
+// which is nil when encryption is disabled, and a keyring with the keys they
+// can be read with: every backup key in the keystore, and the passphrase from
+// the environment. The keystore key is created if it doesn't exist yet.
+func BackupKeys(ks types.KeyStore, encryption string) (*backupds.Key, *backupds.Keyring, error) {
+	current, err := BackupKey(ks, encryption)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	names, err := ks.List()
+	if err != nil {
+		return nil, nil, xerrors.Errorf("listing keys: %w", err)
+	}
+
+	var keys []types.KeyInfo
+	for _, name := range names {
+		ki, err := ks.Get(name)
+		if err != nil {
+			return nil, nil, xerrors.Errorf("getting key %s: %w", name, err)
+		}
+		keys = append(keys, ki)
+	}
+
+	kr, err := BackupKeyring(keys)
+	if err != nil {
+		return nil, nil, err
+	}
+	if current != nil {
+		kr.Add(current)
+	}
+
+	return current, kr, nil
+}
+
+// BackupKey returns the key backups are encrypted with, nil when encryption is
+// disabled. The keystore is only used with "keystore" encryption, and the key
+// is created if it doesn't exist yet.
+func BackupKey(ks types.KeyStore, encryption string) (*backupds.Key, error) {
+	switch encryption {
+	case config.BackupEncryptionNone:
+		return nil, nil
+	case config.BackupEncryptionKeystore:
+		if _, err := ks.Get(BackupKeyName); errors.Is(err, types.ErrKeyInfoNotFound) {
+			log.Warn("Generating new backup encryption key")
+
+			sk, err := ioutil.ReadAll(io.LimitReader(rand.Reader, 32))
+			if err != nil {
+				return nil, err
+			}
+			if err := ks.Put(BackupKeyName, types.KeyInfo{
+				Type:       KTBackupKey,
+				PrivateKey: sk,
+			}); err != nil {
+				return nil, xerrors.Errorf("writing backup key: %w", err)
+			}
+		} else if err != nil {
+			return nil, xerrors.Errorf("getting backup key: %w", err)
+		}
+
+		ki, err := ks.Get(BackupKeyName)
+		if err != nil {
+			return nil, xerrors.Errorf("getting backup key: %w", err)
+		}
+		k, err := backupds.NewKey(ki.PrivateKey)
+		if err != nil {
+			return nil, xerrors.Errorf("backup key: %w", err)
+		}
+		return k, nil
+	case config.BackupEncryptionPassphrase:
+		pass := os.Getenv(backupds.PassphraseEnv)
+		if pass == "" {
+			return nil, xerrors.Errorf("backup encryption with a passphrase needs %s to be set", backupds.PassphraseEnv)
+		}
+		return backupds.NewPassphraseKey([]byte(pass))
+	default:
+		return nil, xerrors.Errorf("unknown backup encryption %q", encryption)
+	}
+}
+
+// BackupKeyring returns a keyring with the backup keys among keys, and the
+// passphrase from the environment, if it's set.
+func BackupKeyring(keys []types.KeyInfo) (*backupds.Keyring, error) {
+	kr := backupds.NewKeyring()
+	for _, ki := range keys {
+		if ki.Type != KTBackupKey {
+			continue
+		}
+
+		k, err := backupds.NewKey(ki.PrivateKey)
+		if err != nil {
+			return nil, xerrors.Errorf("backup key: %w", err)
+		}
+		kr.Add(k)
+	}
+
+	if pass := os.Getenv(backupds.PassphraseEnv); pass != "" {
+		kr.AddPassphrase([]byte(pass))
+	}
+
+	return kr, nil
+}
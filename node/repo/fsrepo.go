@@ -2,7 +2,7 @@ package repo
 
 import (
 	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -89,6 +89,11 @@ func (fsr *FsRepo) SetConfigPath(cfgPath string) {
 	fsr.configPath = cfgPath
 }
 
+// ConfigPath returns the path of the config file.
+func (fsr *FsRepo) ConfigPath() string {
+	return fsr.configPath
+}
+
 func (fsr *FsRepo) Exists() (bool, error) {
 	_, err := os.Stat(filepath.Join(fsr.path, fsDatastore))
 	notexist := os.IsNotExist(err)
@@ -123,6 +128,10 @@ func (fsr *FsRepo) Init(t RepoType) error {
 		return xerrors.Errorf("init config: %w", err)
 	}
 
+	if err := writeVersion(fsr.path, RepoVersion); err != nil {
+		return xerrors.Errorf("init version: %w", err)
+	}
+
 	return fsr.initKeystore()
 
 }
@@ -211,8 +220,21 @@ func (fsr *FsRepo) APIToken() ([]byte, error) {
 	return bytes.TrimSpace(tb), nil
 }
 
-// Lock acquires exclusive lock on this repo
+// Lock acquires exclusive lock on this repo, and applies pending migrations
 func (fsr *FsRepo) Lock(repoType RepoType) (LockedRepo, error) {
+	lr, err := fsr.lock(repoType)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := lr.migrate(context.TODO(), MigrateOptions{}); err != nil {
+		_ = lr.Close()
+		return nil, err
+	}
+	return lr, nil
+}
+
+func (fsr *FsRepo) lock(repoType RepoType) (*fsLockedRepo, error) {
 	locked, err := fslock.Locked(fsr.path, fsLock)
 	if err != nil {
 		return nil, xerrors.Errorf("could not check lock status: %w", err)
@@ -225,22 +247,38 @@ func (fsr *FsRepo) Lock(repoType RepoType) (LockedRepo, error) {
 	if err != nil {
 		return nil, xerrors.Errorf("could not lock the repo: %w", err)
 	}
-	return &fsLockedRepo{
+	lr := &fsLockedRepo{
 		path:       fsr.path,
 		configPath: fsr.configPath,
 		repoType:   repoType,
 		closer:     closer,
-	}, nil
+	}
+
+	if err := lr.recoverKeyStore(); err != nil {
+		_ = closer.Close()
+		return nil, xerrors.Errorf("recovering keystore: %w", err)
+	}
+	return lr, nil
 }
 
-// Like Lock, except datastores will work in read-only mode
+// Like Lock, except datastores will work in read-only mode, and repos which
+// need migrating aren't migrated
 func (fsr *FsRepo) LockRO(repoType RepoType) (LockedRepo, error) {
-	lr, err := fsr.Lock(repoType)
+	lr, err := fsr.lock(repoType)
 	if err != nil {
 		return nil, err
 	}
 
-	lr.(*fsLockedRepo).readonly = true
+	pending, err := fsr.PendingMigrations()
+	if err == nil && len(pending) > 0 {
+		err = xerrors.Errorf("repo needs %d migrations, run 'dbridge repo migrate'", len(pending))
+	}
+	if err != nil {
+		_ = lr.Close()
+		return nil, err
+	}
+
+	lr.readonly = true
 	return lr, nil
 }
 
@@ -264,6 +302,11 @@ type fsLockedRepo struct {
 
 	storageLk sync.Mutex
 	configLk  sync.Mutex
+
+	// keys decrypts and encrypts the keys of an encrypted keystore, once it's
+	// unlocked
+	keysLk sync.Mutex
+	keys   *keyCrypt
 }
 
 func (fsr *fsLockedRepo) Readonly() bool {
@@ -372,12 +415,26 @@ func (fsr *fsLockedRepo) SetAPIToken(token []byte) error {
 }
 
 func (fsr *fsLockedRepo) KeyStore() (types.KeyStore, error) {
-	if err := fsr.stillValid(); err != nil {
+	locked, err := fsr.KeyStoreLocked()
+	if err != nil {
 		return nil, err
 	}
+	if locked {
+		return nil, ErrKeyStoreLocked
+	}
 	return fsr, nil
 }
 
+func keyFileName(name string) string {
+	return base32.RawStdEncoding.EncodeToString([]byte(name))
+}
+
+func (fsr *fsLockedRepo) keyCrypt() *keyCrypt {
+	fsr.keysLk.Lock()
+	defer fsr.keysLk.Unlock()
+	return fsr.keys
+}
+
 var kstrPermissionMsg = "permissions of key: '%s' are too relaxed, " +
 	"required: 0600, got: %#o"
 
@@ -399,6 +456,9 @@ func (fsr *fsLockedRepo) List() ([]string, error) {
 	}
 	keys := make([]string, 0, len(files))
 	for _, f := range files {
+		if f.Name() == KeyStoreEncryptionFile {
+			continue
+		}
 		if f.Mode()&0077 != 0 {
 			return nil, xerrors.Errorf(kstrPermissionMsg, f.Name(), f.Mode())
 		}
@@ -417,8 +477,7 @@ func (fsr *fsLockedRepo) Get(name string) (types.KeyInfo, error) {
 		return types.KeyInfo{}, err
 	}
 
-	encName := base32.RawStdEncoding.EncodeToString([]byte(name))
-	keyPath := fsr.join(fsKeystore, encName)
+	keyPath := fsr.join(fsKeystore, keyFileName(name))
 
 	fstat, err := os.Stat(keyPath)
 	if os.IsNotExist(err) {
@@ -442,13 +501,7 @@ func (fsr *fsLockedRepo) Get(name string) (types.KeyInfo, error) {
 		return types.KeyInfo{}, xerrors.Errorf("reading key '%s': %w", name, err)
 	}
 
-	var res types.KeyInfo
-	err = json.Unmarshal(data, &res)
-	if err != nil {
-		return types.KeyInfo{}, xerrors.Errorf("decoding key '%s': %w", name, err)
-	}
-
-	return res, nil
+	return decodeKey(fsr.keyCrypt(), name, data)
 }
 
 const KTrashPrefix = "trash-"
@@ -468,8 +521,7 @@ func (fsr *fsLockedRepo) put(rawName string, info types.KeyInfo, retries int) er
 		name = fmt.Sprintf("%s-%d", rawName, retries)
 	}
 
-	encName := base32.RawStdEncoding.EncodeToString([]byte(name))
-	keyPath := fsr.join(fsKeystore, encName)
+	keyPath := fsr.join(fsKeystore, keyFileName(name))
 
 	_, err := os.Stat(keyPath)
 	if err == nil && strings.HasPrefix(name, KTrashPrefix) {
@@ -481,9 +533,9 @@ func (fsr *fsLockedRepo) put(rawName string, info types.KeyInfo, retries int) er
 		return xerrors.Errorf("checking key before put '%s': %w", name, err)
 	}
 
-	keyData, err := json.Marshal(info)
+	keyData, err := encodeKey(fsr.keyCrypt(), name, info)
 	if err != nil {
-		return xerrors.Errorf("encoding key '%s': %w", name, err)
+		return err
 	}
 
 	err = ioutil.WriteFile(keyPath, keyData, 0600)
@@ -498,8 +550,7 @@ func (fsr *fsLockedRepo) Delete(name string) error {
 		return err
 	}
 
-	encName := base32.RawStdEncoding.EncodeToString([]byte(name))
-	keyPath := fsr.join(fsKeystore, encName)
+	keyPath := fsr.join(fsKeystore, keyFileName(name))
 
 	_, err := os.Stat(keyPath)
 	if os.IsNotExist(err) {
@@ -78,6 +78,17 @@ type LockedRepo interface {
 	// KeyStore returns store of private keys for Filecoin transactions
 	KeyStore() (types.KeyStore, error)
 
+	// KeyStoreLocked returns true if the keystore is encrypted and wasn't
+	// unlocked yet, in which case KeyStore returns ErrKeyStoreLocked
+	KeyStoreLocked() (bool, error)
+
+	// UnlockKeyStore unlocks an encrypted keystore with its passphrase
+	UnlockKeyStore(passphrase []byte) error
+
+	// SetKeyStorePassphrase encrypts the keystore with a new passphrase, or
+	// decrypts it if the passphrase is nil
+	SetKeyStorePassphrase(passphrase []byte) error
+
 	// Path returns absolute path of the repo
 	Path() string
 
@@ -0,0 +1,75 @@
+package repo
+
+import (
+	"encoding/json"
+
+	"golang.org/x/xerrors"
+
+	"github.com/lyswifter/dbridge/types"
+)
+
+// exportedKey is the format keys are exported in, encrypted with a key derived
+// from a passphrase like an encrypted keystore.
+type exportedKey struct {
+	Version int
+	Name    string
+	Params  keystoreParams
+	Key     sealed
+}
+
+// ExportKey encodes a key, encrypted with passphrase, so that it can be
+// imported with ImportKey.
+func ExportKey(name string, ki types.KeyInfo, passphrase []byte) ([]byte, error) {
+	if len(passphrase) == 0 {
+		return nil, xerrors.New("the export passphrase is empty")
+	}
+
+	p, kc, err := newKeystoreParams(passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(ki)
+	if err != nil {
+		return nil, xerrors.Errorf("encoding key '%s': %w", name, err)
+	}
+	key, err := kc.seal(name, data)
+	if err != nil {
+		return nil, xerrors.Errorf("encrypting key '%s': %w", name, err)
+	}
+
+	return json.MarshalIndent(exportedKey{
+		Version: 1,
+		Name:    name,
+		Params:  *p,
+		Key:     key,
+	}, "", "  ")
+}
+
+// ImportKey decodes a key exported with ExportKey, returning the name it was
+// exported under.
+func ImportKey(data, passphrase []byte) (string, types.KeyInfo, error) {
+	var ek exportedKey
+	if err := json.Unmarshal(data, &ek); err != nil {
+		return "", types.KeyInfo{}, xerrors.Errorf("decoding exported key: %w", err)
+	}
+	if ek.Version != 1 {
+		return "", types.KeyInfo{}, xerrors.Errorf("unsupported exported key version %d", ek.Version)
+	}
+
+	kc, err := deriveKeyCrypt(passphrase, &ek.Params)
+	if err != nil {
+		return "", types.KeyInfo{}, err
+	}
+
+	plain, err := kc.open(ek.Name, ek.Key)
+	if err != nil {
+		return "", types.KeyInfo{}, xerrors.Errorf("decrypting exported key: %w", ErrBadPassphrase)
+	}
+
+	var ki types.KeyInfo
+	if err := json.Unmarshal(plain, &ki); err != nil {
+		return "", types.KeyInfo{}, xerrors.Errorf("decoding key '%s': %w", ek.Name, err)
+	}
+	return ek.Name, ki, nil
+}
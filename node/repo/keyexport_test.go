@@ -0,0 +1,94 @@
+package repo
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lyswifter/dbridge/types"
+)
+
+func TestKeyExport(t *testing.T) {
+	ki := types.KeyInfo{Type: "libp2p-host", PrivateKey: []byte("host key")}
+
+	exported, err := ExportKey("libp2p-host", ki, []byte("passphrase"))
+	require.NoError(t, err)
+	require.NotContains(t, string(exported), string(ki.PrivateKey))
+
+	tamper := func(f func(ek *exportedKey)) []byte {
+		var ek exportedKey
+		require.NoError(t, json.Unmarshal(exported, &ek))
+		f(&ek)
+		data, err := json.Marshal(ek)
+		require.NoError(t, err)
+		return data
+	}
+
+	tests := []struct {
+		name       string
+		data       []byte
+		passphrase string
+
+		fails bool
+		// err is the error the import fails with, if it's a known one
+		err error
+	}{
+		{
+			name:       "round trip",
+			data:       exported,
+			passphrase: "passphrase",
+		},
+		{
+			name:       "wrong passphrase",
+			data:       exported,
+			passphrase: "wrong",
+			fails:      true,
+			err:        ErrBadPassphrase,
+		},
+		{
+			// the name is authenticated, a key can't be passed off as another
+			name: "renamed",
+			data: tamper(func(ek *exportedKey) {
+				ek.Name = "auth-jwt"
+			}),
+			passphrase: "passphrase",
+			fails:      true,
+			err:        ErrBadPassphrase,
+		},
+		{
+			name: "unknown version",
+			data: tamper(func(ek *exportedKey) {
+				ek.Version = 2
+			}),
+			passphrase: "passphrase",
+			fails:      true,
+		},
+		{
+			name:       "not an exported key",
+			data:       []byte("libp2p-host"),
+			passphrase: "passphrase",
+			fails:      true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			name, got, err := ImportKey(tc.data, []byte(tc.passphrase))
+			if tc.fails {
+				require.Error(t, err)
+				if tc.err != nil {
+					require.ErrorIs(t, err, tc.err)
+				}
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, "libp2p-host", name)
+			require.Equal(t, ki, got)
+		})
+	}
+
+	_, err = ExportKey("libp2p-host", ki, nil)
+	require.Error(t, err)
+}
@@ -0,0 +1,406 @@
+package repo
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/multiformats/go-base32"
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/xerrors"
+
+	"github.com/lyswifter/dbridge/types"
+)
+
+// KeyStoreEncryptionFile is kept in the keystore directory of an encrypted
+// keystore, holding the parameters its key is derived from the passphrase
+// with.
+const KeyStoreEncryptionFile = ".encryption"
+
+const (
+	fsKeystoreNew = fsKeystore + ".new"
+	fsKeystoreOld = fsKeystore + ".old"
+
+	keystoreCheck = "dbridge keystore"
+)
+
+var (
+	ErrKeyStoreLocked = xerrors.New("keystore is encrypted and locked")
+	ErrBadPassphrase  = xerrors.New("wrong passphrase")
+)
+
+// keystoreParams is the content of KeyStoreEncryptionFile.
+type keystoreParams struct {
+	Version int
+	KDF     string
+	N, R, P int
+	Salt    []byte
+	// Check is a known value sealed with the key, to tell a wrong passphrase
+	// from a corrupted key
+	Check sealed
+}
+
+// sealed is an AES-GCM sealed value, which is what the key files of an
+// encrypted keystore hold.
+type sealed struct {
+	Nonce []byte
+	Data  []byte
+}
+
+type keyCrypt struct {
+	aead cipher.AEAD
+}
+
+func (kc *keyCrypt) seal(name string, plain []byte) (sealed, error) {
+	nonce := make([]byte, kc.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return sealed{}, err
+	}
+
+	// the key name is authenticated, so that key files can't be swapped
+	return sealed{
+		Nonce: nonce,
+		Data:  kc.aead.Seal(nil, nonce, plain, []byte(name)),
+	}, nil
+}
+
+func (kc *keyCrypt) open(name string, s sealed) ([]byte, error) {
+	if len(s.Nonce) != kc.aead.NonceSize() {
+		return nil, xerrors.Errorf("bad nonce length %d", len(s.Nonce))
+	}
+	return kc.aead.Open(nil, s.Nonce, s.Data, []byte(name))
+}
+
+func deriveKeyCrypt(passphrase []byte, p *keystoreParams) (*keyCrypt, error) {
+	if p.KDF != "scrypt" {
+		return nil, xerrors.Errorf("unknown keystore key derivation %q", p.KDF)
+	}
+
+	sk, err := scrypt.Key(passphrase, p.Salt, p.N, p.R, p.P, 32)
+	if err != nil {
+		return nil, xerrors.Errorf("deriving keystore key: %w", err)
+	}
+
+	block, err := aes.NewCipher(sk)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &keyCrypt{aead: aead}, nil
+}
+
+// newKeystoreParams derives a key from passphrase with a new random salt.
+func newKeystoreParams(passphrase []byte) (*keystoreParams, *keyCrypt, error) {
+	p := &keystoreParams{
+		Version: 1,
+		KDF:     "scrypt",
+		N:       1 << 15,
+		R:       8,
+		P:       1,
+		Salt:    make([]byte, 16),
+	}
+	if _, err := io.ReadFull(rand.Reader, p.Salt); err != nil {
+		return nil, nil, err
+	}
+
+	kc, err := deriveKeyCrypt(passphrase, p)
+	if err != nil {
+		return nil, nil, err
+	}
+	return p, kc, nil
+}
+
+func (fsr *fsLockedRepo) keystoreParams() (*keystoreParams, error) {
+	data, err := ioutil.ReadFile(fsr.join(fsKeystore, KeyStoreEncryptionFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, xerrors.Errorf("reading keystore encryption: %w", err)
+	}
+	return parseKeystoreParams(data)
+}
+
+func parseKeystoreParams(data []byte) (*keystoreParams, error) {
+	var p keystoreParams
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, xerrors.Errorf("decoding keystore encryption: %w", err)
+	}
+	if p.Version != 1 {
+		return nil, xerrors.Errorf("unsupported keystore encryption version %d", p.Version)
+	}
+	return &p, nil
+}
+
+// KeyStoreLocked returns true if the keystore is encrypted and wasn't
+// unlocked yet.
+func (fsr *fsLockedRepo) KeyStoreLocked() (bool, error) {
+	if err := fsr.stillValid(); err != nil {
+		return false, err
+	}
+
+	fsr.keysLk.Lock()
+	defer fsr.keysLk.Unlock()
+
+	if fsr.keys != nil {
+		return false, nil
+	}
+	p, err := fsr.keystoreParams()
+	return p != nil, err
+}
+
+// UnlockKeyStore unlocks an encrypted keystore with its passphrase. Unlocking
+// a keystore which isn't encrypted does nothing.
+func (fsr *fsLockedRepo) UnlockKeyStore(passphrase []byte) error {
+	if err := fsr.stillValid(); err != nil {
+		return err
+	}
+
+	fsr.keysLk.Lock()
+	defer fsr.keysLk.Unlock()
+
+	p, err := fsr.keystoreParams()
+	if err != nil || p == nil {
+		return err
+	}
+
+	kc, err := unlockKeyCrypt(passphrase, p)
+	if err != nil {
+		return err
+	}
+
+	fsr.keys = kc
+	return nil
+}
+
+// unlockKeyCrypt derives the key of an encrypted keystore, checking that the
+// passphrase is the right one.
+func unlockKeyCrypt(passphrase []byte, p *keystoreParams) (*keyCrypt, error) {
+	kc, err := deriveKeyCrypt(passphrase, p)
+	if err != nil {
+		return nil, err
+	}
+	if check, err := kc.open(KeyStoreEncryptionFile, p.Check); err != nil || string(check) != keystoreCheck {
+		return nil, ErrBadPassphrase
+	}
+	return kc, nil
+}
+
+// DecodeKeyStoreFiles decodes the files of a keystore directory, by file name,
+// as e.g. read from an archive of a repo. The keys of an encrypted keystore
+// are decrypted with the passphrase pass returns, which is only called for
+// encrypted keystores.
+func DecodeKeyStoreFiles(files map[string][]byte, pass func() ([]byte, error)) (map[string]types.KeyInfo, error) {
+	var kc *keyCrypt
+	if data, ok := files[KeyStoreEncryptionFile]; ok {
+		p, err := parseKeystoreParams(data)
+		if err != nil {
+			return nil, err
+		}
+		passphrase, err := pass()
+		if err != nil {
+			return nil, err
+		}
+		if kc, err = unlockKeyCrypt(passphrase, p); err != nil {
+			return nil, err
+		}
+	}
+
+	out := map[string]types.KeyInfo{}
+	for file, data := range files {
+		if file == KeyStoreEncryptionFile {
+			continue
+		}
+
+		name, err := base32.RawStdEncoding.DecodeString(file)
+		if err != nil {
+			return nil, xerrors.Errorf("decoding key file name %s: %w", file, err)
+		}
+		if out[string(name)], err = decodeKey(kc, string(name), data); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// SetKeyStorePassphrase encrypts the keystore with a key derived from
+// passphrase, or decrypts it when passphrase is nil. An encrypted keystore
+// must be unlocked first. All keys are written into a new keystore directory,
+// which then replaces the current one, so that an interrupted change leaves
+// either keystore behind, never a mix.
+func (fsr *fsLockedRepo) SetKeyStorePassphrase(passphrase []byte) error {
+	if err := fsr.stillValid(); err != nil {
+		return err
+	}
+	if fsr.readonly {
+		return xerrors.New("repo is read-only")
+	}
+	if locked, err := fsr.KeyStoreLocked(); err != nil {
+		return err
+	} else if locked {
+		return ErrKeyStoreLocked
+	}
+
+	names, err := fsr.List()
+	if err != nil {
+		return err
+	}
+	keys := make(map[string]types.KeyInfo, len(names))
+	for _, name := range names {
+		if keys[name], err = fsr.Get(name); err != nil {
+			return err
+		}
+	}
+
+	var kc *keyCrypt
+	var params []byte
+	if passphrase != nil {
+		var p *keystoreParams
+		if p, kc, err = newKeystoreParams(passphrase); err != nil {
+			return err
+		}
+		if p.Check, err = kc.seal(KeyStoreEncryptionFile, []byte(keystoreCheck)); err != nil {
+			return err
+		}
+		if params, err = json.Marshal(p); err != nil {
+			return err
+		}
+	}
+
+	fsr.keysLk.Lock()
+	defer fsr.keysLk.Unlock()
+
+	newDir := fsr.join(fsKeystoreNew)
+	if err := os.RemoveAll(newDir); err != nil {
+		return err
+	}
+	if err := os.Mkdir(newDir, 0700); err != nil {
+		return xerrors.Errorf("creating new keystore: %w", err)
+	}
+
+	for name, ki := range keys {
+		data, err := encodeKey(kc, name, ki)
+		if err != nil {
+			return err
+		}
+		if err := writeFileSync(filepath.Join(newDir, keyFileName(name)), data); err != nil {
+			return xerrors.Errorf("writing key '%s': %w", name, err)
+		}
+	}
+	if params != nil {
+		if err := writeFileSync(filepath.Join(newDir, KeyStoreEncryptionFile), params); err != nil {
+			return xerrors.Errorf("writing keystore encryption: %w", err)
+		}
+	}
+
+	if err := os.Rename(fsr.join(fsKeystore), fsr.join(fsKeystoreOld)); err != nil {
+		return xerrors.Errorf("moving old keystore: %w", err)
+	}
+	if err := os.Rename(newDir, fsr.join(fsKeystore)); err != nil {
+		return xerrors.Errorf("moving new keystore: %w", err)
+	}
+	if err := os.RemoveAll(fsr.join(fsKeystoreOld)); err != nil {
+		return xerrors.Errorf("removing old keystore: %w", err)
+	}
+
+	fsr.keys = kc
+	return nil
+}
+
+// recoverKeyStore finishes or rolls back a keystore passphrase change which
+// was interrupted.
+func (fsr *fsLockedRepo) recoverKeyStore() error {
+	exists := func(p string) (bool, error) {
+		_, err := os.Stat(fsr.join(p))
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+
+	cur, err := exists(fsKeystore)
+	if err != nil {
+		return err
+	}
+	next, err := exists(fsKeystoreNew)
+	if err != nil {
+		return err
+	}
+
+	if !cur && next {
+		// the new keystore was complete, the old one already moved away
+		log.Warn("finishing interrupted keystore passphrase change")
+		if err := os.Rename(fsr.join(fsKeystoreNew), fsr.join(fsKeystore)); err != nil {
+			return err
+		}
+	} else if next {
+		log.Warn("rolling back interrupted keystore passphrase change")
+		if err := os.RemoveAll(fsr.join(fsKeystoreNew)); err != nil {
+			return err
+		}
+	}
+
+	return os.RemoveAll(fsr.join(fsKeystoreOld))
+}
+
+func encodeKey(kc *keyCrypt, name string, ki types.KeyInfo) ([]byte, error) {
+	data, err := json.Marshal(ki)
+	if err != nil {
+		return nil, xerrors.Errorf("encoding key '%s': %w", name, err)
+	}
+	if kc == nil {
+		return data, nil
+	}
+
+	s, err := kc.seal(name, data)
+	if err != nil {
+		return nil, xerrors.Errorf("encrypting key '%s': %w", name, err)
+	}
+	return json.Marshal(s)
+}
+
+func decodeKey(kc *keyCrypt, name string, data []byte) (types.KeyInfo, error) {
+	var res types.KeyInfo
+	var s sealed
+	isSealed := json.Unmarshal(data, &s) == nil && s.Nonce != nil
+	switch {
+	case kc != nil && !isSealed:
+		return types.KeyInfo{}, xerrors.Errorf("key '%s' isn't encrypted", name)
+	case kc == nil && isSealed:
+		return types.KeyInfo{}, xerrors.Errorf("reading key '%s': %w", name, ErrKeyStoreLocked)
+	case kc != nil:
+		var err error
+		if data, err = kc.open(name, s); err != nil {
+			return types.KeyInfo{}, xerrors.Errorf("decrypting key '%s': %w", name, err)
+		}
+	}
+
+	if err := json.Unmarshal(data, &res); err != nil {
+		return types.KeyInfo{}, xerrors.Errorf("decoding key '%s': %w", name, err)
+	}
+	return res, nil
+}
+
+func writeFileSync(p string, data []byte) error {
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,248 @@
+package repo
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lyswifter/dbridge/types"
+)
+
+var testKeys = map[string]types.KeyInfo{
+	"libp2p-host": {Type: "libp2p-host", PrivateKey: []byte("host key")},
+	"auth-jwt":    {Type: "jwt-hmac-secret", PrivateKey: []byte("jwt secret")},
+}
+
+func newTestRepo(t *testing.T) *FsRepo {
+	r, err := NewFS(t.TempDir())
+	require.NoError(t, err)
+	require.NoError(t, r.Init(Dbridge))
+
+	lr, err := r.Lock(Dbridge)
+	require.NoError(t, err)
+	ks, err := lr.KeyStore()
+	require.NoError(t, err)
+	for name, ki := range testKeys {
+		require.NoError(t, ks.Put(name, ki))
+	}
+	require.NoError(t, lr.Close())
+
+	return r
+}
+
+// checkKeys locks the repo, unlocks the keystore with pass when it's not nil,
+// and checks that it holds the test keys.
+func checkKeys(t *testing.T, r *FsRepo, encrypted bool, pass []byte) {
+	lr, err := r.Lock(Dbridge)
+	require.NoError(t, err)
+	defer lr.Close() //nolint:errcheck
+
+	locked, err := lr.KeyStoreLocked()
+	require.NoError(t, err)
+	require.Equal(t, encrypted, locked)
+
+	if encrypted {
+		_, err := lr.KeyStore()
+		require.ErrorIs(t, err, ErrKeyStoreLocked)
+		require.NoError(t, lr.UnlockKeyStore(pass))
+	}
+
+	ks, err := lr.KeyStore()
+	require.NoError(t, err)
+
+	names, err := ks.List()
+	require.NoError(t, err)
+	require.Len(t, names, len(testKeys))
+
+	for name, expect := range testKeys {
+		ki, err := ks.Get(name)
+		require.NoError(t, err)
+		require.Equal(t, expect, ki)
+	}
+}
+
+func setPassphrase(t *testing.T, r *FsRepo, unlock, pass []byte) {
+	lr, err := r.Lock(Dbridge)
+	require.NoError(t, err)
+	defer lr.Close() //nolint:errcheck
+
+	if unlock != nil {
+		require.NoError(t, lr.UnlockKeyStore(unlock))
+	}
+	require.NoError(t, lr.SetKeyStorePassphrase(pass))
+}
+
+func TestKeyStorePassphrase(t *testing.T) {
+	first, second := []byte("first passphrase"), []byte("second passphrase")
+
+	tests := []struct {
+		name string
+		// passphrases the keystore is set to in turn, nil decrypts it
+		steps [][]byte
+	}{
+		{name: "encrypt", steps: [][]byte{first}},
+		{name: "change passphrase", steps: [][]byte{first, second}},
+		{name: "decrypt", steps: [][]byte{first, nil}},
+		{name: "encrypt again", steps: [][]byte{first, nil, second}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := newTestRepo(t)
+
+			var cur []byte
+			for _, pass := range tc.steps {
+				setPassphrase(t, r, cur, pass)
+				cur = pass
+				checkKeys(t, r, cur != nil, cur)
+			}
+
+			// key files are never left in plaintext in an encrypted keystore
+			if cur != nil {
+				for name, ki := range testKeys {
+					data, err := ioutil.ReadFile(filepath.Join(r.path, fsKeystore, keyFileName(name)))
+					require.NoError(t, err)
+					require.NotContains(t, string(data), string(ki.PrivateKey))
+				}
+			}
+		})
+	}
+}
+
+func TestKeyStoreWrongPassphrase(t *testing.T) {
+	r := newTestRepo(t)
+	setPassphrase(t, r, nil, []byte("passphrase"))
+
+	lr, err := r.Lock(Dbridge)
+	require.NoError(t, err)
+	defer lr.Close() //nolint:errcheck
+
+	for _, pass := range [][]byte{[]byte("wrong"), {}, nil} {
+		require.ErrorIs(t, lr.UnlockKeyStore(pass), ErrBadPassphrase)
+	}
+
+	locked, err := lr.KeyStoreLocked()
+	require.NoError(t, err)
+	require.True(t, locked)
+	require.ErrorIs(t, lr.SetKeyStorePassphrase(nil), ErrKeyStoreLocked)
+
+	require.NoError(t, lr.UnlockKeyStore([]byte("passphrase")))
+	locked, err = lr.KeyStoreLocked()
+	require.NoError(t, err)
+	require.False(t, locked)
+}
+
+func TestKeyStoreRecovery(t *testing.T) {
+	pass := []byte("passphrase")
+
+	tests := []struct {
+		name string
+		// interrupt leaves the keystores behind like a passphrase change
+		// interrupted at some step, given the path of a plaintext keystore and
+		// of the same keystore encrypted with pass
+		interrupt func(t *testing.T, repoPath, plain, enc string)
+
+		encrypted bool
+	}{
+		{
+			name: "new keystore partially written",
+			interrupt: func(t *testing.T, repoPath, plain, enc string) {
+				require.NoError(t, os.Rename(plain, filepath.Join(repoPath, fsKeystore)))
+				require.NoError(t, os.Mkdir(filepath.Join(repoPath, fsKeystoreNew), 0700))
+				require.NoError(t, ioutil.WriteFile(filepath.Join(repoPath, fsKeystoreNew, "partial"), []byte("{"), 0600))
+			},
+			encrypted: false,
+		},
+		{
+			name: "old keystore moved away",
+			interrupt: func(t *testing.T, repoPath, plain, enc string) {
+				require.NoError(t, os.Rename(plain, filepath.Join(repoPath, fsKeystoreOld)))
+				require.NoError(t, os.Rename(enc, filepath.Join(repoPath, fsKeystoreNew)))
+			},
+			encrypted: true,
+		},
+		{
+			name: "old keystore not removed",
+			interrupt: func(t *testing.T, repoPath, plain, enc string) {
+				require.NoError(t, os.Rename(plain, filepath.Join(repoPath, fsKeystoreOld)))
+				require.NoError(t, os.Rename(enc, filepath.Join(repoPath, fsKeystore)))
+			},
+			encrypted: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := newTestRepo(t)
+			ksPath := filepath.Join(r.path, fsKeystore)
+
+			plain := filepath.Join(t.TempDir(), "plain")
+			copyDir(t, ksPath, plain)
+			setPassphrase(t, r, nil, pass)
+			enc := filepath.Join(t.TempDir(), "enc")
+			copyDir(t, ksPath, enc)
+			require.NoError(t, os.RemoveAll(ksPath))
+
+			tc.interrupt(t, r.path, plain, enc)
+
+			checkKeys(t, r, tc.encrypted, pass)
+
+			for _, p := range []string{fsKeystoreNew, fsKeystoreOld} {
+				_, err := os.Stat(filepath.Join(r.path, p))
+				require.True(t, os.IsNotExist(err), "%s left behind", p)
+			}
+		})
+	}
+}
+
+func copyDir(t *testing.T, from, to string) {
+	require.NoError(t, os.Mkdir(to, 0700))
+
+	ents, err := ioutil.ReadDir(from)
+	require.NoError(t, err)
+	for _, ent := range ents {
+		data, err := ioutil.ReadFile(filepath.Join(from, ent.Name()))
+		require.NoError(t, err)
+		require.NoError(t, ioutil.WriteFile(filepath.Join(to, ent.Name()), data, 0600))
+	}
+}
+
+func TestDecodeKeyStoreFiles(t *testing.T) {
+	pass := []byte("passphrase")
+
+	readFiles := func(t *testing.T, r *FsRepo) map[string][]byte {
+		files := map[string][]byte{}
+		ents, err := ioutil.ReadDir(filepath.Join(r.path, fsKeystore))
+		require.NoError(t, err)
+		for _, ent := range ents {
+			data, err := ioutil.ReadFile(filepath.Join(r.path, fsKeystore, ent.Name()))
+			require.NoError(t, err)
+			files[ent.Name()] = data
+		}
+		return files
+	}
+
+	r := newTestRepo(t)
+	keys, err := DecodeKeyStoreFiles(readFiles(t, r), func() ([]byte, error) {
+		t.Fatal("passphrase asked for a plaintext keystore")
+		return nil, nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, testKeys, keys)
+
+	setPassphrase(t, r, nil, pass)
+	files := readFiles(t, r)
+
+	keys, err = DecodeKeyStoreFiles(files, func() ([]byte, error) { return pass, nil })
+	require.NoError(t, err)
+	require.Equal(t, testKeys, keys)
+
+	_, err = DecodeKeyStoreFiles(files, func() ([]byte, error) { return []byte("wrong"), nil })
+	require.ErrorIs(t, err, ErrBadPassphrase)
+
+	_, err = DecodeKeyStoreFiles(files, func() ([]byte, error) { return nil, ErrKeyStoreLocked })
+	require.ErrorIs(t, err, ErrKeyStoreLocked)
+}
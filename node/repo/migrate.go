@@ -0,0 +1,266 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/xerrors"
+
+	"github.com/lyswifter/dbridge/lib/backupds"
+	"github.com/lyswifter/dbridge/node/config"
+	"github.com/lyswifter/dbridge/types"
+)
+
+const (
+	fsVersion = "version"
+	fsBackups = "backups"
+)
+
+// RepoVersion is the version of the repo layout written by this build. Repos
+// created before the version marker was added are version 0.
+const RepoVersion = 1
+
+var ErrRepoTooNew = xerrors.New("repo was written by a newer version of dbridge")
+
+// Migration upgrades a repo from version From to From+1. Apply is called with
+// the repo locked.
+type Migration struct {
+	From        int
+	Description string
+	Apply       func(ctx context.Context, lr LockedRepo) error `json:"-"`
+}
+
+// migrations are the repo migrations, ordered by version. A change to the repo
+// layout bumps RepoVersion and adds the migration from the previous version
+// here.
+var migrations = []Migration{
+	{
+		From:        0,
+		Description: "add repo version marker",
+		Apply: func(ctx context.Context, lr LockedRepo) error {
+			return nil
+		},
+	},
+}
+
+// MigrateOptions control how pending migrations are applied.
+type MigrateOptions struct {
+	// DryRun lists the pending migrations without applying them.
+	DryRun bool
+	// NoBackup skips the metadata datastore backup taken before migrating.
+	NoBackup bool
+	// KeyStorePassphrase unlocks an encrypted keystore, when the backup is
+	// encrypted with the backup key in the keystore.
+	KeyStorePassphrase func() ([]byte, error)
+}
+
+// MigrateResult describes the migrations of a repo.
+type MigrateResult struct {
+	From, To int
+	Pending  []Migration
+	// Backup is the path of the datastore backup taken before migrating
+	Backup string `json:",omitempty"`
+}
+
+// Version returns the version of the repo, 0 when it has no version marker.
+func (fsr *FsRepo) Version() (int, error) {
+	return readVersion(fsr.path)
+}
+
+// PendingMigrations returns the migrations needed to bring the repo to
+// RepoVersion.
+func (fsr *FsRepo) PendingMigrations() ([]Migration, error) {
+	v, err := fsr.Version()
+	if err != nil {
+		return nil, err
+	}
+	return pendingMigrations(migrations, v, RepoVersion)
+}
+
+// Migrate locks the repo and applies pending migrations.
+func (fsr *FsRepo) Migrate(ctx context.Context, opts MigrateOptions) (*MigrateResult, error) {
+	lr, err := fsr.lock(Dbridge)
+	if err != nil {
+		return nil, err
+	}
+	defer lr.Close() //nolint:errcheck
+
+	return lr.migrate(ctx, opts)
+}
+
+func (fsr *fsLockedRepo) migrate(ctx context.Context, opts MigrateOptions) (*MigrateResult, error) {
+	return fsr.migrateTo(ctx, opts, migrations, RepoVersion)
+}
+
+func (fsr *fsLockedRepo) migrateTo(ctx context.Context, opts MigrateOptions, ms []Migration, target int) (*MigrateResult, error) {
+	v, err := readVersion(fsr.path)
+	if err != nil {
+		return nil, err
+	}
+
+	pending, err := pendingMigrations(ms, v, target)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &MigrateResult{From: v, To: target, Pending: pending}
+	if len(pending) == 0 || opts.DryRun {
+		return res, nil
+	}
+
+	if !opts.NoBackup {
+		res.Backup, err = fsr.backupMetadata(ctx, fmt.Sprintf("premigrate-v%d", v), opts.KeyStorePassphrase)
+		if err != nil {
+			return res, xerrors.Errorf("backing up metadata before migrating: %w", err)
+		}
+		log.Infow("backed up metadata before migrating", "path", res.Backup)
+	}
+
+	for _, m := range pending {
+		log.Infow("migrating repo", "from", m.From, "to", m.From+1, "migration", m.Description)
+
+		if err := m.Apply(ctx, fsr); err != nil {
+			return res, xerrors.Errorf("migrating repo from version %d (%s): %w", m.From, m.Description, err)
+		}
+		// record each step, so that an interrupted migration resumes where
+		// it stopped
+		if err := writeVersion(fsr.path, m.From+1); err != nil {
+			return res, err
+		}
+	}
+
+	return res, nil
+}
+
+// backupMetadata writes a backup of the metadata datastore into the backups
+// directory of the repo, encrypted as set by Backup.Encryption, returning its
+// path.
+func (fsr *fsLockedRepo) backupMetadata(ctx context.Context, name string, pass func() ([]byte, error)) (string, error) {
+	key, err := fsr.metadataBackupKey(pass)
+	if err != nil {
+		return "", err
+	}
+
+	mds, err := fsr.Datastore(ctx, "/metadata")
+	if err != nil {
+		return "", err
+	}
+
+	bds, err := backupds.Wrap(mds, backupds.NoLogdir, backupds.WithEncryption(key))
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(fsr.join(fsBackups), 0700); err != nil {
+		return "", err
+	}
+
+	p := fsr.join(fsBackups, fmt.Sprintf("%s-%s.cbor", name, time.Now().UTC().Format("20060102T150405Z")))
+	f, err := os.OpenFile(p, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return "", err
+	}
+
+	if err := bds.Backup(ctx, f); err != nil {
+		_ = f.Close()
+		_ = os.Remove(p)
+		return "", err
+	}
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		return "", err
+	}
+	return p, f.Close()
+}
+
+// metadataBackupKey returns the key backups are encrypted with, unlocking the
+// keystore with pass if the key is kept there.
+func (fsr *fsLockedRepo) metadataBackupKey(pass func() ([]byte, error)) (*backupds.Key, error) {
+	c, err := fsr.Config()
+	if err != nil {
+		return nil, err
+	}
+	cfg, ok := c.(*config.BdridgeNode)
+	if !ok {
+		return nil, xerrors.Errorf("invalid config from repo, got: %T", c)
+	}
+
+	var ks types.KeyStore
+	if cfg.Backup.Encryption == config.BackupEncryptionKeystore {
+		locked, err := fsr.KeyStoreLocked()
+		if err != nil {
+			return nil, err
+		}
+		if locked {
+			if pass == nil {
+				return nil, xerrors.Errorf("backups are encrypted with a key in the keystore, which is encrypted; run 'dbridge repo migrate' to unlock it: %w", ErrKeyStoreLocked)
+			}
+			p, err := pass()
+			if err != nil {
+				return nil, xerrors.Errorf("getting keystore passphrase: %w", err)
+			}
+			if err := fsr.UnlockKeyStore(p); err != nil {
+				return nil, err
+			}
+		}
+
+		if ks, err = fsr.KeyStore(); err != nil {
+			return nil, err
+		}
+	}
+
+	return BackupKey(ks, cfg.Backup.Encryption)
+}
+
+// pendingMigrations returns the migrations of ms taking a repo from version v
+// to target, one for each version in between.
+func pendingMigrations(ms []Migration, v, target int) ([]Migration, error) {
+	if v > target {
+		return nil, xerrors.Errorf("repo version %d, this build supports up to %d: %w", v, target, ErrRepoTooNew)
+	}
+
+	out := []Migration{}
+	for _, m := range ms {
+		if m.From < v || m.From >= target {
+			continue
+		}
+		if m.From != v+len(out) {
+			break
+		}
+		out = append(out, m)
+	}
+	if len(out) != target-v {
+		return nil, xerrors.Errorf("no migration path from repo version %d to %d", v, target)
+	}
+	return out, nil
+}
+
+func readVersion(repoPath string) (int, error) {
+	b, err := ioutil.ReadFile(filepath.Join(repoPath, fsVersion))
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, xerrors.Errorf("reading repo version: %w", err)
+	}
+
+	v, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		return 0, xerrors.Errorf("parsing repo version: %w", err)
+	}
+	return v, nil
+}
+
+func writeVersion(repoPath string, v int) error {
+	p := filepath.Join(repoPath, fsVersion)
+	if err := ioutil.WriteFile(p+".tmp", []byte(strconv.Itoa(v)+"\n"), 0644); err != nil {
+		return xerrors.Errorf("writing repo version: %w", err)
+	}
+	return os.Rename(p+".tmp", p)
+}
@@ -0,0 +1,238 @@
+package repo
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ipfs/go-datastore"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/xerrors"
+
+	"github.com/lyswifter/dbridge/lib/backupds"
+)
+
+func testMigrations(from ...int) []Migration {
+	out := make([]Migration, len(from))
+	for i, f := range from {
+		out[i] = Migration{From: f, Apply: func(context.Context, LockedRepo) error { return nil }}
+	}
+	return out
+}
+
+func TestPendingMigrations(t *testing.T) {
+	tests := []struct {
+		name       string
+		migrations []Migration
+		version    int
+		target     int
+
+		pending []int
+		err     string
+	}{
+		{name: "up to date", migrations: testMigrations(0, 1), version: 2, target: 2, pending: []int{}},
+		{name: "all", migrations: testMigrations(0, 1, 2), version: 0, target: 3, pending: []int{0, 1, 2}},
+		{name: "from version", migrations: testMigrations(0, 1, 2), version: 1, target: 3, pending: []int{1, 2}},
+		{name: "newer migrations ignored", migrations: testMigrations(0, 1, 2), version: 0, target: 2, pending: []int{0, 1}},
+		{name: "gap", migrations: testMigrations(0, 2, 3), version: 0, target: 3, err: "no migration path"},
+		{name: "gap at the start", migrations: testMigrations(1, 2), version: 0, target: 3, err: "no migration path"},
+		{name: "missing last", migrations: testMigrations(0, 1), version: 0, target: 3, err: "no migration path"},
+		{name: "too new", migrations: testMigrations(0, 1), version: 3, target: 2, err: ErrRepoTooNew.Error()},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			pending, err := pendingMigrations(tc.migrations, tc.version, tc.target)
+			if tc.err != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tc.err)
+				return
+			}
+			require.NoError(t, err)
+
+			from := []int{}
+			for _, m := range pending {
+				from = append(from, m.From)
+			}
+			require.Equal(t, tc.pending, from)
+		})
+	}
+}
+
+func TestVersionFile(t *testing.T) {
+	dir := t.TempDir()
+
+	// repos from before the version marker
+	v, err := readVersion(dir)
+	require.NoError(t, err)
+	require.Equal(t, 0, v)
+
+	for _, v := range []int{1, 12, 0} {
+		require.NoError(t, writeVersion(dir, v))
+		got, err := readVersion(dir)
+		require.NoError(t, err)
+		require.Equal(t, v, got)
+	}
+
+	_, err = os.Stat(filepath.Join(dir, fsVersion+".tmp"))
+	require.True(t, os.IsNotExist(err))
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, fsVersion), []byte("x\n"), 0644))
+	_, err = readVersion(dir)
+	require.Error(t, err)
+}
+
+func TestMigrateResume(t *testing.T) {
+	r := newTestRepo(t)
+	require.NoError(t, writeVersion(r.path, 0))
+
+	var applied []int
+	fail := true
+	ms := testMigrations(0, 1, 2)
+	for i := range ms {
+		from := ms[i].From
+		ms[i].Apply = func(context.Context, LockedRepo) error {
+			if from == 1 && fail {
+				return xerrors.New("interrupted")
+			}
+			applied = append(applied, from)
+			return nil
+		}
+	}
+
+	lr, err := r.lock(Dbridge)
+	require.NoError(t, err)
+	_, err = lr.migrateTo(context.Background(), MigrateOptions{NoBackup: true}, ms, 3)
+	require.Error(t, err)
+	require.NoError(t, lr.Close())
+
+	// the step which went through is recorded
+	v, err := r.Version()
+	require.NoError(t, err)
+	require.Equal(t, 1, v)
+	require.Equal(t, []int{0}, applied)
+
+	fail = false
+	lr, err = r.lock(Dbridge)
+	require.NoError(t, err)
+	res, err := lr.migrateTo(context.Background(), MigrateOptions{NoBackup: true}, ms, 3)
+	require.NoError(t, err)
+	require.NoError(t, lr.Close())
+
+	require.Equal(t, 1, res.From)
+	require.Len(t, res.Pending, 2)
+	require.Equal(t, []int{0, 1, 2}, applied)
+
+	v, err = r.Version()
+	require.NoError(t, err)
+	require.Equal(t, 3, v)
+}
+
+func TestMigrateDryRun(t *testing.T) {
+	r := newTestRepo(t)
+	require.NoError(t, writeVersion(r.path, 0))
+
+	lr, err := r.lock(Dbridge)
+	require.NoError(t, err)
+	defer lr.Close() //nolint:errcheck
+
+	res, err := lr.migrateTo(context.Background(), MigrateOptions{DryRun: true}, testMigrations(0, 1), 2)
+	require.NoError(t, err)
+	require.Len(t, res.Pending, 2)
+
+	v, err := r.Version()
+	require.NoError(t, err)
+	require.Equal(t, 0, v)
+}
+
+func TestMigrateBackupEncrypted(t *testing.T) {
+	pass := []byte("keystore passphrase")
+
+	tests := []struct {
+		name       string
+		encryption string
+		// encrypt the keystore with pass
+		lockedKeyStore bool
+		// give pass to the migration
+		unlock bool
+
+		err       error
+		encrypted bool
+	}{
+		{name: "plaintext", encryption: "", lockedKeyStore: true},
+		{name: "passphrase", encryption: "passphrase", lockedKeyStore: true, encrypted: true},
+		{name: "keystore", encryption: "keystore", encrypted: true},
+		{name: "locked keystore", encryption: "keystore", lockedKeyStore: true, unlock: true, encrypted: true},
+		{name: "locked keystore without passphrase", encryption: "keystore", lockedKeyStore: true, err: ErrKeyStoreLocked},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv(backupds.PassphraseEnv, "backup passphrase")
+
+			r := newTestRepo(t)
+			cfg := fmt.Sprintf("[Backup]\n  Encryption = %q\n", tc.encryption)
+			require.NoError(t, ioutil.WriteFile(r.configPath, []byte(cfg), 0644))
+			if tc.lockedKeyStore {
+				setPassphrase(t, r, nil, pass)
+			}
+
+			lr, err := r.lock(Dbridge)
+			require.NoError(t, err)
+			mds, err := lr.Datastore(context.Background(), "/metadata")
+			require.NoError(t, err)
+			require.NoError(t, mds.Put(context.Background(), datastore.NewKey("/a"), []byte("value")))
+			require.NoError(t, writeVersion(r.path, 0))
+
+			opts := MigrateOptions{}
+			if tc.unlock {
+				opts.KeyStorePassphrase = func() ([]byte, error) { return pass, nil }
+			}
+			res, err := lr.migrateTo(context.Background(), opts, testMigrations(0), 1)
+			if tc.err != nil {
+				require.ErrorIs(t, err, tc.err)
+				require.NoError(t, lr.Close())
+				return
+			}
+			require.NoError(t, err)
+
+			// the keys the backup can be read with
+			locked, err := lr.KeyStoreLocked()
+			require.NoError(t, err)
+			if locked {
+				require.NoError(t, lr.UnlockKeyStore(pass))
+			}
+			ks, err := lr.KeyStore()
+			require.NoError(t, err)
+			_, keys, err := BackupKeys(ks, tc.encryption)
+			require.NoError(t, err)
+			require.NoError(t, lr.Close())
+
+			require.Equal(t, filepath.Join(r.path, fsBackups), filepath.Dir(res.Backup))
+
+			data, err := ioutil.ReadFile(res.Backup)
+			require.NoError(t, err)
+
+			_, err = backupds.ReadBackup(bytes.NewReader(data), func(datastore.Key, []byte, bool) error { return nil })
+			if !tc.encrypted {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorIs(t, err, backupds.ErrEncrypted)
+
+			var got []byte
+			_, err = backupds.ReadBackupWithKeys(bytes.NewReader(data), keys, func(k datastore.Key, v []byte, _ bool) error {
+				if k == datastore.NewKey("/a") {
+					got = v
+				}
+				return nil
+			})
+			require.NoError(t, err)
+			require.Equal(t, []byte("value"), got)
+		})
+	}
+}
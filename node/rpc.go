@@ -2,17 +2,25 @@ package node
 
 import (
 	"context"
+	"crypto/tls"
 	"net"
 	"net/http"
+	"os"
+	"syscall"
 
 	"github.com/filecoin-project/go-jsonrpc"
 	"github.com/filecoin-project/go-jsonrpc/auth"
 	"github.com/gorilla/mux"
 	logging "github.com/ipfs/go-log/v2"
 	"github.com/lyswifter/dbridge/api"
+	"github.com/lyswifter/dbridge/lib/audit"
+	"github.com/lyswifter/dbridge/lib/caller"
+	"github.com/lyswifter/dbridge/lib/ratelimit"
+	"github.com/lyswifter/dbridge/metrics"
 	"github.com/lyswifter/dbridge/metrics/proxy"
 	"github.com/multiformats/go-multiaddr"
 	manet "github.com/multiformats/go-multiaddr/net"
+	"go.opencensus.io/tag"
 	"golang.org/x/xerrors"
 )
 
@@ -25,34 +33,157 @@ var rpclog = logging.Logger("rpc")
 //
 // The supplied ID is used in tracing, by inserting a tag in the context.
 func ServeRPC(h http.Handler, id string, addr multiaddr.Multiaddr) (StopFunc, error) {
+	return serveRPC(h, id, addr, nil)
+}
+
+// ServeRemoteRPC is like ServeRPC, but only accepts TLS connections, which are
+// negotiated with the supplied configuration.
+func ServeRemoteRPC(h http.Handler, id string, addr multiaddr.Multiaddr, tlsCfg *tls.Config) (StopFunc, error) {
+	if tlsCfg == nil {
+		return nil, xerrors.New("remote rpc requires a TLS config")
+	}
+	return serveRPC(h, id, addr, tlsCfg)
+}
+
+func serveRPC(h http.Handler, id string, addr multiaddr.Multiaddr, tlsCfg *tls.Config) (StopFunc, error) {
 	// Start listening to the addr; if invalid or occupied, we will fail early.
-	lst, err := manet.Listen(addr)
-	if err != nil {
-		return nil, xerrors.Errorf("could not listen: %w", err)
+	var nl net.Listener
+	if path, err := addr.ValueForProtocol(multiaddr.P_UNIX); err == nil {
+		var private bool
+		nl, private, err = listenUnix(path)
+		if err != nil {
+			return nil, xerrors.Errorf("could not listen: %w", err)
+		}
+		if private {
+			h = localSocketAuth(h)
+		} else {
+			rpclog.Warnw("api socket is accessible to other users, requests need an API token", "path", path)
+		}
+	} else {
+		lst, err := manet.Listen(addr)
+		if err != nil {
+			return nil, xerrors.Errorf("could not listen: %w", err)
+		}
+		nl = manet.NetListener(lst)
+	}
+
+	if tlsCfg != nil {
+		nl = tls.NewListener(nl, tlsCfg)
 	}
 
 	// Instantiate the server and start listening.
 	srv := &http.Server{
 		Handler: h,
 		BaseContext: func(listener net.Listener) context.Context {
-			// ctx, _ := tag.New(context.Background(), tag.Upsert(metrics.APIInterface, id))
-			ctx := context.Background()
+			ctx, _ := tag.New(context.Background(), tag.Upsert(metrics.APIInterface, id))
 			return ctx
 		},
 	}
 
 	go func() {
-		err = srv.Serve(manet.NetListener(lst))
+		err := srv.Serve(nl)
 		if err != http.ErrServerClosed {
 			rpclog.Warnf("rpc server failed: %s", err)
 		}
 	}()
 
-	return srv.Shutdown, err
+	return srv.Shutdown, nil
+}
+
+// listenUnix listens on the unix socket at path, replacing a stale socket left
+// behind by a node which didn't shut down cleanly. The socket is made
+// accessible to the current user only; private reports whether that worked.
+func listenUnix(path string) (nl net.Listener, private bool, err error) {
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, false, xerrors.Errorf("%s exists and is not a socket", path)
+		}
+
+		if c, err := net.Dial("unix", path); err == nil {
+			_ = c.Close()
+			return nil, false, xerrors.Errorf("socket %s is in use", path)
+		}
+
+		if err := os.Remove(path); err != nil {
+			return nil, false, xerrors.Errorf("removing stale socket: %w", err)
+		}
+	}
+
+	nl, err = net.Listen("unix", path)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if err := os.Chmod(path, 0600); err != nil {
+		_ = nl.Close()
+		return nil, false, xerrors.Errorf("setting socket permissions: %w", err)
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		_ = nl.Close()
+		return nil, false, err
+	}
+
+	private = fi.Mode().Perm()&0077 == 0
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		private = private && int(st.Uid) == os.Getuid()
+	}
+
+	return nl, private, nil
+}
+
+// localSocketAuth grants all permissions to requests arriving over a unix
+// socket only the node's user can connect to. A token sent along with the
+// request takes precedence.
+func localSocketAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(auth.WithPerm(r.Context(), api.AllPermissions)))
+	})
+}
+
+// ClientCertAuth grants permissions to requests arriving over TLS with a
+// verified client certificate, based on the certificate's common name.
+//
+// It must wrap a handler which performs token authentication; a token sent
+// along with the request takes precedence over the certificate permissions.
+func ClientCertAuth(next http.Handler, perms map[string][]auth.Permission) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+			cn := r.TLS.VerifiedChains[0][0].Subject.CommonName
+			if allow, ok := perms[cn]; ok {
+				r = r.WithContext(auth.WithPerm(r.Context(), allow))
+			} else {
+				rpclog.Debugw("client certificate not mapped to any permissions", "cn", cn, "remote", r.RemoteAddr)
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
 }
 
 // FullNodeHandler returns a full node handler, to be mounted as-is on the server.
-func FullNodeHandler(a api.FullNode, permissioned bool, opts ...jsonrpc.ServerOption) (http.Handler, error) {
+// Next to the RPC, it serves metrics and pprof, so it's meant for the local API
+// endpoint. When an audit log is passed, calls which need more than read
+// permission are recorded in it. When a limiter is passed, calls are subject to
+// its limits.
+func FullNodeHandler(a api.FullNode, permissioned bool, auditLog *audit.Log, limiter *ratelimit.Limiter, opts ...jsonrpc.ServerOption) (http.Handler, error) {
+	m := rpcRouter(a, permissioned, auditLog, limiter, opts...)
+
+	m.Handle("/metrics", metrics.Exporter())
+
+	m.PathPrefix("/").Handler(http.DefaultServeMux) // pprof
+
+	return m, nil
+}
+
+// RemoteFullNodeHandler returns a full node handler for the remote API
+// endpoint, which only serves the permissioned RPC.
+func RemoteFullNodeHandler(a api.FullNode, auditLog *audit.Log, limiter *ratelimit.Limiter, opts ...jsonrpc.ServerOption) (http.Handler, error) {
+	return rpcRouter(a, true, auditLog, limiter, opts...), nil
+}
+
+func rpcRouter(a api.FullNode, permissioned bool, auditLog *audit.Log, limiter *ratelimit.Limiter, opts ...jsonrpc.ServerOption) *mux.Router {
 	m := mux.NewRouter()
 
 	serveRpc := func(path string, hnd interface{}) {
@@ -60,8 +191,14 @@ func FullNodeHandler(a api.FullNode, permissioned bool, opts ...jsonrpc.ServerOp
 		rpcServer.Register("Dbridge", hnd)
 
 		var handler http.Handler = rpcServer
+		if limiter != nil {
+			handler = ratelimit.Handler(handler)
+		}
+		if auditLog != nil || limiter != nil {
+			handler = caller.Handler(handler)
+		}
 		if permissioned {
-			handler = &auth.Handler{Verify: a.AuthVerify, Next: rpcServer.ServeHTTP}
+			handler = &auth.Handler{Verify: a.AuthVerify, Next: handler.ServeHTTP}
 		}
 
 		m.Handle(path, handler)
@@ -69,12 +206,16 @@ func FullNodeHandler(a api.FullNode, permissioned bool, opts ...jsonrpc.ServerOp
 
 	fnapi := proxy.MetricedFullAPI(a)
 	if permissioned {
-		fnapi = api.PermissionedFullAPI(a)
+		fnapi = api.PermissionedFullAPI(fnapi)
+	}
+	if limiter != nil {
+		fnapi = ratelimit.FullAPI(fnapi, limiter)
+	}
+	if auditLog != nil {
+		fnapi = audit.FullAPI(fnapi, auditLog)
 	}
 
 	serveRpc("/rpc/v0", fnapi)
 
-	m.PathPrefix("/").Handler(http.DefaultServeMux) // pprof
-
-	return m, nil
+	return m
 }